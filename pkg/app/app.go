@@ -1,6 +1,7 @@
 package app
 
 import (
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
 	"github.com/urfave/cli/v2"
 )
 
@@ -11,7 +12,7 @@ func NewApp() *cli.App {
 		{
 			Name:   "cmd",
 			Action: Action,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "file",
 					Aliases: []string{"f"},
@@ -22,11 +23,6 @@ func NewApp() *cli.App {
 					Aliases: []string{"c"},
 					Usage:   "PR comment",
 				},
-				&cli.StringFlag{
-					Name:    "vendor",
-					Aliases: []string{"v"},
-					Usage:   "The vendor for the comment mock|github|bitbucket",
-				},
 				&cli.IntFlag{
 					Name:    "start-line",
 					Aliases: []string{"s"},
@@ -38,31 +34,115 @@ func NewApp() *cli.App {
 					Usage:   "Comment end line",
 				},
 				&cli.StringFlag{
-					Name:  "repo",
-					Usage: "The repo name",
-				},
-				&cli.IntFlag{
-					Name:  "pr-number",
-					Usage: "The pr number",
+					Name:    "input",
+					Aliases: []string{"i"},
+					Usage:   "Read the findings from a file instead, - for stdin",
 				},
 				&cli.StringFlag{
-					Name:  "owner",
-					Usage: "The repo owner",
+					Name:  "format",
+					Usage: "The format of the findings json|jsonl|rdjson|rdjsonl, by default guessed from the input extension or jsonl",
 				},
+				&cli.BoolFlag{
+					Name:  "write-only",
+					Usage: "Write the findings as they are read, without reconciling the comments of previous runs",
+				},
+			}, reconcileFlags()...),
+		},
+		{
+			Name:   "sarif",
+			Usage:  "Reconcile the results of a SARIF log as PR comments",
+			Action: SarifAction,
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
-					Name:  "project",
-					Usage: "The project name (azure)",
+					Name:     "input",
+					Aliases:  []string{"i"},
+					Usage:    "The SARIF log",
+					Required: true,
 				},
 				&cli.StringFlag{
-					Name:  "collection-url",
-					Usage: "The collection url (azure)",
+					Name:  "source-root",
+					Usage: "The repository root, trimmed from absolute result paths",
 				},
+			}, reconcileFlags()...),
+		},
+		{
+			Name:   "trivy",
+			Usage:  "Reconcile the findings of a Trivy JSON report as PR comments",
+			Action: TrivyAction,
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
-					Name:  "repo-id",
-					Usage: "The repository ID (azure)",
+					Name:     "input",
+					Aliases:  []string{"i"},
+					Usage:    "The Trivy report, written with --format json",
+					Required: true,
 				},
-			},
+			}, reconcileFlags()...),
 		},
 	}
 	return app
 }
+
+func reconcileFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "marker",
+			Usage: "The marker identifying the comments written by previous runs",
+			Value: commenter.DefaultMarker,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Read the PR but only plan the comment changes, without writing anything",
+		},
+		&cli.StringFlag{
+			Name:  "plan",
+			Usage: "Write the dry run plan to this file instead of stdout",
+		},
+		&cli.StringFlag{
+			Name:  "out-of-diff",
+			Usage: "What to do with findings outside the PR diff drop|nearest|file|summary: skip them, move them to the nearest changed line, comment on their file or list them in the summary comment",
+			Value: string(commenter.OutOfDiffDrop),
+		},
+	}, vendorFlags()...)
+}
+
+func vendorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "vendor",
+			Aliases: []string{"v"},
+			Usage:   "The vendor for the comment mock|github|bitbucket",
+		},
+		&cli.StringFlag{
+			Name:  "repo",
+			Usage: "The repo name",
+		},
+		&cli.IntFlag{
+			Name:  "pr-number",
+			Usage: "The pr number",
+		},
+		&cli.StringFlag{
+			Name:  "owner",
+			Usage: "The repo owner",
+		},
+		&cli.StringFlag{
+			Name:  "project",
+			Usage: "The project name (azure)",
+		},
+		&cli.StringFlag{
+			Name:  "collection-url",
+			Usage: "The collection url (azure)",
+		},
+		&cli.StringFlag{
+			Name:  "repo-id",
+			Usage: "The repository ID (azure)",
+		},
+		&cli.StringFlag{
+			Name:  "api-url",
+			Usage: "The API URL of GitHub Enterprise Server, github.com by default (github)",
+		},
+		&cli.BoolFlag{
+			Name:  "batch-reviews",
+			Usage: "Submit the new comments as pull request reviews rather than one by one (github)",
+		},
+	}
+}
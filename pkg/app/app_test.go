@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+const sarifLog = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "scanner", "rules": [{"id": "rule"}]}},
+    "results": [
+      {"ruleId": "rule", "message": {"text": "first"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go"}, "region": {"startLine": 2}}}]},
+      {"ruleId": "rule", "message": {"text": "second"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go"}, "region": {"startLine": 4}}}]}
+    ]
+  }]
+}`
+
+func TestSarif_BatchReviews(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", "@@ -1,5 +1,10 @@\n a\n+b\n+c\n+d\n+e\n+f\n g\n h\n i\n j\n")
+
+	input := filepath.Join(t.TempDir(), "results.sarif")
+	if err := os.WriteFile(input, []byte(sarifLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	err := NewApp().Run([]string{"commenter", "sarif", "-i", input, "-v", "github", "--api-url", s.APIURL(),
+		"--owner", fakeserver.Owner, "--repo", fakeserver.Repo, "--pr-number", strconv.Itoa(fakeserver.PRNumber), "--batch-reviews"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if n := s.Count(http.MethodPost, "/reviews"); n != 1 {
+		t.Fatalf("expected a single review to be submitted, got %d", n)
+	}
+	if n := s.Count(http.MethodPost, "/comments"); n != 0 {
+		t.Fatalf("expected no comment to be written on its own, got %d", n)
+	}
+	if n := len(s.Comments()); n != 2 {
+		t.Fatalf("expected the review to hold 2 comments, got %d", n)
+	}
+}
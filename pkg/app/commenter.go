@@ -1,8 +1,10 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/azure"
@@ -14,15 +16,50 @@ import (
 )
 
 func Action(ctx *cli.Context) (err error) {
+	if ctx.IsSet("input") {
+		return FindingsAction(ctx)
+	}
+
+	// The comment goes through the findings API, like the other commands, for
+	// the out-of-diff policy, the dry run and the results to apply to it
+	return run(ctx, func(runCtx context.Context, repo commenter.RepositoryV2) ([]commenter.Result, error) {
+		return repo.WriteFindings(runCtx, []commenter.Finding{{
+			Path:      ctx.String("file"),
+			StartLine: ctx.Int("start-line"),
+			EndLine:   ctx.Int("end-line"),
+			Body:      ctx.String("comment"),
+		}})
+	})
+}
+
+// newRepository creates the client of the vendor selected by the flags
+func newRepository(ctx *cli.Context) (commenter.Repository, error) {
 	var c = commenter.Repository(nil)
 	switch ctx.String("vendor") {
 	case "mock":
 		c = commenter.Repository(mock.NewMock())
 	case "github":
 		token := os.Getenv("GITHUB_TOKEN")
-		r, err := github.NewGithub(token, ctx.String("owner"), ctx.String("repo"), ctx.Int("pr-number"))
+		var opts []github.Option
+		if appID := os.Getenv("GITHUB_APP_ID"); appID != "" {
+			id, err := strconv.ParseInt(appID, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed parse GITHUB_APP_ID: %w", err)
+			}
+			opts = append(opts, github.WithApp(id, []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))))
+		}
+		if ctx.Bool("batch-reviews") {
+			opts = append(opts, github.WithBatchReviews())
+		}
+		var r *github.Github
+		var err error
+		if apiUrl := ctx.String("api-url"); apiUrl != "" {
+			r, err = github.NewGithubServer(apiUrl, token, ctx.String("owner"), ctx.String("repo"), ctx.Int("pr-number"), opts...)
+		} else {
+			r, err = github.NewGithub(token, ctx.String("owner"), ctx.String("repo"), ctx.Int("pr-number"), opts...)
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		c = commenter.Repository(r)
 	case "gitlab":
@@ -30,14 +67,14 @@ func Action(ctx *cli.Context) (err error) {
 		r, err := gitlab.NewGitlab(
 			token, "", "", "")
 		if err != nil {
-			return err
+			return nil, err
 		}
 		c = commenter.Repository(r)
 	case "azure":
 		token := os.Getenv("AZURE_TOKEN")
 		r, err := azure.NewAzure(token, ctx.String("project"), ctx.String("collection-url"), ctx.String("repo-id"), ctx.String("pr-number"))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		c = commenter.Repository(r)
 	case "bitbucket":
@@ -45,20 +82,11 @@ func Action(ctx *cli.Context) (err error) {
 		token := os.Getenv("BITBUCKET_TOKEN")
 		r, err := bitbucket.NewBitbucket(userName, token)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		c = commenter.Repository(r)
+	default:
+		return nil, fmt.Errorf("unsupported vendor: %q", ctx.String("vendor"))
 	}
-
-	err = c.WriteMultiLineComment(
-		ctx.String("file"),
-		ctx.String("comment"),
-		ctx.Int("start-line"),
-		ctx.Int("end-line"))
-	if err != nil {
-		return fmt.Errorf("failed write comment: %w", err)
-	}
-
-	return nil
-
+	return c, nil
 }
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/urfave/cli/v2"
+)
+
+// run hands the repository of the selected vendor to fn and reports the
+// results. With --dry-run the PR is still read, but every write is recorded
+// in a plan which is written to --plan, or stdout, instead of being sent.
+// Findings outside the PR diff are handled as --out-of-diff says.
+func run(ctx *cli.Context, fn func(context.Context, commenter.RepositoryV2) ([]commenter.Result, error)) error {
+	policy, err := commenter.ParseOutOfDiff(ctx.String("out-of-diff"))
+	if err != nil {
+		return err
+	}
+	c, err := newRepository(ctx)
+	if err != nil {
+		return err
+	}
+
+	runCtx := ctx.Context
+	var plan *dryrun.Plan
+	if ctx.Bool("dry-run") {
+		plan = dryrun.NewPlan()
+		runCtx = dryrun.WithPlan(runCtx, plan)
+	}
+
+	results, err := fn(runCtx, commenter.NewFallbackRepository(c, commenter.FallbackOptions{
+		Policy: policy,
+		Marker: ctx.String("marker"),
+	}))
+	printResults(results)
+	if plan != nil {
+		plan.AddResults(results)
+		if err := writePlan(ctx.String("plan"), plan); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := commenter.FirstError(results); err != nil {
+		return fmt.Errorf("failed write comment: %w", err)
+	}
+	return nil
+}
+
+func writePlan(path string, plan *dryrun.Plan) error {
+	w := io.Writer(os.Stdout)
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed create plan: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	if err := plan.WriteJSON(w); err != nil {
+		return fmt.Errorf("failed write plan: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/findings"
+	"github.com/urfave/cli/v2"
+)
+
+const stdinInput = "-"
+
+// FindingsAction reads the findings of --input, "-" being stdin. They are
+// reconciled once the input ends, or with --write-only written as they arrive.
+func FindingsAction(ctx *cli.Context) error {
+	input := ctx.String("input")
+	r := io.Reader(os.Stdin)
+	if input != stdinInput {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("failed open findings: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	format := findings.Format(ctx.String("format"))
+	if format == "" {
+		format = findings.FormatFor(input)
+	}
+	dec, err := findings.NewDecoder(r, format, findings.Options{
+		Marker:   ctx.String("marker"),
+		Provider: ctx.String("vendor"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ctx.Bool("write-only") {
+		var all []commenter.Finding
+		if err := decodeAll(dec, func(f commenter.Finding) error {
+			all = append(all, f)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return reconcile(ctx, all)
+	}
+
+	return run(ctx, func(runCtx context.Context, repo commenter.RepositoryV2) ([]commenter.Result, error) {
+		var results []commenter.Result
+		err := decodeAll(dec, func(f commenter.Finding) error {
+			written, err := repo.WriteFindings(runCtx, []commenter.Finding{f})
+			results = append(results, written...)
+			return err
+		})
+		return results, err
+	})
+}
+
+func decodeAll(dec *findings.Decoder, fn func(commenter.Finding) error) error {
+	for {
+		f, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/urfave/cli/v2"
+)
+
+var statusOrder = []commenter.Status{
+	commenter.StatusCreated,
+	commenter.StatusEdited,
+	commenter.StatusUnchanged,
+	commenter.StatusSkipped,
+	commenter.StatusFailed,
+	commenter.StatusReconciled,
+}
+
+// reconcile brings the comments of the selected vendor in line with findings
+// in a single run and reports what happened to each of them.
+func reconcile(ctx *cli.Context, findings []commenter.Finding) error {
+	return run(ctx, func(runCtx context.Context, repo commenter.RepositoryV2) ([]commenter.Result, error) {
+		results, err := repo.ReconcileFindings(runCtx, ctx.String("marker"), findings)
+		if err != nil {
+			return results, fmt.Errorf("failed reconcile comments: %w", err)
+		}
+		return results, nil
+	})
+}
+
+func printResults(results []commenter.Result) {
+	for _, r := range results {
+		if r.Fallback != "" && r.Fallback != commenter.OutOfDiffDrop {
+			fmt.Printf("outside the diff %s:%d: %s, %s\n", r.Finding.Path, r.Finding.StartLine, r.Fallback, r.Status)
+		}
+		switch r.Status {
+		case commenter.StatusSkipped:
+			fmt.Printf("skipped %s:%d: %s\n", r.Finding.Path, r.Finding.StartLine, r.Reason)
+		case commenter.StatusFailed:
+			fmt.Printf("failed %s:%d: %s\n", r.Finding.Path, r.Finding.StartLine, r.Err)
+		}
+	}
+
+	counts := commenter.Summarize(results)
+	fmt.Printf("%d findings:", len(results))
+	for _, status := range statusOrder {
+		if status == commenter.StatusReconciled && counts[status] == 0 {
+			continue
+		}
+		fmt.Printf(" %d %s", counts[status], status)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,27 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/sarif"
+	"github.com/urfave/cli/v2"
+)
+
+func SarifAction(ctx *cli.Context) error {
+	f, err := os.Open(ctx.String("input"))
+	if err != nil {
+		return fmt.Errorf("failed open sarif log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	findings, err := sarif.Parse(f, sarif.Options{
+		Marker:     ctx.String("marker"),
+		Provider:   ctx.String("vendor"),
+		SourceRoot: ctx.String("source-root"),
+	})
+	if err != nil {
+		return err
+	}
+	return reconcile(ctx, findings)
+}
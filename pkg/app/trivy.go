@@ -0,0 +1,26 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/trivy"
+	"github.com/urfave/cli/v2"
+)
+
+func TrivyAction(ctx *cli.Context) error {
+	f, err := os.Open(ctx.String("input"))
+	if err != nil {
+		return fmt.Errorf("failed open trivy report: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	findings, err := trivy.Parse(f, trivy.Options{
+		Marker:   ctx.String("marker"),
+		Provider: ctx.String("vendor"),
+	})
+	if err != nil {
+		return err
+	}
+	return reconcile(ctx, findings)
+}
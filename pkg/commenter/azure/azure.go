@@ -1,6 +1,7 @@
 package azure
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,9 +11,10 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils"
-
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 )
 
 type Azure struct {
@@ -21,6 +23,10 @@ type Azure struct {
 	PrNumber string
 	Project  string
 	ApiUrl   string
+	// HTTPClient sends the requests, transport.Default when nil
+	HTTPClient *transport.Client
+
+	diff *diff.Diff
 }
 
 type ThreadsResponse struct {
@@ -28,8 +34,20 @@ type ThreadsResponse struct {
 }
 
 type Thread struct {
-	Id       int       `json:"id,omitempty"`
-	Comments []Comment `json:"comments,omitempty"`
+	Id            int            `json:"id,omitempty"`
+	Comments      []Comment      `json:"comments,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	ThreadContext *ThreadContext `json:"threadContext,omitempty"`
+	Properties    Properties     `json:"properties,omitempty"`
+	IsDeleted     bool           `json:"isDeleted,omitempty"`
+}
+
+// Properties is the free-form property bag attached to a thread
+type Properties map[string]Property
+
+type Property struct {
+	Type  string      `json:"$type,omitempty"`
+	Value interface{} `json:"$value,omitempty"`
 }
 
 type LineStruct struct {
@@ -47,12 +65,27 @@ type Body struct {
 	Comments      []Comment     `json:"comments,omitempty"`
 	Status        int           `json:"status,omitempty"`
 	ThreadContext ThreadContext `json:"threadContext,omitempty"`
+	Properties    Properties    `json:"properties,omitempty"`
+}
+
+// fileBody is a thread on a file, its context has no line which the line
+// fields of ThreadContext can't leave out
+type fileBody struct {
+	Comments      []Comment   `json:"comments"`
+	Status        int         `json:"status"`
+	ThreadContext fileContext `json:"threadContext"`
+	Properties    Properties  `json:"properties,omitempty"`
+}
+
+type fileContext struct {
+	FilePath string `json:"filePath"`
 }
 
 type Comment struct {
 	Id              int    `json:"id,omitempty"`
 	ParentCommentId int    `json:"parentCommentId,omitempty"`
 	Content         string `json:"content,omitempty"`
+	IsDeleted       bool   `json:"isDeleted,omitempty"`
 }
 
 func NewAzure(token, project, collectionUrl, repoId, prNumber string) (b *Azure, err error) {
@@ -84,18 +117,40 @@ func NewAzure(token, project, collectionUrl, repoId, prNumber string) (b *Azure,
 
 // WriteMultiLineComment writes a multiline review on a file in the azure PR
 func (c *Azure) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
-	if !strings.HasPrefix(file, "/") {
-		file = fmt.Sprintf("/%s", file)
-	}
+	_, err := c.writeMultiLineComment(context.Background(), file, comment, startLine, endLine)
+	return err
+}
 
-	if startLine == commenter.FIRST_AVAILABLE_LINE || startLine == 0 {
-		// Reference: https://developercommunity.visualstudio.com/t/Adding-thread-to-PR-using-REST-API-cause/10598424
-		startLine = 1
+// WriteFinding writes the finding as a PR thread and reports the thread it produced
+func (c *Azure) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	if _, _, err := c.resolveLines(ctx, f.Path, f.StartLine, f.EndLine); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	// Azure DevOps can't apply suggestions, they are shown as a diff
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.Created(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	thread, err := c.writeMultiLineComment(ctx, f.Path, body, f.StartLine, f.EndLine)
+	if err != nil {
+		return commenter.FailedResult(f, err)
 	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(thread.Id),
+		URL:       c.threadUrl(thread.Id),
+	}
+}
 
-	if endLine == commenter.FIRST_AVAILABLE_LINE || endLine == 0 {
-		// Reference: https://developercommunity.visualstudio.com/t/Adding-thread-to-PR-using-REST-API-cause/10598424
-		endLine = 1
+func (c *Azure) writeMultiLineComment(ctx context.Context, file, comment string, startLine, endLine int) (Thread, error) {
+	// FIRST_AVAILABLE_LINE is resolved to line 1, reference: https://developercommunity.visualstudio.com/t/Adding-thread-to-PR-using-REST-API-cause/10598424
+	startLine, endLine, err := c.resolveLines(ctx, file, startLine, endLine)
+	if err != nil {
+		return Thread{}, err
+	}
+	if !strings.HasPrefix(file, "/") {
+		file = fmt.Sprintf("/%s", file)
 	}
 
 	b := Body{
@@ -119,70 +174,159 @@ func (c *Azure) WriteMultiLineComment(file, comment string, startLine, endLine i
 			},
 		},
 	}
+	if fp := commenter.ExtractFingerprint(comment); fp != "" {
+		b.Properties = Properties{fingerprintProperty: {Type: "System.String", Value: fp}}
+	}
+	thread, err := c.createThread(ctx, b)
+	if err != nil {
+		return Thread{}, fmt.Errorf("failed write azure line comment: %w", err)
+	}
+	return thread, nil
+}
+
+// WriteFileComment writes the finding as a thread on its file
+func (c *Azure) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	if err := c.resolveFile(ctx, f.Path); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	file := f.Path
+	if !strings.HasPrefix(file, "/") {
+		file = fmt.Sprintf("/%s", file)
+	}
+	b := fileBody{
+		Comments:      []Comment{{ParentCommentId: 1, Content: body}},
+		Status:        1,
+		ThreadContext: fileContext{FilePath: file},
+	}
+	if fp := commenter.ExtractFingerprint(body); fp != "" {
+		b.Properties = Properties{fingerprintProperty: {Type: "System.String", Value: fp}}
+	}
+	thread, err := c.createThread(ctx, b)
+	if err != nil {
+		return commenter.FailedResult(f, fmt.Errorf("failed write azure file comment: %w", err))
+	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(thread.Id),
+		URL:       c.threadUrl(thread.Id),
+	}
+}
 
+func (c *Azure) createThread(ctx context.Context, b interface{}) (Thread, error) {
 	reqBody, err := json.Marshal(b)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body for azure api: %s", err)
+		return Thread{}, fmt.Errorf("failed to marshal body for azure api: %s", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads?api-version=6.0",
-		c.ApiUrl, c.Project, c.RepoID, c.PrNumber),
-		strings.NewReader(string(reqBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.threadsApiUrl(), strings.NewReader(string(reqBody)))
 	if err != nil {
-		return err
+		return Thread{}, err
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.SetBasicAuth("", c.Token)
 
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed write azure line comment: %s", string(b))
+		return Thread{}, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	return nil
+	var thread Thread
+	if err := json.NewDecoder(resp.Body).Decode(&thread); err != nil {
+		return Thread{}, fmt.Errorf("failed decoding azure thread response with error: %w", err)
+	}
+	return thread, nil
+}
 
+func (c *Azure) threadUrl(threadId int) string {
+	return fmt.Sprintf("%s%s/_git/%s/pullrequest/%s?discussionId=%d", c.ApiUrl, c.Project, c.RepoID, c.PrNumber, threadId)
 }
 
 // WriteLineComment writes a single review line on a file of the azure PR
-func (c *Azure) WriteLineComment(_, _ string, _ int) error {
+func (c *Azure) WriteLineComment(file, comment string, line int) error {
+	_, err := c.writeMultiLineComment(context.Background(), file, comment, line, line)
+	return err
+}
 
+func (c *Azure) RemovePreviousAquaComments(msg string) error {
+	return c.RemoveAquaComments(context.Background(), msg)
+}
+
+// RemoveAquaComments deletes every thread comment containing the marker
+func (c *Azure) RemoveAquaComments(ctx context.Context, msg string) error {
+	threads, err := c.getThreads(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, thread := range threads {
+		for _, comment := range thread.Comments {
+			// deleted comments are still listed, deleting them again is a 404
+			if !comment.IsDeleted && strings.Contains(comment.Content, msg) {
+				if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(comment.Id), thread.path(), "")) {
+					continue
+				}
+				err = c.httpClient().Delete(ctx, c.commentApiUrl(thread.Id, comment.Id), c.getAuthHeaders())
+				if err != nil {
+					return fmt.Errorf("failed deleting comment with error: %w", err)
+				}
+			}
+		}
+	}
 	return nil
 }
 
-func (c *Azure) RemovePreviousAquaComments(msg string) error {
+// path is the file the thread is anchored to, empty for top-level threads.
+func (t Thread) path() string {
+	if t.ThreadContext == nil {
+		return ""
+	}
+	return t.ThreadContext.FilePath
+}
 
-	resp, err := utils.GetComments(fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads?api-version=6.0",
-		c.ApiUrl, c.Project, c.RepoID, c.PrNumber), map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+c.Token))})
+func (c *Azure) getThreads(ctx context.Context) ([]Thread, error) {
+	resp, err := c.httpClient().Get(ctx, c.threadsApiUrl(), c.getAuthHeaders())
 	if err != nil {
-		return fmt.Errorf("failed getting comments with error: %w", err)
+		return nil, fmt.Errorf("failed getting comments with error: %w", commenter.PrError(err, c.Project+"/"+c.RepoID, c.PrNumber))
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	commentsResponse := ThreadsResponse{}
 	err = json.Unmarshal(body, &commentsResponse)
 	if err != nil {
-		return fmt.Errorf("failed unmarshal response body with error: %w", err)
+		return nil, fmt.Errorf("failed unmarshal response body with error: %w", err)
 	}
+	return commentsResponse.Threads, nil
+}
 
-	for _, thread := range commentsResponse.Threads {
-		for _, comment := range thread.Comments {
-			if strings.Contains(comment.Content, msg) {
-				err = utils.DeleteComments(fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads/%s/comments/%s?api-version=6.0",
-					c.ApiUrl, c.Project, c.RepoID, c.PrNumber, strconv.Itoa(thread.Id), strconv.Itoa(comment.Id)), map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+c.Token))})
-				if err != nil {
-					return fmt.Errorf("failed deleting comment with error: %w", err)
-				}
-			}
-		}
-	}
-	return nil
+func (c *Azure) threadsApiUrl() string {
+	return fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads?api-version=6.0",
+		c.ApiUrl, c.Project, c.RepoID, c.PrNumber)
+}
+
+func (c *Azure) threadApiUrl(threadId int) string {
+	return fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads/%s?api-version=6.0",
+		c.ApiUrl, c.Project, c.RepoID, c.PrNumber, strconv.Itoa(threadId))
+}
+
+func (c *Azure) commentApiUrl(threadId, commentId int) string {
+	return fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/threads/%s/comments/%s?api-version=6.0",
+		c.ApiUrl, c.Project, c.RepoID, c.PrNumber, strconv.Itoa(threadId), strconv.Itoa(commentId))
+}
+
+func (c *Azure) getAuthHeaders() map[string]string {
+	return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+c.Token))}
+}
+
+func (c *Azure) httpClient() *transport.Client {
+	return commenter.HTTPClient(c.HTTPClient)
 }
@@ -0,0 +1,19 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, conformance.Harness{
+		New: conformance.NewFakeBackend(fakeserver.Azure),
+		Connect: func(t *testing.T, b conformance.Backend) commenter.Repository {
+			return newFakeAzure(conformance.Server(b))
+		},
+		MultiLine: true,
+	})
+}
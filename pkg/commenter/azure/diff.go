@@ -0,0 +1,237 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
+)
+
+type Iteration struct {
+	Id              int       `json:"id"`
+	SourceRefCommit CommitRef `json:"sourceRefCommit"`
+	CommonRefCommit CommitRef `json:"commonRefCommit"`
+}
+
+type CommitRef struct {
+	CommitId string `json:"commitId"`
+}
+
+type IterationsResponse struct {
+	Iterations []Iteration `json:"value"`
+}
+
+type ChangeEntry struct {
+	ChangeType   string `json:"changeType"`
+	OriginalPath string `json:"originalPath"`
+	Item         struct {
+		Path string `json:"path"`
+	} `json:"item"`
+}
+
+type ChangesResponse struct {
+	ChangeEntries []ChangeEntry `json:"changeEntries"`
+	NextSkip      int           `json:"nextSkip"`
+	NextTop       int           `json:"nextTop"`
+}
+
+type fileDiffParams struct {
+	Path         string `json:"path"`
+	OriginalPath string `json:"originalPath,omitempty"`
+}
+
+type fileDiffsCriteria struct {
+	BaseVersionCommit   string           `json:"baseVersionCommit"`
+	TargetVersionCommit string           `json:"targetVersionCommit"`
+	FileDiffParams      []fileDiffParams `json:"fileDiffParams"`
+}
+
+// LineDiffBlock is a block of lines of a file diff, the modified lines are
+// those of the new version.
+type LineDiffBlock struct {
+	ModifiedLineNumberStart int `json:"modifiedLineNumberStart"`
+	ModifiedLinesCount      int `json:"modifiedLinesCount"`
+}
+
+type FileDiff struct {
+	Path           string          `json:"path"`
+	LineDiffBlocks []LineDiffBlock `json:"lineDiffBlocks"`
+}
+
+type FileDiffsResponse struct {
+	FileDiffs []FileDiff `json:"value"`
+}
+
+// fileDiffsBatch bounds the files whose line blocks are asked for at once.
+const fileDiffsBatch = 50
+
+// resolveLines validates the lines against the blocks of lines changed by the
+// pull request. FIRST_AVAILABLE_LINE resolves to the first changed line.
+func (c *Azure) resolveLines(ctx context.Context, file string, startLine, endLine int) (int, int, error) {
+	startLine, endLine = commenter.NormalizeLines(startLine, endLine)
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return d.Resolve(file, startLine, endLine)
+}
+
+// resolveFile validates the file against the changes of the pull request.
+func (c *Azure) resolveFile(ctx context.Context, file string) error {
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return err
+	}
+	if !d.Has(file) {
+		return commenter.NotInDiffError{Path: file}
+	}
+	return nil
+}
+
+// loadDiff gets the files changed by the latest iteration of the pull request,
+// and the blocks of lines changed in them, once.
+func (c *Azure) loadDiff(ctx context.Context) (*diff.Diff, error) {
+	if c.diff != nil {
+		return c.diff, nil
+	}
+	iteration, err := c.getLatestIteration(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get pull request iterations: %w", commenter.PrError(err, c.Project+"/"+c.RepoID, c.PrNumber))
+	}
+
+	d := diff.New()
+	var files []fileDiffParams
+	for skip := 0; ; {
+		changes, err := c.getIterationChanges(ctx, iteration.Id, skip)
+		if err != nil {
+			return nil, fmt.Errorf("failed get pull request changes: %w", err)
+		}
+		for _, change := range changes.ChangeEntries {
+			if !strings.Contains(change.ChangeType, "delete") && change.Item.Path != "" {
+				files = append(files, fileDiffParams{Path: change.Item.Path, OriginalPath: change.OriginalPath})
+			}
+		}
+		if changes.NextTop == 0 || changes.NextSkip <= skip {
+			break
+		}
+		skip = changes.NextSkip
+	}
+	if err := c.addLineBlocks(ctx, d, iteration, files); err != nil {
+		return nil, fmt.Errorf("failed get pull request file diffs: %w", err)
+	}
+	c.diff = d
+	return d, nil
+}
+
+// addLineBlocks adds the files with the blocks of lines the iteration changed
+// in them as hunks. Servers without the file diffs API, and iterations without
+// commits, only tell the changed files, any line of them is then accepted.
+func (c *Azure) addLineBlocks(ctx context.Context, d *diff.Diff, iteration Iteration, files []fileDiffParams) error {
+	base, target := iteration.CommonRefCommit.CommitId, iteration.SourceRefCommit.CommitId
+	for start := 0; start < len(files); start += fileDiffsBatch {
+		end := start + fileDiffsBatch
+		if end > len(files) {
+			end = len(files)
+		}
+		var diffs []FileDiff
+		var err error
+		if base != "" && target != "" {
+			diffs, err = c.getFileDiffs(ctx, fileDiffsCriteria{BaseVersionCommit: base, TargetVersionCommit: target, FileDiffParams: files[start:end]})
+		}
+		var statusErr *transport.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			base, target, err = "", "", nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files[start:end] {
+			d.AddFile(strings.TrimPrefix(f.Path, "/"))
+		}
+		for _, f := range diffs {
+			var hunks []diff.Hunk
+			for _, block := range f.LineDiffBlocks {
+				// a block only removing lines has nothing to comment on
+				if block.ModifiedLinesCount > 0 {
+					hunks = append(hunks, diff.Hunk{Start: block.ModifiedLineNumberStart, End: block.ModifiedLineNumberStart + block.ModifiedLinesCount - 1})
+				}
+			}
+			d.AddHunks(strings.TrimPrefix(f.Path, "/"), hunks)
+		}
+	}
+	return nil
+}
+
+func (c *Azure) getFileDiffs(ctx context.Context, criteria fileDiffsCriteria) ([]FileDiff, error) {
+	reqBody, err := json.Marshal(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal body for azure api: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s%s/_apis/git/repositories/%s/filediffs?api-version=7.1",
+		c.ApiUrl, c.Project, c.RepoID), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.getAuthHeaders() {
+		req.Header.Add(key, value)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var diffs FileDiffsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&diffs); err != nil {
+		return nil, fmt.Errorf("failed decoding azure file diffs response with error: %w", err)
+	}
+	return diffs.FileDiffs, nil
+}
+
+func (c *Azure) getLatestIteration(ctx context.Context) (Iteration, error) {
+	resp, err := c.httpClient().Get(ctx, fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/iterations?api-version=6.0",
+		c.ApiUrl, c.Project, c.RepoID, c.PrNumber), c.getAuthHeaders())
+	if err != nil {
+		return Iteration{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var iterations IterationsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&iterations); err != nil {
+		return Iteration{}, fmt.Errorf("failed decoding azure iterations response with error: %w", err)
+	}
+	var latest Iteration
+	for _, iteration := range iterations.Iterations {
+		if iteration.Id > latest.Id {
+			latest = iteration
+		}
+	}
+	if latest.Id == 0 {
+		return Iteration{}, fmt.Errorf("pull request %s has no iteration", c.PrNumber)
+	}
+	return latest, nil
+}
+
+func (c *Azure) getIterationChanges(ctx context.Context, iteration, skip int) (ChangesResponse, error) {
+	resp, err := c.httpClient().Get(ctx, fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%s/iterations/%d/changes?api-version=6.0&$top=2000&$skip=%d",
+		c.ApiUrl, c.Project, c.RepoID, c.PrNumber, iteration, skip), c.getAuthHeaders())
+	if err != nil {
+		return ChangesResponse{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var changes ChangesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return ChangesResponse{}, fmt.Errorf("failed decoding azure changes response with error: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func newFakeAzure(s *fakeserver.Server) *Azure {
+	return &Azure{ApiUrl: s.APIURL(), Project: fakeserver.Project, RepoID: fakeserver.Repo, PrNumber: strconv.Itoa(fakeserver.PRNumber), Token: "token", HTTPClient: s.Client()}
+}
+
+func TestFakeServer_ClosedThreadLeftAlone(t *testing.T) {
+	s := fakeserver.New(fakeserver.Azure)
+	defer s.Close()
+	s.AddThread(fakeserver.Thread{Path: "a.go", Line: 3, Status: "wontFix", Comments: []fakeserver.Comment{
+		{Body: commenter.EmbedFingerprint(aquaBody("old"), "deadbeef")},
+	}})
+
+	results, err := newFakeAzure(s).ReconcileFindings(context.Background(), testMarker, []commenter.Finding{
+		conformance.Finding("a.go", 3, "deadbeef", "new"),
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if results[0].Status != commenter.StatusSkipped {
+		t.Fatalf("expected the finding to be skipped, got %+v", results[0])
+	}
+	if n := s.Writes(); n != 0 {
+		t.Fatalf("expected no writes, got %d", n)
+	}
+}
+
+func TestFakeServer_FindingOutsideTheDiffSkipped(t *testing.T) {
+	s := fakeserver.New(fakeserver.Azure)
+	defer s.Close()
+	s.PageSize = 1
+	s.AddFile("a.go", "@@ -1,5 +1,10 @@\n")
+	s.AddChange(fakeserver.File{Path: "old.go", Status: "removed"})
+	s.AddChange(fakeserver.File{Path: "new.go", Patch: "@@ -0,0 +1,10 @@\n", Status: "added"})
+
+	results, err := commenter.NewRepositoryV2(newFakeAzure(s)).WriteFindings(context.Background(), []commenter.Finding{
+		conformance.Finding("a.go", 3, "deadbeef", "changed line"),
+		conformance.Finding("a.go", 40, "0ddba11", "line of a changed file outside the diff"),
+		conformance.Finding("new.go", 3, "cafebabe", "added file"),
+		conformance.Finding("old.go", 3, "feedface", "removed file"),
+		conformance.Finding("b.go", 3, "abad1dea", "file not changed"),
+	})
+	if err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	want := []commenter.Status{commenter.StatusCreated, commenter.StatusSkipped, commenter.StatusCreated, commenter.StatusSkipped, commenter.StatusSkipped}
+	for i, status := range want {
+		if results[i].Status != status {
+			t.Errorf("finding %d: expected %s, got %+v", i, status, results[i])
+		}
+	}
+	var notInDiff commenter.NotInDiffError
+	if !errors.As(results[1].Err, &notInDiff) || notInDiff.Nearest != 10 {
+		t.Errorf("expected the nearest changed line to be 10, got %+v", results[1].Err)
+	}
+	if n := s.Count(http.MethodGet, "/changes"); n != 3 {
+		t.Fatalf("expected the changes to be loaded once, a page at a time, got %d requests", n)
+	}
+	if n := s.Count(http.MethodPost, "/filediffs"); n != 1 {
+		t.Fatalf("expected the file diffs to be loaded once, got %d requests", n)
+	}
+	if n := len(s.Comments()); n != 2 {
+		t.Fatalf("expected 2 comments, got %d", n)
+	}
+}
+
+func TestFakeServer_WithoutFileDiffsAnyLineOfAChangedFile(t *testing.T) {
+	s := fakeserver.New(fakeserver.Azure)
+	defer s.Close()
+	s.AddFile("a.go", "@@ -1,5 +1,10 @@\n")
+	s.Inject(fakeserver.Fault{Method: http.MethodPost, Path: "/filediffs", Status: http.StatusNotFound})
+
+	c := newFakeAzure(s)
+	if err := c.WriteLineComment("a.go", "body", 40); err != nil {
+		t.Fatalf("expected any line of a changed file to be accepted, got %v", err)
+	}
+	if err := c.WriteLineComment("b.go", "body", 3); !errors.Is(err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected a file not changed to fail with ErrNotInDiff, got %v", err)
+	}
+}
+
+func TestFakeServer_FixedThreadReopenedWhenFindingReturns(t *testing.T) {
+	s := fakeserver.New(fakeserver.Azure)
+	defer s.Close()
+	s.AddFile("a.go", "@@ -1,5 +1,10 @@\n")
+
+	c := newFakeAzure(s)
+	ctx := context.Background()
+	f := conformance.Finding("a.go", 3, "deadbeef", "regression")
+	if _, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{f}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if _, err := c.ReconcileFindings(ctx, testMarker, nil); err != nil {
+		t.Fatalf("fixed run: %v", err)
+	}
+	if th := s.Threads()[0]; th.Status != "fixed" || th.Properties[fingerprintProperty] != "deadbeef" {
+		t.Fatalf("expected the thread to be fixed, got %+v", th)
+	}
+
+	results, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{f})
+	if err != nil {
+		t.Fatalf("regression run: %v", err)
+	}
+	if results[0].Status != commenter.StatusEdited {
+		t.Fatalf("expected the thread to be reopened, got %+v", results[0])
+	}
+	threads := s.Threads()
+	if len(threads) != 1 || threads[0].Status != "active" {
+		t.Fatalf("expected the thread to be active again, got %+v", threads)
+	}
+}
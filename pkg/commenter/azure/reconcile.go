@@ -0,0 +1,221 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+// fingerprintProperty is the thread property holding the finding fingerprint,
+// so it survives edits of the comment body made in the Azure UI.
+const fingerprintProperty = "Aqua.Fingerprint"
+
+// closedByAquaProperty marks the threads resolved as fixed by a run once their
+// finding was no longer reported, they are reopened when it comes back.
+const closedByAquaProperty = "Aqua.ClosedByAqua"
+
+// Threads in these states were dealt with by a reviewer and are left alone,
+// unless a run closed them, see closedByAquaProperty.
+var closedThreadStatuses = []string{"fixed", "wontFix", "closed", "byDesign"}
+
+type aquaThread struct {
+	thread  *Thread
+	comment *Comment
+}
+
+func (c *Azure) ReconcileAquaComments(marker string, current []commenter.Finding) error {
+	results, err := c.ReconcileFindings(context.Background(), marker, current)
+	if err != nil {
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings updates matching Aqua threads in place, opens threads for
+// new findings and marks threads that are no longer current as fixed. Threads
+// marked fixed that way are reopened when their finding is reported again,
+// threads a reviewer closed are never touched.
+func (c *Azure) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	threads, err := c.getThreads(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list threads: %w", err)
+	}
+
+	aqua := selectAquaThreads(threads, marker)
+	existing := make([]commenter.ExistingComment, 0, len(aqua))
+	for _, a := range aqua {
+		existing = append(existing, a.existingComment())
+	}
+	matches, stale := commenter.MatchFindings(current, existing)
+
+	results := make([]commenter.Result, 0, len(current))
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
+		if matches[i] < 0 {
+			results = append(results, c.WriteFinding(ctx, f))
+			continue
+		}
+
+		a := aqua[matches[i]]
+		id := strconv.Itoa(a.thread.Id)
+		if a.isClosed() {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusSkipped, CommentID: id,
+				Reason: fmt.Sprintf("thread is %s", a.thread.Status)})
+			continue
+		}
+		body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+		reopen := a.closedByAqua()
+		unchanged := commenter.Unchanged(a.comment.Content, body)
+		if unchanged && !reopen {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: id, URL: c.threadUrl(a.thread.Id)})
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Edited(f, id).WithBody(body)) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.threadUrl(a.thread.Id)})
+			continue
+		}
+		if reopen {
+			if err := c.updateThreadStatus(ctx, a.thread.Id, "active", false); err != nil {
+				results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+					Err: fmt.Errorf("reopen thread %d: %w", a.thread.Id, err)})
+				continue
+			}
+		}
+		if unchanged {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.threadUrl(a.thread.Id)})
+			continue
+		}
+		if err := c.updateComment(ctx, a.thread.Id, a.comment.Id, body); err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+				Err: fmt.Errorf("update thread %d: %w", a.thread.Id, err)})
+			continue
+		}
+		results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.threadUrl(a.thread.Id)})
+	}
+
+	for _, idx := range stale {
+		a := aqua[idx]
+		if a.isClosed() {
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(a.thread.Id), a.thread.path(), "finding is no longer reported, thread is resolved as fixed")) {
+			continue
+		}
+		if err := c.updateThreadStatus(ctx, a.thread.Id, "fixed", true); err != nil {
+			return results, fmt.Errorf("resolve thread %d: %w", a.thread.Id, err)
+		}
+	}
+	return results, nil
+}
+
+func selectAquaThreads(threads []Thread, marker string) []*aquaThread {
+	out := make([]*aquaThread, 0, len(threads))
+	for i := range threads {
+		t := &threads[i]
+		if t.IsDeleted {
+			continue
+		}
+		for j := range t.Comments {
+			if !t.Comments[j].IsDeleted && strings.Contains(t.Comments[j].Content, marker) {
+				out = append(out, &aquaThread{thread: t, comment: &t.Comments[j]})
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (a *aquaThread) existingComment() commenter.ExistingComment {
+	existing := commenter.ExistingComment{Fingerprint: a.fingerprint()}
+	if tc := a.thread.ThreadContext; tc != nil {
+		existing.Path = strings.TrimPrefix(tc.FilePath, "/")
+		existing.StartLine = tc.RightFileStart.Line
+		existing.EndLine = tc.RightFileEnd.Line
+	}
+	return existing
+}
+
+// The property bag is preferred, the body sentinel covers threads whose
+// properties were lost or never set.
+func (a *aquaThread) fingerprint() string {
+	if p, ok := a.thread.Properties[fingerprintProperty]; ok {
+		if fp, ok := p.Value.(string); ok && fp != "" {
+			return strings.ToLower(fp)
+		}
+	}
+	return commenter.ExtractFingerprint(a.comment.Content)
+}
+
+// isClosed reports a thread closed by a reviewer.
+func (a *aquaThread) isClosed() bool {
+	if a.closedByAqua() {
+		return false
+	}
+	for _, status := range closedThreadStatuses {
+		if strings.EqualFold(a.thread.Status, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// closedByAqua reports a thread a run marked fixed, which no reviewer reopened
+// or closed otherwise since.
+func (a *aquaThread) closedByAqua() bool {
+	if !strings.EqualFold(a.thread.Status, "fixed") {
+		return false
+	}
+	p, ok := a.thread.Properties[closedByAquaProperty]
+	if !ok {
+		return false
+	}
+	value, _ := p.Value.(string)
+	return value == "true"
+}
+
+func (c *Azure) updateComment(ctx context.Context, threadId, commentId int, content string) error {
+	return c.patch(ctx, c.commentApiUrl(threadId, commentId), Comment{Content: content})
+}
+
+// updateThreadStatus sets the status of the thread, and records whether the
+// run closed it, see closedByAquaProperty.
+func (c *Azure) updateThreadStatus(ctx context.Context, threadId int, status string, closedByAqua bool) error {
+	return c.patch(ctx, c.threadApiUrl(threadId), threadUpdate{
+		Status:     status,
+		Properties: Properties{closedByAquaProperty: {Type: "System.String", Value: strconv.FormatBool(closedByAqua)}},
+	})
+}
+
+type threadUpdate struct {
+	Status     string     `json:"status"`
+	Properties Properties `json:"properties"`
+}
+
+func (c *Azure) patch(ctx context.Context, url string, payload interface{}) error {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body for azure api: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth("", c.Token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed update azure thread: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
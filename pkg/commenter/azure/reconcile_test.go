@@ -0,0 +1,239 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+type recorded struct {
+	mu       sync.Mutex
+	edits    []string
+	statuses []string
+	creates  []Body
+	deletes  int
+}
+
+type threadFixture struct {
+	status      string
+	path        string
+	line        int
+	fingerprint string
+	inBodyOnly  bool
+	body        string
+	id          int
+}
+
+func renderThreads(fixtures []threadFixture) ThreadsResponse {
+	var out ThreadsResponse
+	for _, f := range fixtures {
+		body := f.body
+		thread := Thread{
+			Id:     f.id,
+			Status: f.status,
+			ThreadContext: &ThreadContext{
+				FilePath:       "/" + f.path,
+				RightFileStart: LineStruct{Line: f.line, Offset: 1},
+				RightFileEnd:   LineStruct{Line: f.line, Offset: 999},
+			},
+		}
+		if f.fingerprint != "" {
+			if f.inBodyOnly {
+				body = commenter.EmbedFingerprint(body, f.fingerprint)
+			} else {
+				thread.Properties = Properties{fingerprintProperty: {Type: "System.String", Value: f.fingerprint}}
+			}
+		}
+		thread.Comments = []Comment{{Id: 1, Content: body}, {Id: 2, ParentCommentId: 1, Content: "developer reply"}}
+		out.Threads = append(out.Threads, thread)
+	}
+	return out
+}
+
+func newTestAzure(t *testing.T, fixtures []threadFixture) (*Azure, *recorded, func()) {
+	t.Helper()
+	rec := &recorded{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/threads", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(renderThreads(fixtures))
+		case http.MethodPost:
+			var b Body
+			_ = json.NewDecoder(r.Body).Decode(&b)
+			rec.creates = append(rec.creates, b)
+			_, _ = w.Write([]byte(`{"id":55}`))
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/threads/", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		raw, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == http.MethodPatch && strings.Contains(r.URL.Path, "/comments/"):
+			rec.edits = append(rec.edits, r.URL.Path)
+		case r.Method == http.MethodPatch:
+			var payload threadUpdate
+			_ = json.Unmarshal(raw, &payload)
+			rec.statuses = append(rec.statuses, payload.Status)
+		case r.Method == http.MethodDelete:
+			rec.deletes++
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/iterations", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":[{"id":1},{"id":2}]}`))
+	})
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/iterations/2/changes", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"changeEntries":[{"changeType":"edit","item":{"path":"/a.go"}}]}`))
+	})
+
+	ts := httptest.NewServer(mux)
+	c := &Azure{ApiUrl: ts.URL + "/", Project: "project", RepoID: "repo", PrNumber: "7", Token: "x"}
+	return c, rec, ts.Close
+}
+
+func aquaBody(extra string) string {
+	return extra + "\n" + testMarker
+}
+
+func TestReconcile_MatchedByProperty_UpdatesInPlace(t *testing.T) {
+	c, rec, done := newTestAzure(t, []threadFixture{{
+		status: "active", path: "a.go", line: 10, id: 40, fingerprint: "deadbeef", body: aquaBody("old"),
+	}})
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 12, EndLine: 12,
+		Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 1 || len(rec.creates) != 0 || len(rec.statuses) != 0 || rec.deletes != 0 {
+		t.Fatalf("expected one edit, got %+v", rec)
+	}
+	if !strings.HasSuffix(rec.edits[0], "/threads/40/comments/1") {
+		t.Fatalf("expected the aqua comment to be edited, got %s", rec.edits[0])
+	}
+	if results[0].Status != commenter.StatusEdited || results[0].CommentID != "40" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestReconcile_MatchedByBodySentinel(t *testing.T) {
+	c, rec, done := newTestAzure(t, []threadFixture{{
+		status: "active", path: "a.go", line: 10, id: 40, fingerprint: "deadbeef", inBodyOnly: true, body: aquaBody("old"),
+	}})
+	defer done()
+
+	err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 30, EndLine: 30,
+		Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 1 || len(rec.creates) != 0 {
+		t.Fatalf("expected one edit, got %+v", rec)
+	}
+}
+
+func TestReconcile_LegacyThread_MatchedByThreadContext(t *testing.T) {
+	c, rec, done := newTestAzure(t, []threadFixture{{
+		status: "active", path: "a.go", line: 10, id: 40, body: aquaBody("legacy"),
+	}})
+	defer done()
+
+	err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10,
+		Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 1 || len(rec.creates) != 0 {
+		t.Fatalf("expected one edit, got %+v", rec)
+	}
+}
+
+func TestReconcile_ClosedThreadsLeftAlone(t *testing.T) {
+	for _, status := range []string{"fixed", "wontFix", "closed"} {
+		t.Run(status, func(t *testing.T) {
+			c, rec, done := newTestAzure(t, []threadFixture{
+				{status: status, path: "a.go", line: 10, id: 40, fingerprint: "deadbeef", body: aquaBody("kept")},
+				{status: status, path: "b.go", line: 10, id: 41, fingerprint: "cafebabe", body: aquaBody("stale")},
+			})
+			defer done()
+
+			err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+				Path: "a.go", StartLine: 10, EndLine: 10,
+				Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+				Fingerprint: "deadbeef",
+			}})
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+			if len(rec.edits) != 0 || len(rec.creates) != 0 || len(rec.statuses) != 0 || rec.deletes != 0 {
+				t.Fatalf("expected no writes, got %+v", rec)
+			}
+		})
+	}
+}
+
+func TestReconcile_StaleThread_MarkedFixed(t *testing.T) {
+	c, rec, done := newTestAzure(t, []threadFixture{{
+		status: "active", path: "a.go", line: 10, id: 40, fingerprint: "cafebabe", body: aquaBody("gone"),
+	}})
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.statuses) != 1 || rec.statuses[0] != "fixed" || rec.deletes != 0 {
+		t.Fatalf("expected the thread to be marked fixed without deleting, got %+v", rec)
+	}
+}
+
+func TestReconcile_NewFinding_StoresFingerprintProperty(t *testing.T) {
+	c, rec, done := newTestAzure(t, nil)
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10,
+		Body:        commenter.EmbedFingerprint(aquaBody("brand new"), "feedface"),
+		Fingerprint: "feedface",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.creates) != 1 {
+		t.Fatalf("expected one create, got %+v", rec)
+	}
+	if got := rec.creates[0].Properties[fingerprintProperty].Value; got != "feedface" {
+		t.Fatalf("expected fingerprint property, got %v", got)
+	}
+	if results[0].Status != commenter.StatusCreated || results[0].CommentID != "55" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
@@ -0,0 +1,75 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// summaryThreadStatus opens the summary thread as closed, so it doesn't count
+// towards the comment resolution branch policy.
+const summaryThreadStatus = 4
+
+// summaryThread is a thread without file context, which Azure shows on the
+// overview of the PR.
+type summaryThread struct {
+	Comments []Comment `json:"comments"`
+	Status   int       `json:"status"`
+}
+
+// UpsertSummary keeps the summary as a top-level PR thread, the first comment
+// of which is edited in place on later runs.
+func (c *Azure) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	body = commenter.SummaryBody(body, id, fingerprint.Azure)
+
+	threads, err := c.getThreads(ctx)
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("list threads: %w", err)}
+	}
+	thread, comment := findSummary(threads, commenter.SummaryMarker(id, fingerprint.Azure))
+	if thread == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		created, err := c.createThread(ctx, summaryThread{Comments: []Comment{{Content: body}}, Status: summaryThreadStatus})
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("failed write azure summary thread: %w", err)}
+		}
+		return c.summaryResult(created.Id, commenter.StatusCreated)
+	}
+	if comment.Content == body {
+		return c.summaryResult(thread.Id, commenter.StatusUnchanged)
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: strconv.Itoa(thread.Id), Body: body, Reason: "summary"}) {
+		return c.summaryResult(thread.Id, commenter.StatusEdited)
+	}
+	if err := c.updateComment(ctx, thread.Id, comment.Id, body); err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: strconv.Itoa(thread.Id),
+			Err: fmt.Errorf("update thread %d: %w", thread.Id, err)}
+	}
+	return c.summaryResult(thread.Id, commenter.StatusEdited)
+}
+
+// findSummary looks for the marker in the first comment of top-level threads,
+// i.e. threads that aren't anchored to a file.
+func findSummary(threads []Thread, marker string) (*Thread, *Comment) {
+	for i := range threads {
+		t := &threads[i]
+		if t.IsDeleted || t.ThreadContext != nil || len(t.Comments) == 0 {
+			continue
+		}
+		if strings.Contains(t.Comments[0].Content, marker) {
+			return t, &t.Comments[0]
+		}
+	}
+	return nil, nil
+}
+
+func (c *Azure) summaryResult(threadId int, status commenter.Status) commenter.Result {
+	return commenter.Result{Status: status, CommentID: strconv.Itoa(threadId), URL: c.threadUrl(threadId)}
+}
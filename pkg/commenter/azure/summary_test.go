@@ -0,0 +1,74 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func newSummaryAzure(t *testing.T, threads []Thread) (*Azure, *[]string, *[]summaryThread, func()) {
+	t.Helper()
+	var edits []string
+	var creates []summaryThread
+	mux := http.NewServeMux()
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/threads", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(ThreadsResponse{Threads: threads})
+		case http.MethodPost:
+			var b summaryThread
+			_ = json.NewDecoder(r.Body).Decode(&b)
+			creates = append(creates, b)
+			_, _ = w.Write([]byte(`{"id":55}`))
+		}
+	})
+	mux.HandleFunc("/project/_apis/git/repositories/repo/pullRequests/7/threads/", func(w http.ResponseWriter, r *http.Request) {
+		edits = append(edits, r.Method+" "+r.URL.Path)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	ts := httptest.NewServer(mux)
+	c := &Azure{ApiUrl: ts.URL + "/", Project: "project", RepoID: "repo", PrNumber: "7", Token: "x"}
+	return c, &edits, &creates, ts.Close
+}
+
+func TestUpsertSummary_CreatesClosedThread(t *testing.T) {
+	// A file thread that happens to carry the marker is not the summary
+	c, edits, creates, done := newSummaryAzure(t, []Thread{{
+		Id:            3,
+		ThreadContext: &ThreadContext{FilePath: "/a.go"},
+		Comments:      []Comment{{Id: 1, Content: commenter.SummaryBody("totals", "scan", fingerprint.Azure)}},
+	}})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "totals")
+	if result.Status != commenter.StatusCreated || result.CommentID != "55" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*creates) != 1 || (*creates)[0].Status != summaryThreadStatus || len(*edits) != 0 {
+		t.Fatalf("expected one closed thread created, got %+v and edits %v", *creates, *edits)
+	}
+}
+
+func TestUpsertSummary_UpdatesFirstComment(t *testing.T) {
+	c, edits, creates, done := newSummaryAzure(t, []Thread{
+		{Id: 2, Comments: []Comment{{Id: 1, Content: "unrelated"}}},
+		{Id: 8, Comments: []Comment{
+			{Id: 1, Content: commenter.SummaryBody("old totals", "scan", fingerprint.Azure)},
+			{Id: 2, ParentCommentId: 1, Content: "developer reply"},
+		}},
+	})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "new totals")
+	if result.Status != commenter.StatusEdited || result.CommentID != "8" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*creates) != 0 || len(*edits) != 1 || (*edits)[0] != "PATCH /project/_apis/git/repositories/repo/pullRequests/7/threads/8/comments/1" {
+		t.Fatalf("expected the first comment of thread 8 updated, got edits %v", *edits)
+	}
+}
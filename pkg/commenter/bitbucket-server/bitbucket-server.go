@@ -1,6 +1,7 @@
 package bitbucket_server
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 	change_report "github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/change-report"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
 )
 
 const LIMIT = 500
@@ -25,6 +28,8 @@ type BitbucketServer struct {
 	PrNumber     string
 	ApiUrl       string
 	ChangeReport change_report.ChangeReport
+	// HTTPClient sends the requests, transport.Default when nil
+	HTTPClient *transport.Client
 }
 
 type ActivitiesResponse struct {
@@ -39,12 +44,16 @@ type Activity struct {
 	Action        string  `json:"action,omitempty"`
 	CommentAction string  `json:"commentAction,omitempty"`
 	Comment       Comment `json:"comment,omitempty"`
+	CommentAnchor *Anchor `json:"commentAnchor,omitempty"`
 }
 
 type Comment struct {
-	Id      int    `json:"id,omitempty"`
-	Version int    `json:"version,omitempty"`
-	Text    string `json:"text,omitempty"`
+	Id             int       `json:"id,omitempty"`
+	Version        int       `json:"version,omitempty"`
+	Text           string    `json:"text,omitempty"`
+	State          string    `json:"state,omitempty"`
+	ThreadResolved bool      `json:"threadResolved,omitempty"`
+	Comments       []Comment `json:"comments,omitempty"`
 }
 
 type NewComment struct {
@@ -59,6 +68,17 @@ type Anchor struct {
 	Path     string `json:"path"`
 }
 
+// newFileComment is a comment anchored to a file, its anchor has no line which
+// Anchor can't leave out
+type newFileComment struct {
+	Text   string     `json:"text"`
+	Anchor fileAnchor `json:"anchor"`
+}
+
+type fileAnchor struct {
+	Path string `json:"path"`
+}
+
 func NewBitbucketServer(apiUrl, userName, token, prNumber, project, repo, baseRef string) (b *BitbucketServer, err error) {
 	changeReport, err := change_report.GenerateChangeReport(baseRef)
 	fmt.Println("Creating Bitbucket Server client parameters:")
@@ -90,7 +110,46 @@ func (c *BitbucketServer) WriteMultiLineComment(file, comment string, startLine,
 }
 
 func (c *BitbucketServer) WriteLineComment(file, comment string, line int) error {
-	if line == commenter.FIRST_AVAILABLE_LINE || line == 0 {
+	_, err := c.writeLineComment(context.Background(), file, comment, line)
+	return err
+}
+
+// WriteFinding writes the finding as an anchored comment and reports the comment it produced
+func (c *BitbucketServer) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	body := c.findingBody(f)
+	if dryrun.Intercept(ctx, dryrun.Created(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	// In bitbucket we support one line only
+	comment, err := c.writeLineComment(ctx, f.Path, body, f.StartLine)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(comment.Id),
+		URL:       c.getCommentWebUrl(comment.Id),
+	}
+}
+
+// findingBody renders the suggestion of the finding as a suggestion block,
+// which replaces the line the comment is anchored to, when the finding is on a
+// single line the local diff reports as added, as a diff block otherwise.
+func (c *BitbucketServer) findingBody(f commenter.Finding) string {
+	if f.Suggestion == "" {
+		return f.Body
+	}
+	format := commenter.SuggestionDiff
+	startLine, endLine := commenter.NormalizeLines(f.StartLine, f.EndLine)
+	if filechange, ok := c.ChangeReport[f.Path]; ok && startLine == endLine && filechange.AddedLines[startLine] {
+		format = commenter.SuggestionBlock
+	}
+	return commenter.RenderSuggestion(f, format)
+}
+
+func (c *BitbucketServer) writeLineComment(ctx context.Context, file, comment string, line int) (Comment, error) {
+	if line, _ = commenter.NormalizeLines(line, line); line == commenter.FIRST_AVAILABLE_LINE {
 		line = 1
 	}
 
@@ -101,7 +160,7 @@ func (c *BitbucketServer) WriteLineComment(file, comment string, line int) error
 		}
 	}
 
-	b := NewComment{
+	created, err := c.postComment(ctx, NewComment{
 		Test: comment,
 		Anchor: Anchor{
 			Line:     line,
@@ -109,43 +168,80 @@ func (c *BitbucketServer) WriteLineComment(file, comment string, line int) error
 			FileType: "TO",
 			Path:     file,
 		},
+	})
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed write bitbucket line comment: %w", err)
+	}
+	return created, nil
+}
+
+// WriteFileComment writes the finding as a comment anchored to its file
+func (c *BitbucketServer) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	created, err := c.postComment(ctx, newFileComment{Text: body, Anchor: fileAnchor{Path: f.Path}})
+	if err != nil {
+		return commenter.FailedResult(f, fmt.Errorf("failed write bitbucket file comment: %w", err))
+	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(created.Id),
+		URL:       c.getCommentWebUrl(created.Id),
 	}
+}
 
+func (c *BitbucketServer) postComment(ctx context.Context, b interface{}) (Comment, error) {
 	reqBody, err := json.Marshal(b)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body for bitbucket server api: %s", err)
+		return Comment{}, fmt.Errorf("failed to marshal body for bitbucket server api: %s", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", c.getCommentPostUrl(), strings.NewReader(string(reqBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.getCommentPostUrl(), strings.NewReader(string(reqBody)))
 	if err != nil {
-		return err
+		return Comment{}, err
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.SetBasicAuth(c.UserName, c.Token)
 
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return err
+		return Comment{}, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusCreated {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed write bitbucket line comment: %s", string(b))
+	var created Comment
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return Comment{}, fmt.Errorf("failed decoding bitbucket server comment response with error: %w", err)
 	}
+	return created, nil
+}
 
-	return nil
+func (c *BitbucketServer) getIdsToRemove(ctx context.Context, commentsToRemove []Comment, msg string, start int) ([]Comment, error) {
+	activities, err := c.getActivities(ctx, nil, start)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range commentActivities(activities) {
+		for _, comment := range aquaComments(&value.Comment, msg) {
+			commentsToRemove = append(commentsToRemove, *comment)
+		}
+	}
+	return commentsToRemove, nil
 }
 
-func (c *BitbucketServer) getIdsToRemove(commentsToRemove []Comment, msg string, start int) ([]Comment, error) {
+func (c *BitbucketServer) getActivities(ctx context.Context, activities []Activity, start int) ([]Activity, error) {
 	url, err := utils.UrlWithParams(c.getCommentsUrl(), getCommentsParams(start))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create comments url: %w", err)
 	}
 
-	resp, err := utils.GetComments(url, c.getAuthHeaders())
+	resp, err := c.httpClient().Get(ctx, url, c.getAuthHeaders())
 	if err != nil {
-		return nil, fmt.Errorf("failed getting comments with error: %w", err)
+		return nil, fmt.Errorf("failed getting comments with error: %w", commenter.PrError(err, c.Project+"/"+c.Repo, c.PrNumber))
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -159,33 +255,44 @@ func (c *BitbucketServer) getIdsToRemove(commentsToRemove []Comment, msg string,
 	if err != nil {
 		return nil, fmt.Errorf("failed unmarshal response body with error: %w", err)
 	}
-
-	for _, value := range activitiesResponse.Activities {
-		if value.CommentAction == "ADDED" && value.Action == "COMMENTED" && strings.Contains(value.Comment.Text, msg) {
-			commentsToRemove = append(commentsToRemove, value.Comment)
-		}
-	}
+	activities = append(activities, activitiesResponse.Activities...)
 
 	if activitiesResponse.IsLastPage {
-		return commentsToRemove, nil
+		return activities, nil
 	}
-	return c.getIdsToRemove(commentsToRemove, msg, activitiesResponse.NextPageStart)
+	return c.getActivities(ctx, activities, activitiesResponse.NextPageStart)
 
 }
 
 func (c *BitbucketServer) RemovePreviousAquaComments(msg string) error {
+	return c.RemoveAquaComments(context.Background(), msg)
+}
+
+// RemoveAquaComments deletes every pull request comment containing the marker,
+// including replies. Comments that developers replied to are kept, since they
+// can't be deleted without deleting the replies as well.
+func (c *BitbucketServer) RemoveAquaComments(ctx context.Context, msg string) error {
 	var commentsToRemove []Comment
-	commentsToRemove, err := c.getIdsToRemove(commentsToRemove, msg, 0)
+	commentsToRemove, err := c.getIdsToRemove(ctx, commentsToRemove, msg, 0)
 	if err != nil {
 		return err
 	}
 
-	for _, comment := range commentsToRemove {
-		url, _ := utils.UrlWithParams(c.getCommentDeleteUrl(comment.Id), map[string]string{"version": strconv.Itoa(comment.Version)})
-		err := utils.DeleteComments(url, c.getAuthHeaders())
-		if err != nil {
-			fmt.Printf("failed to delete comment with id %d: %s", comment.Id, err)
+	var errs []string
+	for i := range commentsToRemove {
+		comment := &commentsToRemove[i]
+		if hasForeignReplies(comment, msg) {
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(comment.Id), "", "")) {
+			continue
 		}
+		if err := c.deleteComment(ctx, comment); err != nil {
+			errs = append(errs, fmt.Sprintf("comment %d: %s", comment.Id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete bitbucket server comments:\n%s", strings.Join(errs, "\n"))
 	}
 
 	return nil
@@ -195,7 +302,7 @@ func (c *BitbucketServer) getCommentsUrl() string {
 	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%s/activities", c.ApiUrl, c.Project, c.Repo, c.PrNumber)
 }
 
-func (c *BitbucketServer) getCommentDeleteUrl(id int) string {
+func (c *BitbucketServer) getCommentUrl(id int) string {
 	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%s/comments/%d", c.ApiUrl, c.Project, c.Repo, c.PrNumber, id)
 }
 
@@ -203,6 +310,10 @@ func (c *BitbucketServer) getCommentPostUrl() string {
 	return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%s/comments", c.ApiUrl, c.Project, c.Repo, c.PrNumber)
 }
 
+func (c *BitbucketServer) getCommentWebUrl(id int) string {
+	return fmt.Sprintf("%s/projects/%s/repos/%s/pull-requests/%s/overview?commentId=%d", c.ApiUrl, c.Project, c.Repo, c.PrNumber, id)
+}
+
 func (c *BitbucketServer) getAuthHeaders() map[string]string {
 	userToken := []byte(fmt.Sprintf("%s:%s", c.UserName, c.Token))
 	return map[string]string{
@@ -216,3 +327,7 @@ func getCommentsParams(start int) map[string]string {
 		"limit": strconv.Itoa(LIMIT),
 	}
 }
+
+func (c *BitbucketServer) httpClient() *transport.Client {
+	return commenter.HTTPClient(c.HTTPClient)
+}
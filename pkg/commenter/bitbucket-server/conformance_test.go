@@ -0,0 +1,20 @@
+package bitbucket_server
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, conformance.Harness{
+		New: conformance.NewFakeBackend(fakeserver.BitbucketServer),
+		Connect: func(t *testing.T, b conformance.Backend) commenter.Repository {
+			return newFakeBitbucketServer(conformance.Server(b))
+		},
+		// the local git diff, see ChangeReport, only sets the line type of comments
+		NoDiff: true,
+	})
+}
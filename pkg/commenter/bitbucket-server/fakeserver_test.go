@@ -0,0 +1,59 @@
+package bitbucket_server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func newFakeBitbucketServer(s *fakeserver.Server) *BitbucketServer {
+	return &BitbucketServer{
+		ApiUrl:   s.APIURL(),
+		Project:  fakeserver.Project,
+		Repo:     fakeserver.Repo,
+		PrNumber: strconv.Itoa(fakeserver.PRNumber),
+		UserName: "user",
+		Token:    "token",
+
+		HTTPClient: s.Client(),
+	}
+}
+
+func TestFakeServer_StaleThreadWithForeignReplyKept(t *testing.T) {
+	s := fakeserver.New(fakeserver.BitbucketServer)
+	defer s.Close()
+	s.AddThread(fakeserver.Thread{Path: "a.go", Line: 3, Comments: []fakeserver.Comment{
+		{Body: aquaText("deadbeef", "old")},
+		{Body: "this is a false positive"},
+	}})
+
+	if err := newFakeBitbucketServer(s).ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if n := len(s.Comments()); n != 2 {
+		t.Fatalf("expected the discussion to be kept, got %d comments", n)
+	}
+}
+
+func TestFakeServer_UpsertSummary(t *testing.T) {
+	s := fakeserver.New(fakeserver.BitbucketServer)
+	defer s.Close()
+
+	c := newFakeBitbucketServer(s)
+	for i, want := range []commenter.Status{commenter.StatusCreated, commenter.StatusUnchanged, commenter.StatusEdited} {
+		body := "totals"
+		if i == 2 {
+			body = "new totals"
+		}
+		if result := c.UpsertSummary(context.Background(), "scan", body); result.Status != want {
+			t.Fatalf("run %d: expected %s, got %+v", i, want, result)
+		}
+	}
+	if comments := s.Comments(); len(comments) != 1 || !strings.Contains(comments[0].Body, "new totals") {
+		t.Fatalf("unexpected comments %+v", comments)
+	}
+}
@@ -0,0 +1,260 @@
+package bitbucket_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils"
+)
+
+// Bitbucket Server rejects writes carrying a stale comment version with 409,
+// in which case the comment is reloaded and the write retried.
+const versionConflictRetries = 3
+
+type aquaThread struct {
+	root   *Comment
+	top    *Comment
+	anchor *Anchor
+}
+
+type commentUpdate struct {
+	Text    string `json:"text"`
+	Version int    `json:"version"`
+}
+
+func (c *BitbucketServer) ReconcileAquaComments(marker string, current []commenter.Finding) error {
+	results, err := c.ReconcileFindings(context.Background(), marker, current)
+	if err != nil {
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings updates matching Aqua comments in place, creates comments
+// for new findings and deletes Aqua comments in threads that are no longer
+// current. Resolved threads are never touched.
+func (c *BitbucketServer) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	activities, err := c.getActivities(ctx, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list activities: %w", err)
+	}
+
+	aqua := selectAquaThreads(activities, marker)
+	existing := make([]commenter.ExistingComment, 0, len(aqua))
+	for _, a := range aqua {
+		e := commenter.ExistingComment{Fingerprint: commenter.ExtractFingerprint(a.top.Text)}
+		if a.anchor != nil {
+			e.Path = a.anchor.Path
+			e.StartLine = a.anchor.Line
+		}
+		existing = append(existing, e)
+	}
+	matches, stale := commenter.MatchFindings(current, existing)
+
+	results := make([]commenter.Result, 0, len(current))
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
+		if matches[i] < 0 {
+			results = append(results, c.WriteFinding(ctx, f))
+			continue
+		}
+
+		a := aqua[matches[i]]
+		id := strconv.Itoa(a.top.Id)
+		if a.isResolved() {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusSkipped, CommentID: id, Reason: "thread is resolved"})
+			continue
+		}
+		body := c.findingBody(f)
+		if commenter.Unchanged(a.top.Text, body) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: id, URL: c.getCommentWebUrl(a.top.Id)})
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Edited(f, id).WithBody(body)) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.getCommentWebUrl(a.top.Id)})
+			continue
+		}
+		if err := c.updateComment(ctx, a.top, body); err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+				Err: fmt.Errorf("update comment %d: %w", a.top.Id, err)})
+			continue
+		}
+		results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.getCommentWebUrl(a.top.Id)})
+	}
+
+	for _, idx := range stale {
+		a := aqua[idx]
+		if a.isResolved() {
+			continue
+		}
+		for _, comment := range aquaComments(a.root, marker) {
+			if hasForeignReplies(comment, marker) {
+				continue
+			}
+			path := ""
+			if a.anchor != nil {
+				path = a.anchor.Path
+			}
+			if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(comment.Id), path, "finding is no longer reported")) {
+				continue
+			}
+			if err := c.deleteComment(ctx, comment); err != nil {
+				return results, fmt.Errorf("delete comment %d: %w", comment.Id, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+func commentActivities(activities []Activity) []*Activity {
+	var out []*Activity
+	for i := range activities {
+		if activities[i].CommentAction == "ADDED" && activities[i].Action == "COMMENTED" {
+			out = append(out, &activities[i])
+		}
+	}
+	return out
+}
+
+func selectAquaThreads(activities []Activity, marker string) []*aquaThread {
+	var out []*aquaThread
+	for _, activity := range commentActivities(activities) {
+		top := firstAquaComment(&activity.Comment, marker)
+		if top == nil {
+			continue
+		}
+		out = append(out, &aquaThread{root: &activity.Comment, top: top, anchor: activity.CommentAnchor})
+	}
+	return out
+}
+
+func firstAquaComment(comment *Comment, marker string) *Comment {
+	if strings.Contains(comment.Text, marker) {
+		return comment
+	}
+	for i := range comment.Comments {
+		if found := firstAquaComment(&comment.Comments[i], marker); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// aquaComments lists the Aqua comments of a thread, replies before their
+// parents so that a parent is free of Aqua replies by the time it is deleted.
+func aquaComments(comment *Comment, marker string) []*Comment {
+	var out []*Comment
+	for i := range comment.Comments {
+		out = append(out, aquaComments(&comment.Comments[i], marker)...)
+	}
+	if strings.Contains(comment.Text, marker) {
+		out = append(out, comment)
+	}
+	return out
+}
+
+// hasForeignReplies reports whether anyone else replied below the comment.
+// Bitbucket Server can't delete such a comment without losing those replies.
+func hasForeignReplies(comment *Comment, marker string) bool {
+	for i := range comment.Comments {
+		reply := &comment.Comments[i]
+		if !strings.Contains(reply.Text, marker) || hasForeignReplies(reply, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aquaThread) isResolved() bool {
+	return a.root.ThreadResolved || a.root.State == "RESOLVED"
+}
+
+func (c *BitbucketServer) updateComment(ctx context.Context, comment *Comment, text string) error {
+	version := comment.Version
+	for i := 0; i < versionConflictRetries; i++ {
+		reqBody, err := json.Marshal(commentUpdate{Text: text, Version: version})
+		if err != nil {
+			return fmt.Errorf("failed to marshal body for bitbucket server api: %s", err)
+		}
+
+		switch _, err := c.doCommentRequest(ctx, http.MethodPut, c.getCommentUrl(comment.Id), string(reqBody)); {
+		case err == nil:
+			return nil
+		case !isConflict(err):
+			return fmt.Errorf("failed update bitbucket server comment: %w", err)
+		}
+		if version, err = c.getCommentVersion(ctx, comment.Id); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("failed update bitbucket server comment %d: version conflict after %d attempts", comment.Id, versionConflictRetries)
+}
+
+func (c *BitbucketServer) deleteComment(ctx context.Context, comment *Comment) error {
+	version := comment.Version
+	for i := 0; i < versionConflictRetries; i++ {
+		url, err := utils.UrlWithParams(c.getCommentUrl(comment.Id), map[string]string{"version": strconv.Itoa(version)})
+		if err != nil {
+			return err
+		}
+
+		switch _, err := c.doCommentRequest(ctx, http.MethodDelete, url, ""); {
+		case err == nil:
+			return nil
+		case !isConflict(err):
+			return fmt.Errorf("failed delete bitbucket server comment: %w", err)
+		}
+		if version, err = c.getCommentVersion(ctx, comment.Id); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("failed delete bitbucket server comment %d: version conflict after %d attempts", comment.Id, versionConflictRetries)
+}
+
+func (c *BitbucketServer) getCommentVersion(ctx context.Context, id int) (int, error) {
+	resp, err := c.httpClient().Get(ctx, c.getCommentUrl(id), c.getAuthHeaders())
+	if err != nil {
+		return 0, fmt.Errorf("failed get bitbucket server comment: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var comment Comment
+	if err := json.NewDecoder(resp.Body).Decode(&comment); err != nil {
+		return 0, fmt.Errorf("failed decoding bitbucket server comment response with error: %w", err)
+	}
+	return comment.Version, nil
+}
+
+// doCommentRequest sends the comment request and returns the response body.
+func (c *BitbucketServer) doCommentRequest(ctx context.Context, method, url, body string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth(c.UserName, c.Token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return io.ReadAll(resp.Body)
+}
+
+// isConflict tells a request rejected because the comment version is stale.
+func isConflict(err error) bool {
+	var statusErr *transport.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict
+}
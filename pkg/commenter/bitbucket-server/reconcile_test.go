@@ -0,0 +1,182 @@
+package bitbucket_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+type recorded struct {
+	mu       sync.Mutex
+	updates  []commentUpdate
+	deletes  []string
+	creates  int
+	versions map[int]int
+}
+
+func newTestBitbucketServer(t *testing.T, activities []Activity, conflicts int) (*BitbucketServer, *recorded, func()) {
+	t.Helper()
+	rec := &recorded{versions: map[int]int{}}
+	const base = "/rest/api/1.0/projects/PRJ/repos/repo/pull-requests/4"
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(base+"/activities", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ActivitiesResponse{Activities: activities, IsLastPage: true})
+	})
+	mux.HandleFunc(base+"/comments", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.creates++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":500,"version":0}`))
+	})
+	mux.HandleFunc(base+"/comments/", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, base+"/comments/"))
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = fmt.Fprintf(w, `{"id":%d,"version":%d}`, id, rec.versions[id]+5)
+		case http.MethodPut:
+			var u commentUpdate
+			_ = json.NewDecoder(r.Body).Decode(&u)
+			if conflicts > 0 {
+				conflicts--
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			rec.updates = append(rec.updates, u)
+			_, _ = w.Write([]byte(`{}`))
+		case http.MethodDelete:
+			rec.deletes = append(rec.deletes, fmt.Sprintf("%d@%s", id, r.URL.Query().Get("version")))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+
+	ts := httptest.NewServer(mux)
+	c := &BitbucketServer{ApiUrl: ts.URL, Project: "PRJ", Repo: "repo", PrNumber: "4", UserName: "u", Token: "x"}
+	return c, rec, ts.Close
+}
+
+func commented(comment Comment, path string, line int) Activity {
+	return Activity{
+		Action:        "COMMENTED",
+		CommentAction: "ADDED",
+		Comment:       comment,
+		CommentAnchor: &Anchor{Path: path, Line: line, LineType: "ADDED", FileType: "TO"},
+	}
+}
+
+func aquaText(fp, text string) string {
+	return commenter.EmbedFingerprint(text+"\n"+testMarker, fp)
+}
+
+func TestReconcile_MatchedFinding_UpdatesWithVersion(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Version: 3, Text: aquaText("deadbeef", "old")}, "a.go", 10),
+	}, 0)
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{conformance.Finding("a.go", 12, "deadbeef", "new")})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.updates) != 1 || rec.updates[0].Version != 3 || rec.creates != 0 || len(rec.deletes) != 0 {
+		t.Fatalf("expected one update at version 3, got %+v", rec)
+	}
+	if results[0].Status != commenter.StatusEdited || results[0].CommentID != "1" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestReconcile_VersionConflict_RetriesWithFreshVersion(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Version: 3, Text: aquaText("deadbeef", "old")}, "a.go", 10),
+	}, 1)
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, []commenter.Finding{conformance.Finding("a.go", 10, "deadbeef", "new")}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.updates) != 1 || rec.updates[0].Version != 5 {
+		t.Fatalf("expected the retry to use the reloaded version, got %+v", rec.updates)
+	}
+}
+
+func TestReconcile_LegacyComment_MatchedByAnchor(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Text: "legacy\n" + testMarker}, "a.go", 10),
+	}, 0)
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, []commenter.Finding{conformance.Finding("a.go", 10, "deadbeef", "new")}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.updates) != 1 || rec.creates != 0 {
+		t.Fatalf("expected one update, got %+v", rec)
+	}
+}
+
+func TestReconcile_ResolvedThreads_LeftAlone(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, State: "RESOLVED", Text: aquaText("deadbeef", "kept")}, "a.go", 10),
+		commented(Comment{Id: 2, ThreadResolved: true, Text: aquaText("cafebabe", "stale")}, "b.go", 10),
+	}, 0)
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, []commenter.Finding{conformance.Finding("a.go", 10, "deadbeef", "new")}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.updates) != 0 || len(rec.deletes) != 0 || rec.creates != 0 {
+		t.Fatalf("expected no writes, got %+v", rec)
+	}
+}
+
+func TestReconcile_StaleThread_DeletesNestedAquaRepliesFirst(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Version: 1, Text: aquaText("cafebabe", "gone"), Comments: []Comment{
+			{Id: 2, Version: 2, Text: "follow-up\n" + testMarker},
+		}}, "a.go", 10),
+		commented(Comment{Id: 3, Version: 1, Text: aquaText("0ddba11", "gone too"), Comments: []Comment{
+			{Id: 4, Text: "developer reply"},
+		}}, "b.go", 10),
+	}, 0)
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	want := []string{"2@2", "1@1"}
+	if fmt.Sprint(rec.deletes) != fmt.Sprint(want) {
+		t.Fatalf("expected deletes %v, got %v", want, rec.deletes)
+	}
+}
+
+func TestRemoveAquaComments_IncludesReplies(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Text: "developer comment", Comments: []Comment{
+			{Id: 2, Version: 4, Text: "aqua reply\n" + testMarker},
+		}}, "a.go", 10),
+	}, 0)
+	defer done()
+
+	if err := c.RemovePreviousAquaComments(testMarker); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(rec.deletes) != 1 || rec.deletes[0] != "2@4" {
+		t.Fatalf("expected the nested aqua reply to be deleted, got %v", rec.deletes)
+	}
+}
@@ -0,0 +1,87 @@
+package bitbucket_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+type generalComment struct {
+	Text string `json:"text"`
+}
+
+// UpsertSummary keeps the summary as a general pull request comment, edited in
+// place on later runs.
+func (c *BitbucketServer) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	body = commenter.SummaryBody(body, id, fingerprint.BitbucketServer)
+
+	activities, err := c.getActivities(ctx, nil, 0)
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("list activities: %w", err)}
+	}
+	existing := findSummary(activities, commenter.SummaryMarker(id, fingerprint.BitbucketServer))
+	if existing == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		created, err := c.createSummary(ctx, body)
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: err}
+		}
+		return c.summaryResult(created.Id, commenter.StatusCreated)
+	}
+	if existing.Text == body {
+		return c.summaryResult(existing.Id, commenter.StatusUnchanged)
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: strconv.Itoa(existing.Id), Body: body, Reason: "summary"}) {
+		return c.summaryResult(existing.Id, commenter.StatusEdited)
+	}
+	if err := c.updateComment(ctx, existing, body); err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: strconv.Itoa(existing.Id),
+			Err: fmt.Errorf("update comment %d: %w", existing.Id, err)}
+	}
+	return c.summaryResult(existing.Id, commenter.StatusEdited)
+}
+
+// findSummary only looks at the root of general comments, i.e. comments that
+// aren't anchored to a file.
+func findSummary(activities []Activity, marker string) *Comment {
+	for _, activity := range commentActivities(activities) {
+		if activity.CommentAnchor != nil {
+			continue
+		}
+		if strings.Contains(activity.Comment.Text, marker) {
+			return &activity.Comment
+		}
+	}
+	return nil
+}
+
+func (c *BitbucketServer) createSummary(ctx context.Context, text string) (Comment, error) {
+	reqBody, err := json.Marshal(generalComment{Text: text})
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed to marshal body for bitbucket server api: %s", err)
+	}
+
+	body, err := c.doCommentRequest(ctx, http.MethodPost, c.getCommentPostUrl(), string(reqBody))
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed write bitbucket server summary comment: %w", err)
+	}
+
+	var created Comment
+	if err := json.Unmarshal(body, &created); err != nil {
+		return Comment{}, fmt.Errorf("failed decoding bitbucket server comment response with error: %w", err)
+	}
+	return created, nil
+}
+
+func (c *BitbucketServer) summaryResult(id int, status commenter.Status) commenter.Result {
+	return commenter.Result{Status: status, CommentID: strconv.Itoa(id), URL: c.getCommentWebUrl(id)}
+}
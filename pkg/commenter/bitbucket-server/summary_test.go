@@ -0,0 +1,56 @@
+package bitbucket_server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func general(comment Comment) Activity {
+	return Activity{Action: "COMMENTED", CommentAction: "ADDED", Comment: comment}
+}
+
+func TestUpsertSummary_CreatesWhenMissing(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{general(Comment{Id: 1, Text: "unrelated"})}, 0)
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "totals")
+	if result.Status != commenter.StatusCreated || result.CommentID != "500" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 1 {
+		t.Fatalf("expected one create, got %d", rec.creates)
+	}
+}
+
+func TestUpsertSummary_UpdatesWithVersion(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		commented(Comment{Id: 1, Version: 1, Text: commenter.SummaryBody("inline", "scan", fingerprint.BitbucketServer)}, "a.go", 3),
+		general(Comment{Id: 2, Version: 4, Text: commenter.SummaryBody("old totals", "scan", fingerprint.BitbucketServer)}),
+	}, 0)
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "new totals")
+	if result.Status != commenter.StatusEdited || result.CommentID != "2" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 0 || len(rec.updates) != 1 || rec.updates[0].Version != 4 {
+		t.Fatalf("expected comment 2 updated at version 4, got %d creates and updates %+v", rec.creates, rec.updates)
+	}
+}
+
+func TestUpsertSummary_Unchanged(t *testing.T) {
+	c, rec, done := newTestBitbucketServer(t, []Activity{
+		general(Comment{Id: 2, Text: commenter.SummaryBody("totals", "scan", fingerprint.BitbucketServer)}),
+	}, 0)
+	defer done()
+
+	if result := c.UpsertSummary(context.Background(), "scan", "totals"); result.Status != commenter.StatusUnchanged {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 0 || len(rec.updates) != 0 {
+		t.Fatalf("expected no writes, got %d creates and updates %+v", rec.creates, rec.updates)
+	}
+}
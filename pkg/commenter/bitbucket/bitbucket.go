@@ -1,6 +1,7 @@
 package bitbucket
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,9 +11,10 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils"
-
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 )
 
 type Bitbucket struct {
@@ -21,6 +23,10 @@ type Bitbucket struct {
 	Repo     string
 	PrNumber string
 	ApiUrl   string
+	// HTTPClient sends the requests, transport.Default when nil
+	HTTPClient *transport.Client
+
+	diff *diff.Diff
 }
 type CommentsResponse struct {
 	Values []Value `json:"values,omitempty"`
@@ -28,10 +34,30 @@ type CommentsResponse struct {
 }
 
 type Value struct {
-	Id      int     `json:"id,omitempty"`
-	Deleted bool    `json:"deleted,omitempty"`
-	Content Content `json:"content,omitempty"`
-	Inline  Inline  `json:"inline,omitempty"`
+	Id         int         `json:"id,omitempty"`
+	Deleted    bool        `json:"deleted,omitempty"`
+	Content    Content     `json:"content,omitempty"`
+	Inline     Inline      `json:"inline,omitempty"`
+	Links      *Links      `json:"links,omitempty"`
+	Parent     *Parent     `json:"parent,omitempty"`
+	Resolution *Resolution `json:"resolution,omitempty"`
+}
+
+type Parent struct {
+	Id int `json:"id,omitempty"`
+}
+
+// Resolution is only present on comments a user marked as resolved
+type Resolution struct {
+	Type string `json:"type,omitempty"`
+}
+
+type Links struct {
+	Html Link `json:"html,omitempty"`
+}
+
+type Link struct {
+	Href string `json:"href,omitempty"`
 }
 
 type Content struct {
@@ -83,48 +109,124 @@ func (c *Bitbucket) WriteMultiLineComment(file, comment string, startLine, _ int
 
 // WriteLineComment writes a single review line on a file of the bitbucket PR
 func (c *Bitbucket) WriteLineComment(file, comment string, line int) error {
-	if line == commenter.FIRST_AVAILABLE_LINE {
-		line = 1
+	_, err := c.writeLineComment(context.Background(), file, comment, line)
+	return err
+}
+
+// WriteFinding writes the finding as an inline comment and reports the comment it produced
+func (c *Bitbucket) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	// In bitbucket we support one line only
+	if _, err := c.resolveLine(ctx, f.Path, f.StartLine); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	// Bitbucket Cloud can't apply suggestions, they are shown as a diff
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.Created(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	value, err := c.writeLineComment(ctx, f.Path, body, f.StartLine)
+	if err != nil {
+		return commenter.FailedResult(f, err)
 	}
-	b := Value{
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(value.Id),
+		URL:       value.htmlUrl(),
+	}
+}
+
+func (c *Bitbucket) writeLineComment(ctx context.Context, file, comment string, line int) (Value, error) {
+	line, err := c.resolveLine(ctx, file, line)
+	if err != nil {
+		return Value{}, err
+	}
+	created, err := c.postComment(ctx, Value{
 		Content: Content{Raw: comment},
 		Inline: Inline{
 			To:   line,
 			Path: file,
 		},
+	})
+	if err != nil {
+		return Value{}, fmt.Errorf("failed write bitbucket line comment: %w", err)
+	}
+	return created, nil
+}
+
+// WriteFileComment writes the finding as an inline comment without a line,
+// which Bitbucket anchors to the file
+func (c *Bitbucket) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	if err := c.resolveFile(ctx, f.Path); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	value, err := c.postComment(ctx, Value{Content: Content{Raw: body}, Inline: Inline{Path: f.Path}})
+	if err != nil {
+		return commenter.FailedResult(f, fmt.Errorf("failed write bitbucket file comment: %w", err))
 	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(value.Id),
+		URL:       value.htmlUrl(),
+	}
+}
+
+func (c *Bitbucket) postComment(ctx context.Context, b Value) (Value, error) {
 	reqBody, err := json.Marshal(b)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body for bitbucket api: %s", err)
+		return Value{}, fmt.Errorf("failed to marshal body for bitbucket api: %s", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s/pullrequests/%s/comments",
-		c.ApiUrl, c.Repo, c.PrNumber),
-		strings.NewReader(string(reqBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.commentsApiUrl(), strings.NewReader(string(reqBody)))
 	if err != nil {
-		return err
+		return Value{}, err
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.SetBasicAuth(c.UserName, c.Token)
 
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return err
+		return Value{}, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusCreated {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed write bitbucket line comment: %s", string(b))
+	var created Value
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return Value{}, fmt.Errorf("failed decoding bitbucket comment response with error: %w", err)
 	}
+	return created, nil
+}
 
-	return nil
+func (v Value) htmlUrl() string {
+	if v.Links == nil {
+		return ""
+	}
+	return v.Links.Html.Href
+}
+
+func (c *Bitbucket) getIdsToRemove(ctx context.Context, commentIdsToRemove []int, msg string, url string) ([]int, error) {
+	values, err := c.getComments(ctx, nil, url)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		if !value.Deleted && strings.Contains(value.Content.Raw, msg) {
+			commentIdsToRemove = append(commentIdsToRemove, value.Id)
+		}
+	}
+	return commentIdsToRemove, nil
 }
 
-func (c *Bitbucket) getIdsToRemove(commentIdsToRemove []int, msg string, url string) ([]int, error) {
-	resp, err := utils.GetComments(url, map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.UserName+":"+c.Token))})
+func (c *Bitbucket) getComments(ctx context.Context, values []Value, url string) ([]Value, error) {
+	resp, err := c.httpClient().Get(ctx, url, c.getAuthHeaders())
 	if err != nil {
-		return nil, fmt.Errorf("failed getting comments with error: %w", err)
+		return nil, fmt.Errorf("failed getting comments with error: %w", commenter.PrError(err, c.Repo, c.PrNumber))
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -137,42 +239,51 @@ func (c *Bitbucket) getIdsToRemove(commentIdsToRemove []int, msg string, url str
 	if err != nil {
 		return nil, fmt.Errorf("failed unmarshal response body with error: %w", err)
 	}
-
-	for _, value := range commentsResponse.Values {
-		if !value.Deleted && strings.Contains(value.Content.Raw, msg) {
-			commentIdsToRemove = append(commentIdsToRemove, value.Id)
-		}
-	}
+	values = append(values, commentsResponse.Values...)
 
 	if commentsResponse.Next == "" {
-		return commentIdsToRemove, nil
+		return values, nil
 	}
-	return c.getIdsToRemove(commentIdsToRemove, msg, commentsResponse.Next)
+	return c.getComments(ctx, values, commentsResponse.Next)
 
 }
 
 func (c *Bitbucket) RemovePreviousAquaComments(msg string) error {
+	return c.RemoveAquaComments(context.Background(), msg)
+}
+
+// RemoveAquaComments deletes every pull request comment containing the marker
+func (c *Bitbucket) RemoveAquaComments(ctx context.Context, msg string) error {
 	var commentIdsToRemove []int
-	commentIdsToRemove, err := c.getIdsToRemove(commentIdsToRemove,
-		msg, fmt.Sprintf("%s/%s/pullrequests/%s/comments",
-			c.ApiUrl,
-			c.Repo,
-			c.PrNumber))
+	commentIdsToRemove, err := c.getIdsToRemove(ctx, commentIdsToRemove, msg, c.commentsApiUrl())
 	if err != nil {
 		return err
 	}
 
 	for _, commentId := range commentIdsToRemove {
-		err = utils.DeleteComments(
-			fmt.Sprintf("%s/%s/pullrequests/%s/comments/%s",
-				c.ApiUrl,
-				c.Repo,
-				c.PrNumber,
-				strconv.Itoa(commentId)),
-			map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.UserName+":"+c.Token))})
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(commentId), "", "")) {
+			continue
+		}
+		err = c.httpClient().Delete(ctx, c.commentApiUrl(commentId), c.getAuthHeaders())
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func (c *Bitbucket) commentsApiUrl() string {
+	return fmt.Sprintf("%s/%s/pullrequests/%s/comments", c.ApiUrl, c.Repo, c.PrNumber)
+}
+
+func (c *Bitbucket) commentApiUrl(commentId int) string {
+	return fmt.Sprintf("%s/%s/pullrequests/%s/comments/%s", c.ApiUrl, c.Repo, c.PrNumber, strconv.Itoa(commentId))
+}
+
+func (c *Bitbucket) getAuthHeaders() map[string]string {
+	return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.UserName+":"+c.Token))}
+}
+
+func (c *Bitbucket) httpClient() *transport.Client {
+	return commenter.HTTPClient(c.HTTPClient)
+}
@@ -0,0 +1,62 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
+)
+
+// resolveLine validates the line against the diff of the pull request, and
+// resolves FIRST_AVAILABLE_LINE to the first line of the diff of the file.
+func (c *Bitbucket) resolveLine(ctx context.Context, file string, line int) (int, error) {
+	line, _ = commenter.NormalizeLines(line, line)
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return 0, err
+	}
+	line, _, err = d.Resolve(file, line, line)
+	return line, err
+}
+
+// resolveFile validates the file against the diff of the pull request.
+func (c *Bitbucket) resolveFile(ctx context.Context, file string) error {
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return err
+	}
+	if !d.Has(file) {
+		return commenter.NotInDiffError{Path: file}
+	}
+	return nil
+}
+
+// loadDiff gets the diff of the pull request once. Bitbucket redirects to the
+// diff between its commits, served as the output of git diff.
+func (c *Bitbucket) loadDiff(ctx context.Context) (*diff.Diff, error) {
+	if c.diff != nil {
+		return c.diff, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/pullrequests/%s/diff", c.ApiUrl, c.Repo, c.PrNumber), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.getAuthHeaders() {
+		req.Header.Add(key, value)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed get pull request diff: %w", commenter.PrError(err, c.Repo, c.PrNumber))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed read pull request diff: %w", err)
+	}
+	c.diff = diff.ParseUnified(string(body))
+	return c.diff, nil
+}
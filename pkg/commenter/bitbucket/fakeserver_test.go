@@ -0,0 +1,100 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+const fakePatch = "@@ -1,5 +1,10 @@\n a\n+b\n+c\n+d\n+e\n+f\n g\n h\n i\n j\n"
+
+func newFakeBitbucket(s *fakeserver.Server) *Bitbucket {
+	return &Bitbucket{
+		ApiUrl:   s.APIURL(),
+		Repo:     fakeserver.Owner + "/" + fakeserver.Repo,
+		PrNumber: strconv.Itoa(fakeserver.PRNumber),
+		UserName: "user",
+		Token:    "token",
+
+		HTTPClient: s.Client(),
+	}
+}
+
+func TestFakeServer_DeletedCommentNotMatched(t *testing.T) {
+	s := fakeserver.New(fakeserver.Bitbucket)
+	defer s.Close()
+	s.Token = "token"
+	s.PageSize = 1
+	s.AddFile("a.go", fakePatch)
+
+	c := newFakeBitbucket(s)
+	ctx := context.Background()
+	f := conformance.Finding("a.go", 3, "deadbeef", "first")
+	if _, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{f}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if _, err := c.ReconcileFindings(ctx, testMarker, nil); err != nil {
+		t.Fatalf("fixed run: %v", err)
+	}
+
+	// Deleted comments are still listed, flagged, and must not be matched again
+	results, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{f})
+	if err != nil {
+		t.Fatalf("regression run: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be created again, got %+v", results[0])
+	}
+}
+
+func TestFakeServer_UpsertSummary(t *testing.T) {
+	s := fakeserver.New(fakeserver.Bitbucket)
+	defer s.Close()
+
+	c := newFakeBitbucket(s)
+	for i, want := range []commenter.Status{commenter.StatusCreated, commenter.StatusUnchanged, commenter.StatusEdited} {
+		body := "totals"
+		if i == 2 {
+			body = "new totals"
+		}
+		if result := c.UpsertSummary(context.Background(), "scan", body); result.Status != want {
+			t.Fatalf("run %d: expected %s, got %+v", i, want, result)
+		}
+	}
+	if comments := s.Comments(); len(comments) != 1 || !strings.Contains(comments[0].Body, "new totals") {
+		t.Fatalf("unexpected comments %+v", comments)
+	}
+}
+
+func TestFakeServer_DiffThroughRedirect(t *testing.T) {
+	s := fakeserver.New(fakeserver.Bitbucket)
+	defer s.Close()
+	s.Token = "token"
+	s.AddFile("a.go", fakePatch)
+	s.AddChange(fakeserver.File{Path: "old.go", Patch: "@@ -1,3 +0,0 @@\n-a\n-b\n-c\n", Status: "removed"})
+
+	c := newFakeBitbucket(s)
+	if err := c.WriteLineComment("a.go", "body", commenter.FIRST_AVAILABLE_LINE); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	result := c.WriteFinding(context.Background(), conformance.Finding("old.go", 1, "cafebabe", "removed file"))
+	if result.Status != commenter.StatusSkipped || !errors.Is(result.Err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected the finding on the removed file to be skipped as not in diff, got %+v", result)
+	}
+	if n := s.Writes(); n != 1 {
+		t.Fatalf("expected a single write, got %d: %+v", n, s.Requests())
+	}
+	if threads := s.Threads(); len(threads) != 1 || threads[0].Line != 1 {
+		t.Fatalf("expected a comment on the first line of the diff, got %+v", threads)
+	}
+	if n := s.Count(http.MethodGet, "/diff"); n != 2 {
+		t.Fatalf("expected the diff to be loaded once through the redirect, got %d requests", n)
+	}
+}
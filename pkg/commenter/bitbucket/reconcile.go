@@ -0,0 +1,130 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+func (c *Bitbucket) ReconcileAquaComments(marker string, current []commenter.Finding) error {
+	results, err := c.ReconcileFindings(context.Background(), marker, current)
+	if err != nil {
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings edits matching Aqua comments in place, creates comments for
+// new findings and deletes Aqua comments that are no longer current.
+// Resolved comments are never touched.
+func (c *Bitbucket) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	values, err := c.getComments(ctx, nil, c.commentsApiUrl())
+	if err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+
+	aqua := selectAquaComments(values, marker)
+	existing := make([]commenter.ExistingComment, 0, len(aqua))
+	for _, v := range aqua {
+		existing = append(existing, commenter.ExistingComment{
+			Path:        v.Inline.Path,
+			StartLine:   v.Inline.To,
+			Fingerprint: commenter.ExtractFingerprint(v.Content.Raw),
+		})
+	}
+	matches, stale := commenter.MatchFindings(current, existing)
+
+	results := make([]commenter.Result, 0, len(current))
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
+		if matches[i] < 0 {
+			results = append(results, c.WriteFinding(ctx, f))
+			continue
+		}
+
+		v := aqua[matches[i]]
+		id := strconv.Itoa(v.Id)
+		if v.Resolution != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusSkipped, CommentID: id, Reason: "comment is resolved"})
+			continue
+		}
+		body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+		if commenter.Unchanged(v.Content.Raw, body) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: id, URL: v.htmlUrl()})
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Edited(f, id).WithBody(body)) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: v.htmlUrl()})
+			continue
+		}
+		edited, err := c.editComment(ctx, v.Id, body)
+		if err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+				Err: fmt.Errorf("edit comment %d: %w", v.Id, err)})
+			continue
+		}
+		results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: edited.htmlUrl()})
+	}
+
+	for _, idx := range stale {
+		v := aqua[idx]
+		if v.Resolution != nil {
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(v.Id), v.Inline.Path, "finding is no longer reported")) {
+			continue
+		}
+		if err := c.httpClient().Delete(ctx, c.commentApiUrl(v.Id), c.getAuthHeaders()); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// Replies are never selected: they are either developer comments, or Aqua
+// comments that only make sense as part of the thread they belong to.
+func selectAquaComments(values []Value, marker string) []*Value {
+	out := make([]*Value, 0, len(values))
+	for i := range values {
+		v := &values[i]
+		if v.Deleted || v.Parent != nil || !strings.Contains(v.Content.Raw, marker) {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func (c *Bitbucket) editComment(ctx context.Context, commentId int, raw string) (Value, error) {
+	reqBody, err := json.Marshal(map[string]Content{"content": {Raw: raw}})
+	if err != nil {
+		return Value{}, fmt.Errorf("failed to marshal body for bitbucket api: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.commentApiUrl(commentId), strings.NewReader(string(reqBody)))
+	if err != nil {
+		return Value{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth(c.UserName, c.Token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return Value{}, fmt.Errorf("failed edit bitbucket comment: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var edited Value
+	if err := json.NewDecoder(resp.Body).Decode(&edited); err != nil {
+		return Value{}, fmt.Errorf("failed decoding bitbucket comment response with error: %w", err)
+	}
+	return edited, nil
+}
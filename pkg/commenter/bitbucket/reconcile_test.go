@@ -0,0 +1,163 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+type recorded struct {
+	mu      sync.Mutex
+	edits   []string
+	deletes []string
+	creates int
+}
+
+func newTestBitbucket(t *testing.T, pages ...[]Value) (*Bitbucket, *recorded, func()) {
+	t.Helper()
+	rec := &recorded{}
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+
+	mux.HandleFunc("/owner/repo/pullrequests/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			page := 0
+			_, _ = fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+			resp := CommentsResponse{}
+			if page < len(pages) {
+				resp.Values = pages[page]
+			}
+			if page+1 < len(pages) {
+				resp.Next = fmt.Sprintf("%s/owner/repo/pullrequests/3/comments?page=%d", ts.URL, page+1)
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		case http.MethodPost:
+			rec.creates++
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":77,"links":{"html":{"href":"https://bitbucket.org/owner/repo/pull-requests/3#comment-77"}}}`))
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/owner/repo/pullrequests/3/comments/", func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/owner/repo/pullrequests/3/comments/")
+		switch r.Method {
+		case http.MethodPut:
+			rec.edits = append(rec.edits, id)
+			_, _ = w.Write([]byte(`{"id":` + id + `}`))
+		case http.MethodDelete:
+			rec.deletes = append(rec.deletes, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+
+	mux.HandleFunc("/owner/repo/pullrequests/3/diff", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,20 @@\n"))
+	})
+
+	ts = httptest.NewServer(mux)
+	c := &Bitbucket{ApiUrl: ts.URL, Repo: "owner/repo", PrNumber: "3", UserName: "u", Token: "x"}
+	return c, rec, ts.Close
+}
+
+func aquaComment(id int, path string, line int, fp, text string) Value {
+	return Value{
+		Id:      id,
+		Content: Content{Raw: commenter.EmbedFingerprint(text+"\n"+testMarker, fp)},
+		Inline:  Inline{Path: path, To: line},
+	}
+}
+
+func TestReconcile_MatchedFinding_EditsInPlace(t *testing.T) {
+	c, rec, done := newTestBitbucket(t, []Value{aquaComment(10, "a.go", 5, "deadbeef", "old")})
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{conformance.Finding("a.go", 8, "deadbeef", "new")})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 1 || rec.edits[0] != "10" || len(rec.deletes) != 0 || rec.creates != 0 {
+		t.Fatalf("expected one edit of comment 10, got %+v", rec)
+	}
+	if results[0].Status != commenter.StatusEdited || results[0].CommentID != "10" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestReconcile_LegacyComment_MatchedByInlinePathAndTo(t *testing.T) {
+	c, rec, done := newTestBitbucket(t, []Value{aquaComment(10, "a.go", 5, "", "legacy")})
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, []commenter.Finding{conformance.Finding("a.go", 5, "deadbeef", "new")}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 1 || rec.creates != 0 {
+		t.Fatalf("expected one edit, got %+v", rec)
+	}
+}
+
+func TestReconcile_ResolvedComments_LeftAlone(t *testing.T) {
+	kept := aquaComment(10, "a.go", 5, "deadbeef", "kept")
+	kept.Resolution = &Resolution{Type: "comment_resolution"}
+	stale := aquaComment(11, "b.go", 5, "cafebabe", "stale")
+	stale.Resolution = &Resolution{Type: "comment_resolution"}
+	c, rec, done := newTestBitbucket(t, []Value{kept, stale})
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, []commenter.Finding{conformance.Finding("a.go", 5, "deadbeef", "new")}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.edits) != 0 || len(rec.deletes) != 0 || rec.creates != 0 {
+		t.Fatalf("expected no writes, got %+v", rec)
+	}
+}
+
+func TestReconcile_Stale_DeletesOnlyAquaComments(t *testing.T) {
+	reply := Value{Id: 12, Content: Content{Raw: "developer reply"}, Parent: &Parent{Id: 11}, Inline: Inline{Path: "b.go", To: 5}}
+	human := Value{Id: 13, Content: Content{Raw: "unrelated review"}, Inline: Inline{Path: "b.go", To: 9}}
+	c, rec, done := newTestBitbucket(t,
+		[]Value{aquaComment(11, "b.go", 5, "cafebabe", "gone"), reply},
+		[]Value{human},
+	)
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rec.deletes) != 1 || rec.deletes[0] != "11" || len(rec.edits) != 0 {
+		t.Fatalf("expected only comment 11 to be deleted, got %+v", rec)
+	}
+}
+
+func TestReconcile_NewFinding_Created(t *testing.T) {
+	c, rec, done := newTestBitbucket(t, nil)
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{conformance.Finding("a.go", 5, "feedface", "new")})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if rec.creates != 1 {
+		t.Fatalf("expected one create, got %+v", rec)
+	}
+	if results[0].Status != commenter.StatusCreated || results[0].CommentID != "77" || results[0].URL == "" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
@@ -0,0 +1,92 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// UpsertSummary keeps the summary as a general pull request comment, edited in
+// place on later runs.
+func (c *Bitbucket) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	body = commenter.SummaryBody(body, id, fingerprint.Bitbucket)
+
+	values, err := c.getComments(ctx, nil, c.commentsApiUrl())
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("list comments: %w", err)}
+	}
+	existing := findSummary(values, commenter.SummaryMarker(id, fingerprint.Bitbucket))
+	if existing == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		created, err := c.createSummary(ctx, body)
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: err}
+		}
+		return summaryResult(created, commenter.StatusCreated)
+	}
+	if existing.Content.Raw == body {
+		return summaryResult(*existing, commenter.StatusUnchanged)
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: strconv.Itoa(existing.Id), Body: body, Reason: "summary"}) {
+		return summaryResult(*existing, commenter.StatusEdited)
+	}
+	edited, err := c.editComment(ctx, existing.Id, body)
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: strconv.Itoa(existing.Id),
+			Err: fmt.Errorf("edit comment %d: %w", existing.Id, err)}
+	}
+	return summaryResult(edited, commenter.StatusEdited)
+}
+
+// findSummary only looks at general comments, i.e. neither inline comments nor replies.
+func findSummary(values []Value, marker string) *Value {
+	for i := range values {
+		v := &values[i]
+		if v.Deleted || v.Parent != nil || v.Inline.Path != "" {
+			continue
+		}
+		if strings.Contains(v.Content.Raw, marker) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (c *Bitbucket) createSummary(ctx context.Context, raw string) (Value, error) {
+	reqBody, err := json.Marshal(map[string]Content{"content": {Raw: raw}})
+	if err != nil {
+		return Value{}, fmt.Errorf("failed to marshal body for bitbucket api: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.commentsApiUrl(), strings.NewReader(string(reqBody)))
+	if err != nil {
+		return Value{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth(c.UserName, c.Token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return Value{}, fmt.Errorf("failed write bitbucket summary comment: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var created Value
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return Value{}, fmt.Errorf("failed decoding bitbucket comment response with error: %w", err)
+	}
+	return created, nil
+}
+
+func summaryResult(v Value, status commenter.Status) commenter.Result {
+	return commenter.Result{Status: status, CommentID: strconv.Itoa(v.Id), URL: v.htmlUrl()}
+}
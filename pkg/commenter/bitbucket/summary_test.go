@@ -0,0 +1,52 @@
+package bitbucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func TestUpsertSummary_CreatesWhenOnlyInlineCopyExists(t *testing.T) {
+	// An inline comment that happens to carry the marker is not the summary
+	inline := Value{Id: 1, Content: Content{Raw: commenter.SummaryBody("totals", "scan", fingerprint.Bitbucket)}, Inline: Inline{Path: "a.go", To: 3}}
+	c, rec, done := newTestBitbucket(t, []Value{inline})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "totals")
+	if result.Status != commenter.StatusCreated || result.URL == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 1 || len(rec.edits) != 0 {
+		t.Fatalf("expected one create, got %d creates and edits %v", rec.creates, rec.edits)
+	}
+}
+
+func TestUpsertSummary_EditsInPlace(t *testing.T) {
+	c, rec, done := newTestBitbucket(t,
+		[]Value{{Id: 1, Content: Content{Raw: "unrelated"}}},
+		[]Value{{Id: 2, Content: Content{Raw: commenter.SummaryBody("old totals", "scan", fingerprint.Bitbucket)}}},
+	)
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "new totals")
+	if result.Status != commenter.StatusEdited || result.CommentID != "2" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 0 || len(rec.edits) != 1 || rec.edits[0] != "2" {
+		t.Fatalf("expected comment 2 edited, got %d creates and edits %v", rec.creates, rec.edits)
+	}
+}
+
+func TestUpsertSummary_Unchanged(t *testing.T) {
+	c, rec, done := newTestBitbucket(t, []Value{{Id: 2, Content: Content{Raw: commenter.SummaryBody("totals", "scan", fingerprint.Bitbucket)}}})
+	defer done()
+
+	if result := c.UpsertSummary(context.Background(), "scan", "totals"); result.Status != commenter.StatusUnchanged {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rec.creates != 0 || len(rec.edits) != 0 {
+		t.Fatalf("expected no writes, got %d creates and edits %v", rec.creates, rec.edits)
+	}
+}
@@ -11,19 +11,47 @@ type Repository interface {
 
 var FIRST_AVAILABLE_LINE = -1
 
+// DefaultMarker identifies the comments written by Aqua unless another marker
+// is configured.
+const DefaultMarker = "[This comment was created by Aqua Pipeline]"
+
+// NormalizeLines resolves the lines a comment is asked for to the lines every
+// provider writes it on. A startLine of 0 or FIRST_AVAILABLE_LINE asks for the
+// first available line of the file and is returned as FIRST_AVAILABLE_LINE for
+// the provider to resolve, the first line of the diff when it knows the diff
+// and line 1 otherwise. An endLine of 0, FIRST_AVAILABLE_LINE or before
+// startLine makes it a single line comment on startLine.
+func NormalizeLines(startLine, endLine int) (int, int) {
+	if startLine <= 0 {
+		return FIRST_AVAILABLE_LINE, FIRST_AVAILABLE_LINE
+	}
+	if endLine < startLine {
+		endLine = startLine
+	}
+	return startLine, endLine
+}
+
 // Finding is one logical scanner result. Body must already contain both the
-// Aqua marker and the fingerprint sentinel (see EmbedFingerprint), so that
-// reconciliation can identify and match it across runs.
+// Aqua marker and the fingerprint, either as a sentinel (see EmbedFingerprint)
+// or in a metadata block (see fingerprint.Embed), so that reconciliation can
+// identify and match it across runs.
 type Finding struct {
 	Path        string
 	StartLine   int
 	EndLine     int
 	Body        string
 	Fingerprint string
+	// Suggestion is the text replacing the lines StartLine to EndLine when the
+	// author applies the fix, empty when there is none. Providers render it as
+	// a native suggestion when its lines are in a single hunk of the diff and as
+	// a diff block otherwise, see RenderSuggestion.
+	Suggestion string
 }
 
 // Reconciler is an optional capability detected via type assertion; providers
 // that don't implement it fall back to the legacy delete-all + repost path.
+// It only reports whether the run went through, the findings are reported as
+// StatusReconciled; providers reporting per finding implement FindingReconciler.
 type Reconciler interface {
 	ReconcileAquaComments(marker string, current []Finding) error
 }
@@ -0,0 +1,24 @@
+package commenter
+
+import "testing"
+
+func TestNormalizeLines(t *testing.T) {
+	cases := []struct {
+		start, end         int
+		wantStart, wantEnd int
+	}{
+		{start: 3, end: 5, wantStart: 3, wantEnd: 5},
+		{start: 3, end: 3, wantStart: 3, wantEnd: 3},
+		{start: 4, end: 0, wantStart: 4, wantEnd: 4},
+		{start: 6, end: 2, wantStart: 6, wantEnd: 6},
+		{start: 6, end: FIRST_AVAILABLE_LINE, wantStart: 6, wantEnd: 6},
+		{start: 0, end: 0, wantStart: FIRST_AVAILABLE_LINE, wantEnd: FIRST_AVAILABLE_LINE},
+		{start: FIRST_AVAILABLE_LINE, end: 5, wantStart: FIRST_AVAILABLE_LINE, wantEnd: FIRST_AVAILABLE_LINE},
+	}
+	for _, tc := range cases {
+		start, end := NormalizeLines(tc.start, tc.end)
+		if start != tc.wantStart || end != tc.wantEnd {
+			t.Errorf("NormalizeLines(%d, %d) = %d, %d, expected %d, %d", tc.start, tc.end, start, end, tc.wantStart, tc.wantEnd)
+		}
+	}
+}
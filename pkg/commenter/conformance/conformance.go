@@ -0,0 +1,392 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+// Comment is a comment as stored by the backend. Single line comments have
+// StartLine equal to EndLine, comments that aren't anchored to a file have no
+// Path.
+type Comment struct {
+	ID        string
+	Path      string
+	StartLine int
+	EndLine   int
+	Body      string
+	// Resolved is set once the thread of the comment is resolved
+	Resolved bool
+}
+
+// Backend is the fake vendor API the provider under test talks to.
+type Backend interface {
+	// Comments returns the comments on the pull request, in the order they
+	// were created
+	Comments() []Comment
+	// AddComment adds a comment as a reviewer, or an earlier run, would have
+	// and returns its id
+	AddComment(c Comment) string
+	// Resolve resolves the thread of the comment
+	Resolve(id string)
+	// FailWrites makes every write fail with a server error until it is
+	// called with false
+	FailWrites(fail bool)
+}
+
+// Rejecter is implemented by the backends able to answer every write with a
+// given response, to check how the provider maps it onto the commenter errors.
+type Rejecter interface {
+	// RejectWrites answers every write with the status and header until
+	// FailWrites(false) is called
+	RejectWrites(status int, header http.Header)
+}
+
+// Harness plugs a provider into the suite.
+type Harness struct {
+	// New starts a backend holding a pull request that changes files, a map of
+	// path to unified diff. It must be released with t.Cleanup.
+	New func(t *testing.T, files map[string]string) Backend
+	// Connect returns the provider talking to b. Every run of the suite
+	// connects again, as the CLI would.
+	Connect func(t *testing.T, b Backend) commenter.Repository
+	// MultiLine is set for providers that anchor comments to line ranges,
+	// others anchor them to their start line
+	MultiLine bool
+	// NoDiff is set for providers that don't check the file and line of
+	// comments against the diff of the pull request before writing them
+	NoDiff bool
+}
+
+// The pull request of every test changes lines 1 to 12 of main.go.
+var files = map[string]string{
+	"main.go": patch(12),
+}
+
+func patch(lines int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ -1,2 +1,%d @@\n", lines)
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&b, "+line %d\n", i)
+	}
+	return b.String()
+}
+
+// Run checks that the provider behaves as every commenter.Repository must.
+func Run(t *testing.T, h Harness) {
+	t.Run("LineSemantics", func(t *testing.T) { testLineSemantics(t, h) })
+	t.Run("NotInDiff", func(t *testing.T) { testNotInDiff(t, h) })
+	t.Run("RemoveByMarker", func(t *testing.T) { testRemoveByMarker(t, h) })
+	t.Run("RepostIsIdempotent", func(t *testing.T) { testRepostIsIdempotent(t, h) })
+	t.Run("Reconcile", func(t *testing.T) { testReconcile(t, h) })
+	t.Run("ReconcileIsIdempotent", func(t *testing.T) { testReconcileIsIdempotent(t, h) })
+	t.Run("ReconcileLeavesResolvedThreads", func(t *testing.T) { testReconcileLeavesResolvedThreads(t, h) })
+	t.Run("Errors", func(t *testing.T) { testErrors(t, h) })
+}
+
+func body(text string) string {
+	return text + "\n" + commenter.DefaultMarker
+}
+
+// Finding returns a finding on a line of path, its body carrying text, the
+// fingerprint and commenter.DefaultMarker.
+func Finding(path string, line int, fp, text string) commenter.Finding {
+	return commenter.Finding{
+		Path: path, StartLine: line, EndLine: line,
+		Body:        commenter.EmbedFingerprint(body(text), fp),
+		Fingerprint: fp,
+	}
+}
+
+func finding(line int, fp, text string) commenter.Finding {
+	return Finding("main.go", line, fp, text)
+}
+
+// active returns the comments whose thread isn't resolved.
+func active(b Backend) []Comment {
+	var out []Comment
+	for _, c := range b.Comments() {
+		if !c.Resolved {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func withBody(comments []Comment, text string) []Comment {
+	var out []Comment
+	for _, c := range comments {
+		if strings.Contains(c.Body, text) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func testLineSemantics(t *testing.T, h Harness) {
+	multi := func(start, end int) (int, int) {
+		if h.MultiLine {
+			return start, end
+		}
+		return start, start
+	}
+	cases := []struct {
+		name           string
+		write          func(r commenter.Repository) error
+		start, wantEnd int
+	}{
+		{name: "line", write: func(r commenter.Repository) error { return r.WriteLineComment("main.go", body("c"), 3) }, start: 3, wantEnd: 3},
+		{name: "first available line", write: func(r commenter.Repository) error {
+			return r.WriteLineComment("main.go", body("c"), commenter.FIRST_AVAILABLE_LINE)
+		}, start: 1, wantEnd: 1},
+		{name: "zero lines", write: func(r commenter.Repository) error { return r.WriteMultiLineComment("main.go", body("c"), 0, 0) }, start: 1, wantEnd: 1},
+		{name: "range", write: func(r commenter.Repository) error { return r.WriteMultiLineComment("main.go", body("c"), 3, 5) }, start: 3, wantEnd: 5},
+		{name: "zero end line", write: func(r commenter.Repository) error { return r.WriteMultiLineComment("main.go", body("c"), 4, 0) }, start: 4, wantEnd: 4},
+		{name: "end before start", write: func(r commenter.Repository) error { return r.WriteMultiLineComment("main.go", body("c"), 6, 2) }, start: 6, wantEnd: 6},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := h.New(t, files)
+			if err := tc.write(h.Connect(t, b)); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			comments := b.Comments()
+			if len(comments) != 1 {
+				t.Fatalf("expected one comment, got %+v", comments)
+			}
+			start, end := multi(tc.start, tc.wantEnd)
+			if c := comments[0]; c.Path != "main.go" || c.StartLine != start || c.EndLine != end {
+				t.Fatalf("expected a comment on main.go:%d-%d, got %s:%d-%d", start, end, c.Path, c.StartLine, c.EndLine)
+			}
+		})
+	}
+}
+
+func testNotInDiff(t *testing.T, h Harness) {
+	if h.NoDiff {
+		t.Skip("the provider doesn't check comments against the diff")
+	}
+	b := h.New(t, files)
+	r := h.Connect(t, b)
+
+	if err := r.WriteLineComment("other.go", body("c"), 3); !errors.Is(err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected a comment on a file not changed to fail with ErrNotInDiff, got %v", err)
+	}
+	if err := r.WriteLineComment("main.go", body("c"), 40); !errors.Is(err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected a comment on a line outside the hunks to fail with ErrNotInDiff, got %v", err)
+	}
+	results, _ := commenter.NewRepositoryV2(r).WriteFindings(context.Background(), []commenter.Finding{
+		{Path: "other.go", StartLine: 3, EndLine: 3, Body: body("first"), Fingerprint: "deadbeef"},
+		finding(3, "cafebabe", "second"),
+	})
+	if len(results) != 2 || results[0].Status != commenter.StatusSkipped || !errors.Is(results[0].Err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected the finding on a file not changed to be skipped, got %+v", results)
+	}
+	if results[1].Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding in the diff to be written, got %+v", results[1])
+	}
+	if comments := b.Comments(); len(comments) != 1 || comments[0].Path != "main.go" {
+		t.Fatalf("expected a single comment on main.go, got %+v", comments)
+	}
+}
+
+func testRemoveByMarker(t *testing.T, h Harness) {
+	b := h.New(t, files)
+	b.AddComment(Comment{Path: "main.go", StartLine: 2, EndLine: 2, Body: "reviewer comment"})
+	b.AddComment(Comment{Path: "main.go", StartLine: 3, EndLine: 3, Body: body("previous run")})
+	b.AddComment(Comment{Path: "main.go", StartLine: 8, EndLine: 8, Body: body("previous run")})
+
+	for run := 0; run < 2; run++ {
+		if err := h.Connect(t, b).RemovePreviousAquaComments(commenter.DefaultMarker); err != nil {
+			t.Fatalf("run %d: remove: %v", run, err)
+		}
+		if comments := b.Comments(); len(comments) != 1 || comments[0].Body != "reviewer comment" {
+			t.Fatalf("run %d: expected only the reviewer comment left, got %+v", run, comments)
+		}
+	}
+}
+
+func testRepostIsIdempotent(t *testing.T, h Harness) {
+	b := h.New(t, files)
+	for run := 0; run < 2; run++ {
+		r := h.Connect(t, b)
+		if err := r.RemovePreviousAquaComments(commenter.DefaultMarker); err != nil {
+			t.Fatalf("run %d: remove: %v", run, err)
+		}
+		for _, line := range []int{3, 7} {
+			if err := r.WriteLineComment("main.go", body(fmt.Sprintf("finding on %d", line)), line); err != nil {
+				t.Fatalf("run %d: write: %v", run, err)
+			}
+		}
+	}
+	comments := b.Comments()
+	if len(comments) != 2 || len(withBody(comments, "finding on 3")) != 1 || len(withBody(comments, "finding on 7")) != 1 {
+		t.Fatalf("expected one comment per finding, got %+v", comments)
+	}
+}
+
+func reconcile(t *testing.T, h Harness, b Backend, findings ...commenter.Finding) []commenter.Result {
+	t.Helper()
+	results, err := commenter.NewRepositoryV2(h.Connect(t, b)).ReconcileFindings(context.Background(), commenter.DefaultMarker, findings)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(results) != len(findings) {
+		t.Fatalf("expected %d results, got %+v", len(findings), results)
+	}
+	return results
+}
+
+func testReconcile(t *testing.T, h Harness) {
+	b := h.New(t, files)
+	reviewer := b.AddComment(Comment{Path: "main.go", StartLine: 2, EndLine: 2, Body: "reviewer comment"})
+
+	for i, r := range reconcile(t, h, b, finding(3, "deadbeef", "first"), finding(5, "cafebabe", "second")) {
+		if r.Status != commenter.StatusCreated {
+			t.Fatalf("first run, finding %d: expected created, got %+v", i, r)
+		}
+	}
+	first := withBody(b.Comments(), "first")
+	if len(first) != 1 {
+		t.Fatalf("expected one comment for the first finding, got %+v", b.Comments())
+	}
+
+	// The first finding moved and changed, the second is fixed and a third is new
+	results := reconcile(t, h, b, finding(4, "deadbeef", "first, updated"), finding(7, "feedface", "third"))
+	if results[0].Status != commenter.StatusEdited || results[1].Status != commenter.StatusCreated {
+		t.Fatalf("second run: unexpected results %+v", results)
+	}
+
+	comments := active(b)
+	if len(comments) != 3 {
+		t.Fatalf("expected the reviewer comment and two findings, got %+v", comments)
+	}
+	updated := withBody(comments, "first, updated")
+	if len(updated) != 1 {
+		t.Fatalf("expected the first finding to be updated, got %+v", comments)
+	}
+	if _, inPlace := h.Connect(t, b).(commenter.FindingReconciler); inPlace && updated[0].ID != first[0].ID {
+		t.Errorf("expected comment %s to be edited in place, got comment %s", first[0].ID, updated[0].ID)
+	}
+	if len(withBody(comments, "second")) != 0 {
+		t.Errorf("expected the stale comment to be removed or resolved, got %+v", comments)
+	}
+	if len(withBody(comments, "third")) != 1 {
+		t.Errorf("expected a comment for the new finding, got %+v", comments)
+	}
+	if kept := withBody(comments, "reviewer"); len(kept) != 1 || kept[0].ID != reviewer {
+		t.Errorf("expected the reviewer comment to be left alone, got %+v", comments)
+	}
+}
+
+func testReconcileIsIdempotent(t *testing.T, h Harness) {
+	b := h.New(t, files)
+	findings := []commenter.Finding{finding(3, "deadbeef", "first"), finding(5, "cafebabe", "second")}
+	reconcile(t, h, b, findings...)
+	before := b.Comments()
+
+	for i, r := range reconcile(t, h, b, findings...) {
+		if r.Status != commenter.StatusUnchanged {
+			t.Errorf("finding %d: expected unchanged, got %+v", i, r)
+		}
+	}
+	if after := b.Comments(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("expected the comments to be left as they were\nbefore %+v\nafter  %+v", before, after)
+	}
+}
+
+func testReconcileLeavesResolvedThreads(t *testing.T, h Harness) {
+	b := h.New(t, files)
+	id := b.AddComment(Comment{Path: "main.go", StartLine: 3, EndLine: 3, Body: finding(3, "deadbeef", "old").Body})
+	b.Resolve(id)
+
+	results := reconcile(t, h, b, finding(3, "deadbeef", "new"))
+	if results[0].Status != commenter.StatusSkipped {
+		t.Fatalf("expected the finding of a resolved thread to be skipped, got %+v", results[0])
+	}
+	reconcile(t, h, b)
+	comments := b.Comments()
+	if len(comments) != 1 || comments[0].ID != id || !strings.Contains(comments[0].Body, "old") {
+		t.Fatalf("expected the resolved comment to be left as it was, got %+v", comments)
+	}
+}
+
+func testErrors(t *testing.T, h Harness) {
+	t.Run("canceled context", func(t *testing.T) {
+		b := h.New(t, files)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, _ := commenter.NewRepositoryV2(h.Connect(t, b)).WriteFindings(ctx, []commenter.Finding{finding(3, "deadbeef", "first")})
+		if len(results) != 1 || results[0].Status != commenter.StatusFailed || !errors.Is(results[0].Err, context.Canceled) {
+			t.Fatalf("expected the finding to fail with context.Canceled, got %+v", results)
+		}
+		if comments := b.Comments(); len(comments) != 0 {
+			t.Fatalf("expected no comments, got %+v", comments)
+		}
+	})
+
+	t.Run("server errors", func(t *testing.T) {
+		b := h.New(t, files)
+		r := h.Connect(t, b)
+		b.FailWrites(true)
+
+		if err := r.WriteLineComment("main.go", body("first"), 3); err == nil {
+			t.Error("expected WriteLineComment to fail")
+		}
+		results, _ := commenter.NewRepositoryV2(r).ReconcileFindings(context.Background(), commenter.DefaultMarker, []commenter.Finding{finding(5, "cafebabe", "second")})
+		if len(results) != 1 || results[0].Status != commenter.StatusFailed || results[0].Err == nil {
+			t.Errorf("expected the finding to fail, got %+v", results)
+		}
+		if commenter.FirstError(results) == nil {
+			t.Error("expected FirstError to report the failure")
+		}
+		if comments := b.Comments(); len(comments) != 0 {
+			t.Fatalf("expected no comments, got %+v", comments)
+		}
+	})
+
+	t.Run("taxonomy", func(t *testing.T) { testErrorTaxonomy(t, h) })
+}
+
+func testErrorTaxonomy(t *testing.T, h Harness) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		header http.Header
+		want   error
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, want: commenter.ErrUnauthorized},
+		{name: "conflict", status: http.StatusConflict, want: commenter.ErrConflict},
+		{name: "body too large", status: http.StatusRequestEntityTooLarge, want: commenter.ErrBodyTooLarge},
+		{name: "rate limited", status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"3600"}}, want: commenter.ErrRateLimited},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := h.New(t, files)
+			rejecter, ok := b.(Rejecter)
+			if !ok {
+				t.Skip("the backend can't reject writes with a given status")
+			}
+			r := h.Connect(t, b)
+			rejecter.RejectWrites(tc.status, tc.header)
+
+			if err := r.WriteLineComment("main.go", body("first"), 3); !errors.Is(err, tc.want) {
+				t.Errorf("expected WriteLineComment to fail with %v, got %v", tc.want, err)
+			}
+			results, _ := commenter.NewRepositoryV2(r).WriteFindings(context.Background(), []commenter.Finding{finding(5, "cafebabe", "second")})
+			if len(results) != 1 || results[0].Status != commenter.StatusFailed || !errors.Is(results[0].Err, tc.want) {
+				t.Fatalf("expected the finding to fail with %v, got %+v", tc.want, results)
+			}
+			var rateErr commenter.RateLimitError
+			if tc.want == commenter.ErrRateLimited && (!errors.As(results[0].Err, &rateErr) || rateErr.RetryAfter != time.Hour) {
+				t.Errorf("expected the wait asked for to be reported, got %v", results[0].Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package conformance
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+// FakeBackend runs the suite against a fakeserver.Server.
+type FakeBackend struct {
+	*fakeserver.Server
+}
+
+// NewFakeBackend returns the Harness.New of a provider of the vendor.
+func NewFakeBackend(vendor fakeserver.Vendor) func(t *testing.T, files map[string]string) Backend {
+	return func(t *testing.T, files map[string]string) Backend {
+		s := fakeserver.New(vendor)
+		t.Cleanup(s.Close)
+		for path, patch := range files {
+			s.AddFile(path, patch)
+		}
+		return &FakeBackend{Server: s}
+	}
+}
+
+// Server returns the fake behind b, which must come from NewFakeBackend.
+func Server(b Backend) *fakeserver.Server {
+	return b.(*FakeBackend).Server
+}
+
+func (b *FakeBackend) Comments() []Comment {
+	var out []Comment
+	for _, t := range b.Threads() {
+		startLine := t.StartLine
+		if startLine == 0 {
+			startLine = t.Line
+		}
+		for _, c := range t.Comments {
+			if c.Deleted {
+				continue
+			}
+			out = append(out, Comment{
+				ID:        strconv.Itoa(c.ID),
+				Path:      t.Path,
+				StartLine: startLine,
+				EndLine:   t.Line,
+				Body:      c.Body,
+				Resolved:  t.Resolved,
+			})
+		}
+	}
+	return out
+}
+
+func (b *FakeBackend) AddComment(c Comment) string {
+	t := b.AddThread(fakeserver.Thread{
+		Path:      c.Path,
+		StartLine: c.StartLine,
+		Line:      c.EndLine,
+		Resolved:  c.Resolved,
+		Comments:  []fakeserver.Comment{{Body: c.Body}},
+	})
+	return strconv.Itoa(t.Comments[0].ID)
+}
+
+func (b *FakeBackend) Resolve(id string) {
+	for _, t := range b.Threads() {
+		for _, c := range t.Comments {
+			if strconv.Itoa(c.ID) == id {
+				b.Server.Resolve(t.ID)
+				return
+			}
+		}
+	}
+}
+
+func (b *FakeBackend) FailWrites(fail bool) {
+	b.ClearFaults()
+	if fail {
+		b.Inject(fakeserver.Fault{Writes: true, Status: http.StatusInternalServerError, Body: `{"message":"Internal Server Error"}`})
+	}
+}
+
+func (b *FakeBackend) RejectWrites(status int, header http.Header) {
+	b.ClearFaults()
+	b.Inject(fakeserver.Fault{Writes: true, Status: status, Header: header})
+}
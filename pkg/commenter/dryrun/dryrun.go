@@ -0,0 +1,150 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+// Action is what a run would have done to a comment.
+type Action string
+
+const (
+	Create Action = "create"
+	Edit   Action = "edit"
+	Delete Action = "delete"
+	Skip   Action = "skip"
+)
+
+// Entry is one intercepted write, or a finding that wasn't written.
+type Entry struct {
+	Action    Action `json:"action"`
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	CommentID string `json:"comment_id,omitempty"`
+	// Body is the fully rendered comment, as it would have been sent
+	Body   string `json:"body,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plan collects the entries of a dry run. It is safe for concurrent use.
+type Plan struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+type planKey struct{}
+
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// WithPlan returns a context under which providers record their writes in
+// plan instead of sending them.
+func WithPlan(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// FromContext returns the plan of a dry run, or nil when writes are for real.
+func FromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planKey{}).(*Plan)
+	return plan
+}
+
+// Intercept records e when ctx is a dry run, in which case the caller must
+// not send the write.
+func Intercept(ctx context.Context, e Entry) bool {
+	plan := FromContext(ctx)
+	if plan == nil {
+		return false
+	}
+	plan.Add(e)
+	return true
+}
+
+// Created is the entry of a comment written for f.
+func Created(f commenter.Finding) Entry {
+	return Entry{Action: Create, Path: f.Path, StartLine: f.StartLine, EndLine: f.EndLine, Body: f.Body}
+}
+
+// FileCreated is the entry of a comment written for f on its file rather than
+// on its lines.
+func FileCreated(f commenter.Finding) Entry {
+	return Entry{Action: Create, Path: f.Path, Body: f.Body}
+}
+
+// Edited is the entry of the comment id updated to the body of f.
+func Edited(f commenter.Finding, id string) Entry {
+	e := Created(f)
+	e.Action = Edit
+	e.CommentID = id
+	return e
+}
+
+// WithBody returns the entry with the body rendered by the provider, e.g.
+// with the suggestion of the finding.
+func (e Entry) WithBody(body string) Entry {
+	e.Body = body
+	return e
+}
+
+// Deleted is the entry of a removed comment, path may be empty for comments
+// that aren't anchored to a file.
+func Deleted(id, path, reason string) Entry {
+	return Entry{Action: Delete, CommentID: id, Path: path, Reason: reason}
+}
+
+func (p *Plan) Add(e Entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = append(p.entries, e)
+}
+
+// AddResults records the findings the run didn't write, i.e. skipped ones and
+// ones whose comment is already up to date.
+func (p *Plan) AddResults(results []commenter.Result) {
+	for _, r := range results {
+		reason := r.Reason
+		switch r.Status {
+		case commenter.StatusSkipped:
+		case commenter.StatusUnchanged:
+			reason = "comment is unchanged"
+		case commenter.StatusFailed:
+			reason = r.Err.Error()
+		default:
+			continue
+		}
+		e := Created(r.Finding)
+		e.Action = Skip
+		e.CommentID = r.CommentID
+		e.Reason = reason
+		p.Add(e)
+	}
+}
+
+func (p *Plan) Entries() []Entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Entry(nil), p.entries...)
+}
+
+// WriteJSON writes the plan with the number of entries per action.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	entries := p.Entries()
+	summary := make(map[Action]int)
+	for _, e := range entries {
+		summary[e.Action]++
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// Bodies are read in CI logs, where escaped markup is unreadable
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		Summary map[Action]int `json:"summary"`
+		Entries []Entry        `json:"entries"`
+	}{Summary: summary, Entries: entries})
+}
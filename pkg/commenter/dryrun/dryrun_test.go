@@ -0,0 +1,98 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+func TestIntercept_WithoutPlan_LetsWritesThrough(t *testing.T) {
+	if Intercept(context.Background(), Entry{Action: Create}) {
+		t.Fatal("expected writes outside a dry run to be sent")
+	}
+}
+
+func TestIntercept_RecordsEntries(t *testing.T) {
+	plan := NewPlan()
+	ctx := WithPlan(context.Background(), plan)
+	f := commenter.Finding{Path: "a.go", StartLine: 3, EndLine: 4, Body: "body"}
+
+	if !Intercept(ctx, Created(f)) || !Intercept(ctx, Edited(f, "7")) || !Intercept(ctx, Deleted("8", "b.go", "gone")) {
+		t.Fatal("expected every write to be intercepted")
+	}
+
+	entries := plan.Entries()
+	want := []Entry{
+		{Action: Create, Path: "a.go", StartLine: 3, EndLine: 4, Body: "body"},
+		{Action: Edit, Path: "a.go", StartLine: 3, EndLine: 4, Body: "body", CommentID: "7"},
+		{Action: Delete, Path: "b.go", CommentID: "8", Reason: "gone"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entries[i])
+		}
+	}
+}
+
+func TestAddResults_RecordsFindingsNotWritten(t *testing.T) {
+	plan := NewPlan()
+	plan.AddResults([]commenter.Result{
+		{Finding: commenter.Finding{Path: "a.go"}, Status: commenter.StatusCreated},
+		{Finding: commenter.Finding{Path: "b.go", StartLine: 40}, Status: commenter.StatusSkipped, Reason: "line 40 not in diff hunk"},
+		{Finding: commenter.Finding{Path: "c.go"}, Status: commenter.StatusUnchanged, CommentID: "5"},
+		{Finding: commenter.Finding{Path: "d.go"}, Status: commenter.StatusFailed, Err: errors.New("boom")},
+	})
+
+	entries := plan.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 skip entries, got %+v", entries)
+	}
+	for _, e := range entries {
+		if e.Action != Skip {
+			t.Errorf("expected skip, got %+v", e)
+		}
+	}
+	if entries[0].Reason != "line 40 not in diff hunk" || entries[0].StartLine != 40 {
+		t.Errorf("unexpected skipped entry %+v", entries[0])
+	}
+	if entries[1].Reason != "comment is unchanged" || entries[1].CommentID != "5" {
+		t.Errorf("unexpected unchanged entry %+v", entries[1])
+	}
+	if entries[2].Reason != "boom" {
+		t.Errorf("unexpected failed entry %+v", entries[2])
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	plan := NewPlan()
+	plan.Add(Entry{Action: Create, Path: "a.go", Body: "<!-- meta -->"})
+	plan.Add(Entry{Action: Create, Path: "b.go"})
+	plan.Add(Entry{Action: Delete, CommentID: "1"})
+
+	var buf bytes.Buffer
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<!-- meta -->") {
+		t.Errorf("expected the body unescaped, got %s", buf.String())
+	}
+
+	var got struct {
+		Summary map[Action]int `json:"summary"`
+		Entries []Entry        `json:"entries"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Summary[Create] != 2 || got.Summary[Delete] != 1 || len(got.Entries) != 3 {
+		t.Errorf("unexpected plan %+v", got)
+	}
+}
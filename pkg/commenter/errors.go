@@ -0,0 +1,190 @@
+package commenter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+)
+
+// The failures every provider maps the responses of its API onto, match them
+// with errors.Is. The typed errors below carry their details, see errors.As.
+var (
+	// ErrUnauthorized the credentials were refused or lack a permission
+	ErrUnauthorized = errors.New("authentication failed")
+	// ErrPrNotFound the pull request doesn't exist, or the credentials can't see it
+	ErrPrNotFound = errors.New("pull request not found")
+	// ErrNotInDiff the file or line isn't changed by the pull request
+	ErrNotInDiff = errors.New("line is not in the pull request diff")
+	// ErrRateLimited the provider kept refusing requests over its rate limit
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrConflict the comment was changed since it was read
+	ErrConflict = errors.New("comment was changed concurrently")
+	// ErrBodyTooLarge the comment is longer than the provider accepts
+	ErrBodyTooLarge = errors.New("comment body is too large")
+)
+
+// NotInDiffError is returned for a comment on a file or line the pull request
+// doesn't change.
+type NotInDiffError struct {
+	Path string
+	Line int
+	// Nearest is the line of the file in the diff closest to Line, 0 when the
+	// pull request doesn't change the file or the provider can't tell
+	Nearest int
+	// Err is the response of the provider, nil when the diff was checked beforehand
+	Err error
+}
+
+func (e NotInDiffError) Error() string {
+	return fmt.Sprintf("There is nothing to comment on at line [%d] in file [%s]", e.Line, e.Path)
+}
+
+func (e NotInDiffError) Is(target error) bool {
+	return target == ErrNotInDiff
+}
+
+func (e NotInDiffError) Unwrap() error {
+	return e.Err
+}
+
+// PrNotFoundError is returned when the pull request can't be found.
+type PrNotFoundError struct {
+	Repo     string
+	PrNumber string
+	Err      error
+}
+
+func (e PrNotFoundError) Error() string {
+	return fmt.Sprintf("PR number [%s] not found for %s", e.PrNumber, e.Repo)
+}
+
+func (e PrNotFoundError) Is(target error) bool {
+	return target == ErrPrNotFound
+}
+
+func (e PrNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitError is returned once the transport gave up on waiting for the
+// rate limit to be lifted.
+type RateLimitError struct {
+	// RetryAfter is the wait the provider asked for, 0 when it didn't say
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e RateLimitError) Error() string {
+	msg := ErrRateLimited.Error()
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func (e RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is a rejected request mapped onto one of the sentinel errors, Kind.
+type APIError struct {
+	Kind       error
+	StatusCode int
+	Err        error
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e APIError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e APIError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseError maps err, reporting a response the provider rejected a
+// request with, onto the sentinel errors by its status and message. Statuses
+// whose meaning depends on the request, like a 404 or a 400, are returned as
+// is for the provider to map.
+func ResponseError(err error, statusCode int, header http.Header, message string) error {
+	if transport.RateLimited(statusCode, header) {
+		return RateLimitError{RetryAfter: transport.RetryAfter(header, time.Now()), Err: err}
+	}
+
+	var kind error
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = ErrUnauthorized
+	case http.StatusConflict:
+		kind = ErrConflict
+	case http.StatusRequestEntityTooLarge:
+		kind = ErrBodyTooLarge
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		message = strings.ToLower(message)
+		if strings.Contains(message, "too long") || strings.Contains(message, "too large") {
+			kind = ErrBodyTooLarge
+		}
+	}
+	if kind == nil {
+		return err
+	}
+	return APIError{Kind: kind, StatusCode: statusCode, Err: err}
+}
+
+// HTTPError maps a *transport.StatusError with ResponseError, any other
+// error is returned as is.
+func HTTPError(err error) error {
+	var statusErr *transport.StatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+	return ResponseError(err, statusErr.StatusCode, statusErr.Header, statusErr.Body)
+}
+
+// HTTPClient returns client, or transport.Default when nil, with its errors
+// mapped by HTTPError.
+func HTTPClient(client *transport.Client) *transport.Client {
+	if client == nil {
+		client = transport.Default
+	}
+	mapped := *client
+	mapped.MapError = HTTPError
+	return &mapped
+}
+
+// PrError maps the error of a request on the pull request itself, for which a
+// 404 means the pull request doesn't exist.
+func PrError(err error, repo, prNumber string) error {
+	var statusErr *transport.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return PrNotFoundError{Repo: repo, PrNumber: prNumber, Err: err}
+	}
+	return err
+}
+
+// FailedResult is the result of a finding that couldn't be written, skipped
+// when it is outside the diff and failed otherwise.
+func FailedResult(f Finding, err error) Result {
+	var notInDiff NotInDiffError
+	switch {
+	case errors.As(err, &notInDiff):
+		return Result{Finding: f, Status: StatusSkipped, Reason: notInDiff.Error(), Err: err}
+	case errors.Is(err, ErrNotInDiff):
+		return Result{Finding: f, Status: StatusSkipped, Reason: ErrNotInDiff.Error(), Err: err}
+	}
+	return Result{Finding: f, Status: StatusFailed, Err: err}
+}
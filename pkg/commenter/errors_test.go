@@ -0,0 +1,93 @@
+package commenter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+)
+
+func TestResponseError(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		message    string
+		want       error
+	}{
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, want: ErrUnauthorized},
+		{name: "forbidden", statusCode: http.StatusForbidden, want: ErrUnauthorized},
+		{name: "secondary rate limit", statusCode: http.StatusForbidden, header: http.Header{"Retry-After": {"60"}}, want: ErrRateLimited},
+		{name: "rate limit exhausted", statusCode: http.StatusForbidden, header: http.Header{"X-Ratelimit-Remaining": {"0"}}, want: ErrRateLimited},
+		{name: "too many requests", statusCode: http.StatusTooManyRequests, want: ErrRateLimited},
+		{name: "conflict", statusCode: http.StatusConflict, want: ErrConflict},
+		{name: "entity too large", statusCode: http.StatusRequestEntityTooLarge, want: ErrBodyTooLarge},
+		{name: "body too long", statusCode: http.StatusUnprocessableEntity, message: "Body is too long (maximum is 65536 characters)", want: ErrBodyTooLarge},
+		{name: "other validation", statusCode: http.StatusUnprocessableEntity, message: "Validation Failed"},
+		{name: "not found", statusCode: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cause := fmt.Errorf("status %d", tc.statusCode)
+			err := ResponseError(cause, tc.statusCode, tc.header, tc.message)
+			if tc.want == nil {
+				if err != cause {
+					t.Fatalf("expected the error to be returned as is, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) || !errors.Is(err, cause) {
+				t.Fatalf("expected %v wrapping the cause, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestResponseError_RetryAfter(t *testing.T) {
+	err := ResponseError(errors.New("429"), http.StatusTooManyRequests, http.Header{"Retry-After": {"90"}}, "")
+	var rateErr RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.RetryAfter != 90*time.Second {
+		t.Fatalf("expected a RateLimitError retrying after 90s, got %v", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	statusErr := &transport.StatusError{Method: http.MethodPost, URL: "https://example.com", StatusCode: http.StatusBadRequest, Body: "Note is too long"}
+	if err := HTTPError(fmt.Errorf("write: %w", statusErr)); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected ErrBodyTooLarge, got %v", err)
+	}
+	other := errors.New("connection refused")
+	if err := HTTPError(other); err != other {
+		t.Fatalf("expected the error to be returned as is, got %v", err)
+	}
+}
+
+func TestPrError(t *testing.T) {
+	notFound := &transport.StatusError{Method: http.MethodGet, URL: "https://example.com", StatusCode: http.StatusNotFound}
+	err := PrError(notFound, "owner/repo", "7")
+	var prErr PrNotFoundError
+	if !errors.Is(err, ErrPrNotFound) || !errors.As(err, &prErr) || prErr.PrNumber != "7" || prErr.Repo != "owner/repo" {
+		t.Fatalf("expected a PrNotFoundError, got %v", err)
+	}
+	if !errors.Is(err, notFound) {
+		t.Fatal("expected the response to be wrapped")
+	}
+
+	unauthorized := &transport.StatusError{Method: http.MethodGet, URL: "https://example.com", StatusCode: http.StatusUnauthorized}
+	if err := PrError(unauthorized, "owner/repo", "7"); errors.Is(err, ErrPrNotFound) {
+		t.Fatalf("expected only a 404 to be mapped, got %v", err)
+	}
+}
+
+func TestFailedResult(t *testing.T) {
+	f := Finding{Path: "a.go", StartLine: 40, EndLine: 40}
+	if r := FailedResult(f, fmt.Errorf("write: %w", NotInDiffError{Path: "a.go", Line: 40})); r.Status != StatusSkipped || r.Reason == "" {
+		t.Fatalf("expected a line outside the diff to be skipped, got %+v", r)
+	}
+	if r := FailedResult(f, APIError{Kind: ErrConflict, StatusCode: http.StatusConflict, Err: errors.New("409")}); r.Status != StatusFailed {
+		t.Fatalf("expected the finding to fail, got %+v", r)
+	}
+}
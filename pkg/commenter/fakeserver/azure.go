@@ -0,0 +1,368 @@
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const azurePR = `^/([^/]+)/_apis/git/repositories/([^/]+)/pullRequests/(\d+)`
+
+// azureStatuses are the thread statuses by their numeric value.
+var azureStatuses = []string{"unknown", "active", "fixed", "wontFix", "closed", "byDesign", "pending"}
+
+func (s *Server) azureRoutes() []route {
+	return []route{
+		{http.MethodGet, regexp.MustCompile(azurePR + `/iterations$`), s.azureListIterations},
+		{http.MethodGet, regexp.MustCompile(azurePR + `/iterations/(\d+)/changes$`), s.azureIterationChanges},
+		{http.MethodPost, regexp.MustCompile(`^/([^/]+)/_apis/git/repositories/([^/]+)/filediffs$`), s.azureFileDiffs},
+		{http.MethodGet, regexp.MustCompile(azurePR + `/threads$`), s.azureListThreads},
+		{http.MethodPost, regexp.MustCompile(azurePR + `/threads$`), s.azureCreateThread},
+		{http.MethodPatch, regexp.MustCompile(azurePR + `/threads/(\d+)$`), s.azureUpdateThread},
+		{http.MethodPatch, regexp.MustCompile(azurePR + `/threads/(\d+)/comments/(\d+)$`), s.azureUpdateComment},
+		{http.MethodDelete, regexp.MustCompile(azurePR + `/threads/(\d+)/comments/(\d+)$`), s.azureDeleteComment},
+	}
+}
+
+type azureLine struct {
+	Line   int `json:"line"`
+	Offset int `json:"offset"`
+}
+
+type azureThreadContext struct {
+	FilePath       string     `json:"filePath"`
+	RightFileStart *azureLine `json:"rightFileStart,omitempty"`
+	RightFileEnd   *azureLine `json:"rightFileEnd,omitempty"`
+}
+
+type azureProperty struct {
+	Type  string `json:"$type"`
+	Value string `json:"$value"`
+}
+
+type azureComment struct {
+	ID              int    `json:"id"`
+	ParentCommentID int    `json:"parentCommentId"`
+	Content         string `json:"content"`
+	CommentType     string `json:"commentType"`
+	IsDeleted       bool   `json:"isDeleted,omitempty"`
+}
+
+type azureThread struct {
+	ID            int                      `json:"id"`
+	Status        string                   `json:"status"`
+	ThreadContext *azureThreadContext      `json:"threadContext,omitempty"`
+	Comments      []azureComment           `json:"comments"`
+	Properties    map[string]azureProperty `json:"properties,omitempty"`
+	IsDeleted     bool                     `json:"isDeleted"`
+}
+
+// azureStatus accepts a status by name or by numeric value, as Azure does.
+func azureStatus(v interface{}) (string, bool) {
+	switch status := v.(type) {
+	case string:
+		for _, name := range azureStatuses {
+			if name == status {
+				return name, true
+			}
+		}
+	case float64:
+		if i := int(status); i > 0 && i < len(azureStatuses) {
+			return azureStatuses[i], true
+		}
+	}
+	return "", false
+}
+
+func azureResolved(status string) bool {
+	switch status {
+	case "fixed", "wontFix", "closed", "byDesign":
+		return true
+	}
+	return false
+}
+
+func azurePRMatches(args []string) bool {
+	return args[0] == Project && args[1] == Repo && args[2] == strconv.Itoa(PRNumber)
+}
+
+func azureThreadOf(t *Thread) azureThread {
+	status := t.Status
+	if status == "" {
+		status = "active"
+		if t.Resolved {
+			status = "fixed"
+		}
+	}
+	out := azureThread{ID: t.ID, Status: status, Comments: []azureComment{}, IsDeleted: true}
+	if t.Path != "" {
+		startLine := t.StartLine
+		if startLine == 0 {
+			startLine = t.Line
+		}
+		out.ThreadContext = &azureThreadContext{FilePath: "/" + t.Path}
+		// a comment on the file has no lines
+		if t.Line > 0 {
+			out.ThreadContext.RightFileStart = &azureLine{Line: startLine, Offset: 1}
+			out.ThreadContext.RightFileEnd = &azureLine{Line: t.Line, Offset: 1}
+		}
+	}
+	for i, c := range t.Comments {
+		comment := azureComment{ID: c.ID, Content: c.Body, CommentType: "text", IsDeleted: c.Deleted}
+		if i > 0 {
+			comment.ParentCommentID = t.Comments[0].ID
+		}
+		out.Comments = append(out.Comments, comment)
+		out.IsDeleted = out.IsDeleted && c.Deleted
+	}
+	for k, v := range t.Properties {
+		if out.Properties == nil {
+			out.Properties = make(map[string]azureProperty)
+		}
+		out.Properties[k] = azureProperty{Type: "System.String", Value: v}
+	}
+	return out
+}
+
+// azureIteration is the single push of the pull request.
+const azureIteration = 1
+
+func (s *Server) azureListIterations(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"value": []map[string]interface{}{{"id": azureIteration,
+			"sourceRefCommit": map[string]string{"commitId": HeadSHA}, "commonRefCommit": map[string]string{"commitId": BaseSHA}}},
+		"count": 1,
+	})
+}
+
+// azureIterationChanges lists the files changed by the iteration, $top at a
+// time from $skip. Like Azure, it doesn't tell which lines changed, the file
+// diffs do.
+func (s *Server) azureIterationChanges(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	if args[3] != strconv.Itoa(azureIteration) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("TF401174: The iteration %s was not found.", args[3]))
+		return
+	}
+	changeTypes := map[string]string{"": "edit", "modified": "edit", "added": "add", "removed": "delete"}
+	entries := []map[string]interface{}{}
+	for i, f := range s.changedFiles() {
+		entries = append(entries, map[string]interface{}{
+			"changeTrackingId": i + 1,
+			"changeType":       changeTypes[f.Status],
+			"item":             map[string]string{"path": "/" + f.Path},
+		})
+	}
+
+	size := s.pageSize(queryInt(r, "$top"))
+	skip := queryInt(r, "$skip")
+	start, end, next := page(len(entries), skip/size+1, size)
+	resp := map[string]interface{}{"changeEntries": entries[start:end]}
+	if next > 0 {
+		resp["nextSkip"] = end
+		resp["nextTop"] = size
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// azureFileDiffs returns the blocks of lines changed in the files between the
+// merge base and the head of the pull request. The hunks of their patch stand
+// in for the blocks.
+func (s *Server) azureFileDiffs(w http.ResponseWriter, r *http.Request, args []string) {
+	if args[0] != Project || args[1] != Repo {
+		writeError(w, http.StatusNotFound, "TF401019: The Git repository does not exist.")
+		return
+	}
+	var req struct {
+		BaseVersionCommit   string `json:"baseVersionCommit"`
+		TargetVersionCommit string `json:"targetVersionCommit"`
+		FileDiffParams      []struct {
+			Path string `json:"path"`
+		} `json:"fileDiffParams"`
+	}
+	if err := decodeJSON(r, &req); err != nil || req.BaseVersionCommit != BaseSHA || req.TargetVersionCommit != HeadSHA {
+		writeError(w, http.StatusBadRequest, "The commits of the file diffs were not found.")
+		return
+	}
+
+	patches := make(map[string]string)
+	for _, f := range s.changedFiles() {
+		patches["/"+f.Path] = f.Patch
+	}
+	diffs := []map[string]interface{}{}
+	for _, p := range req.FileDiffParams {
+		blocks := []map[string]interface{}{}
+		for _, h := range parseHunks(patches[p.Path]) {
+			blocks = append(blocks, map[string]interface{}{
+				"changeType":              "edit",
+				"modifiedLineNumberStart": h.start,
+				"modifiedLinesCount":      h.end - h.start + 1,
+			})
+		}
+		diffs = append(diffs, map[string]interface{}{"path": p.Path, "lineDiffBlocks": blocks})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": diffs, "count": len(diffs)})
+}
+
+func (s *Server) azureListThreads(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	s.mu.Lock()
+	threads := make([]azureThread, 0, len(s.threads))
+	for _, t := range s.threads {
+		threads = append(threads, azureThreadOf(t))
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"value": threads, "count": len(threads)})
+}
+
+func (s *Server) azureCreateThread(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	var req struct {
+		Comments      []azureComment           `json:"comments"`
+		Status        interface{}              `json:"status"`
+		ThreadContext *azureThreadContext      `json:"threadContext"`
+		Properties    map[string]azureProperty `json:"properties"`
+	}
+	if err := decodeJSON(r, &req); err != nil || len(req.Comments) == 0 {
+		writeError(w, http.StatusBadRequest, "The thread must have at least one comment.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &Thread{ID: s.newID()}
+	if req.Status != nil {
+		status, ok := azureStatus(req.Status)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid thread status %v.", req.Status))
+			return
+		}
+		t.Status, t.Resolved = status, azureResolved(status)
+	}
+	if tc := req.ThreadContext; tc != nil && tc.FilePath != "" {
+		t.Path = tc.FilePath[1:]
+		if tc.RightFileStart != nil {
+			t.StartLine = tc.RightFileStart.Line
+		}
+		if tc.RightFileEnd != nil {
+			t.Line = tc.RightFileEnd.Line
+		}
+	}
+	for k, v := range req.Properties {
+		if t.Properties == nil {
+			t.Properties = make(map[string]string)
+		}
+		t.Properties[k] = v.Value
+	}
+	for _, c := range req.Comments {
+		t.Comments = append(t.Comments, Comment{ID: s.newID(), Body: c.Content})
+	}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusOK, azureThreadOf(t))
+}
+
+func (s *Server) azureUpdateThread(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	var req struct {
+		Status     interface{}              `json:"status"`
+		Properties map[string]azureProperty `json:"properties"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+	id, _ := strconv.Atoi(args[3])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.thread(id)
+	if t == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("TF401181: The thread %d was not found.", id))
+		return
+	}
+	if req.Status != nil {
+		status, ok := azureStatus(req.Status)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid thread status %v.", req.Status))
+			return
+		}
+		t.Status, t.Resolved = status, azureResolved(status)
+	}
+	// properties are merged into those of the thread
+	for k, v := range req.Properties {
+		if t.Properties == nil {
+			t.Properties = make(map[string]string)
+		}
+		t.Properties[k] = v.Value
+	}
+	writeJSON(w, http.StatusOK, azureThreadOf(t))
+}
+
+// azureComment finds a comment of the thread in the path.
+func (s *Server) azureComment(w http.ResponseWriter, args []string) (*Thread, *Comment) {
+	threadID, _ := strconv.Atoi(args[3])
+	id, _ := strconv.Atoi(args[4])
+	t, c := s.comment(id)
+	if c == nil || t.ID != threadID || c.Deleted {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("TF401182: The comment %d was not found.", id))
+		return nil, nil
+	}
+	return t, c
+}
+
+func (s *Server) azureUpdateComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+	var req azureComment
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, c := s.azureComment(w, args)
+	if c == nil {
+		return
+	}
+	c.Body = req.Content
+	c.Version++
+	writeJSON(w, http.StatusOK, azureComment{ID: c.ID, Content: c.Body, CommentType: "text"})
+}
+
+// azureDeleteComment soft deletes the comment, Azure keeps listing it flagged
+// as deleted.
+func (s *Server) azureDeleteComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !azurePRMatches(args) {
+		writeError(w, http.StatusNotFound, "TF401180: The requested pull request was not found.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, c := s.azureComment(w, args)
+	if c == nil {
+		return
+	}
+	c.Deleted = true
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,250 @@
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const bitbucketPR = `^/2\.0/repositories/([^/]+)/([^/]+)/pullrequests/(\d+)`
+
+func (s *Server) bitbucketRoutes() []route {
+	return []route{
+		{http.MethodGet, regexp.MustCompile(bitbucketPR + `/diff$`), s.bitbucketPRDiff},
+		{http.MethodGet, regexp.MustCompile(`^/2\.0/repositories/([^/]+)/([^/]+)/diff/([^/]+)$`), s.bitbucketDiff},
+		{http.MethodGet, regexp.MustCompile(bitbucketPR + `/comments$`), s.bitbucketListComments},
+		{http.MethodPost, regexp.MustCompile(bitbucketPR + `/comments$`), s.bitbucketCreateComment},
+		{http.MethodGet, regexp.MustCompile(bitbucketPR + `/comments/(\d+)$`), s.bitbucketGetComment},
+		{http.MethodPut, regexp.MustCompile(bitbucketPR + `/comments/(\d+)$`), s.bitbucketUpdateComment},
+		{http.MethodDelete, regexp.MustCompile(bitbucketPR + `/comments/(\d+)$`), s.bitbucketDeleteComment},
+	}
+}
+
+type bitbucketContent struct {
+	Raw string `json:"raw"`
+}
+
+type bitbucketInline struct {
+	From *int   `json:"from"`
+	To   *int   `json:"to"`
+	Path string `json:"path"`
+}
+
+type bitbucketComment struct {
+	ID      int              `json:"id"`
+	Deleted bool             `json:"deleted"`
+	Content bitbucketContent `json:"content"`
+	Inline  *bitbucketInline `json:"inline,omitempty"`
+	Parent  *struct {
+		ID int `json:"id"`
+	} `json:"parent,omitempty"`
+	Resolution *struct {
+		Type string `json:"type"`
+	} `json:"resolution,omitempty"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+func bitbucketPRMatches(args []string) bool {
+	return args[0] == Owner && args[1] == Repo && args[2] == strconv.Itoa(PRNumber)
+}
+
+// bitbucketCommentOf renders a comment of the thread, the resolution of the
+// thread is carried by its root.
+func (s *Server) bitbucketCommentOf(t *Thread, i int) bitbucketComment {
+	c := t.Comments[i]
+	out := bitbucketComment{ID: c.ID, Deleted: c.Deleted, Content: bitbucketContent{Raw: c.Body}}
+	if t.Path != "" {
+		out.Inline = &bitbucketInline{Path: t.Path}
+		// a comment on the file has no line
+		if t.Line > 0 {
+			line := t.Line
+			out.Inline.To = &line
+		}
+	}
+	if i > 0 {
+		out.Parent = &struct {
+			ID int `json:"id"`
+		}{ID: t.Comments[0].ID}
+	} else if t.Resolved {
+		out.Resolution = &struct {
+			Type string `json:"type"`
+		}{Type: "comment_resolution"}
+	}
+	out.Links.HTML.Href = fmt.Sprintf("%s/%s/%s/pull-requests/%d#comment-%d", s.URL, Owner, Repo, PRNumber, c.ID)
+	return out
+}
+
+// bitbucketPRDiff redirects to the diff between the commits of the pull
+// request, as Bitbucket does.
+func (s *Server) bitbucketPRDiff(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/2.0/repositories/%s/%s/diff/%s..%s", Owner, Repo, HeadSHA[:12], BaseSHA[:12]), http.StatusFound)
+}
+
+// bitbucketDiff serves the changes of the pull request as the output of git diff.
+func (s *Server) bitbucketDiff(w http.ResponseWriter, r *http.Request, args []string) {
+	if args[0] != Owner || args[1] != Repo || args[2] != HeadSHA[:12]+".."+BaseSHA[:12] {
+		writeError(w, http.StatusNotFound, "Commit not found")
+		return
+	}
+	var out strings.Builder
+	for _, f := range s.changedFiles() {
+		oldPath, newPath := "a/"+f.Path, "b/"+f.Path
+		switch f.Status {
+		case "added":
+			oldPath = "/dev/null"
+		case "removed":
+			newPath = "/dev/null"
+		}
+		fmt.Fprintf(&out, "diff --git a/%s b/%s\n--- %s\n+++ %s\n%s", f.Path, f.Path, oldPath, newPath, f.Patch)
+		if !strings.HasSuffix(f.Patch, "\n") {
+			out.WriteString("\n")
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(out.String()))
+}
+
+// bitbucketListComments lists every comment, deleted ones included, a page of
+// pagelen comments at a time linked through next.
+func (s *Server) bitbucketListComments(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	s.mu.Lock()
+	comments := []bitbucketComment{}
+	for _, t := range s.threads {
+		for i := range t.Comments {
+			comments = append(comments, s.bitbucketCommentOf(t, i))
+		}
+	}
+	s.mu.Unlock()
+
+	size := s.pageSize(queryInt(r, "pagelen"))
+	number := queryInt(r, "page")
+	if number < 1 {
+		number = 1
+	}
+	start, end, next := page(len(comments), number, size)
+	resp := map[string]interface{}{
+		"values":  comments[start:end],
+		"page":    number,
+		"pagelen": size,
+		"size":    len(comments),
+	}
+	if next > 0 {
+		resp["next"] = fmt.Sprintf("%s%s?page=%d&pagelen=%d", s.URL, r.URL.Path, next, size)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) bitbucketCreateComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	var req bitbucketComment
+	if err := decodeJSON(r, &req); err != nil || req.Content.Raw == "" {
+		writeError(w, http.StatusBadRequest, "content: This field is required.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Parent != nil {
+		t, _ := s.comment(req.Parent.ID)
+		if t == nil {
+			writeError(w, http.StatusNotFound, "Parent comment not found")
+			return
+		}
+		t.Comments = append(t.Comments, Comment{ID: s.newID(), Body: req.Content.Raw})
+		writeJSON(w, http.StatusCreated, s.bitbucketCommentOf(t, len(t.Comments)-1))
+		return
+	}
+	t := &Thread{ID: s.newID()}
+	if req.Inline != nil {
+		t.Path = req.Inline.Path
+		if req.Inline.To != nil {
+			t.StartLine, t.Line = *req.Inline.To, *req.Inline.To
+		}
+	}
+	t.Comments = []Comment{{ID: s.newID(), Body: req.Content.Raw}}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusCreated, s.bitbucketCommentOf(t, 0))
+}
+
+// bitbucketComment finds the comment in the path, along with its thread and
+// its index in the thread.
+func (s *Server) bitbucketComment(w http.ResponseWriter, args []string) (*Thread, *Comment, int) {
+	id, _ := strconv.Atoi(args[3])
+	t, c := s.comment(id)
+	if c == nil || c.Deleted {
+		writeError(w, http.StatusNotFound, "Comment not found")
+		return nil, nil, 0
+	}
+	for i := range t.Comments {
+		if t.Comments[i].ID == id {
+			return t, c, i
+		}
+	}
+	return nil, nil, 0
+}
+
+func (s *Server) bitbucketGetComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, c, i := s.bitbucketComment(w, args); c != nil {
+		writeJSON(w, http.StatusOK, s.bitbucketCommentOf(t, i))
+	}
+}
+
+func (s *Server) bitbucketUpdateComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	var req bitbucketComment
+	if err := decodeJSON(r, &req); err != nil || req.Content.Raw == "" {
+		writeError(w, http.StatusBadRequest, "content: This field is required.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, c, i := s.bitbucketComment(w, args)
+	if c == nil {
+		return
+	}
+	c.Body = req.Content.Raw
+	c.Version++
+	writeJSON(w, http.StatusOK, s.bitbucketCommentOf(t, i))
+}
+
+// bitbucketDeleteComment soft deletes the comment, Bitbucket keeps listing it
+// flagged as deleted.
+func (s *Server) bitbucketDeleteComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Pull request not found")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, c, _ := s.bitbucketComment(w, args); c != nil {
+		c.Deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
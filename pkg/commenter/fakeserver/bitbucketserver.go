@@ -0,0 +1,239 @@
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const bitbucketServerPR = `^/rest/api/1\.0/projects/([^/]+)/repos/([^/]+)/pull-requests/(\d+)`
+
+func (s *Server) bitbucketServerRoutes() []route {
+	return []route{
+		{http.MethodGet, regexp.MustCompile(bitbucketServerPR + `/activities$`), s.bitbucketServerActivities},
+		{http.MethodPost, regexp.MustCompile(bitbucketServerPR + `/comments$`), s.bitbucketServerCreateComment},
+		{http.MethodGet, regexp.MustCompile(bitbucketServerPR + `/comments/(\d+)$`), s.bitbucketServerGetComment},
+		{http.MethodPut, regexp.MustCompile(bitbucketServerPR + `/comments/(\d+)$`), s.bitbucketServerUpdateComment},
+		{http.MethodDelete, regexp.MustCompile(bitbucketServerPR + `/comments/(\d+)$`), s.bitbucketServerDeleteComment},
+	}
+}
+
+type bitbucketServerAnchor struct {
+	Line     int    `json:"line,omitempty"`
+	LineType string `json:"lineType,omitempty"`
+	FileType string `json:"fileType,omitempty"`
+	Path     string `json:"path"`
+}
+
+type bitbucketServerComment struct {
+	ID             int                      `json:"id"`
+	Version        int                      `json:"version"`
+	Text           string                   `json:"text"`
+	State          string                   `json:"state"`
+	ThreadResolved bool                     `json:"threadResolved"`
+	Comments       []bitbucketServerComment `json:"comments"`
+}
+
+type bitbucketServerActivity struct {
+	ID            int                    `json:"id"`
+	Action        string                 `json:"action"`
+	CommentAction string                 `json:"commentAction"`
+	Comment       bitbucketServerComment `json:"comment"`
+	CommentAnchor *bitbucketServerAnchor `json:"commentAnchor,omitempty"`
+}
+
+func bitbucketServerPRMatches(args []string) bool {
+	return args[0] == Project && args[1] == Repo && args[2] == strconv.Itoa(PRNumber)
+}
+
+// bitbucketServerCommentOf renders the comment, replies of the thread nested
+// below its root.
+func bitbucketServerCommentOf(t *Thread, i int) bitbucketServerComment {
+	c := t.Comments[i]
+	out := bitbucketServerComment{ID: c.ID, Version: c.Version, Text: c.Body, State: "OPEN", ThreadResolved: t.Resolved, Comments: []bitbucketServerComment{}}
+	if t.Resolved {
+		out.State = "RESOLVED"
+	}
+	if i == 0 {
+		for j := 1; j < len(t.Comments); j++ {
+			out.Comments = append(out.Comments, bitbucketServerCommentOf(t, j))
+		}
+	}
+	return out
+}
+
+// bitbucketServerActivities lists one comment activity per thread, a page of
+// limit activities from start at a time.
+func (s *Server) bitbucketServerActivities(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketServerPRMatches(args) {
+		bitbucketServerError(w, http.StatusNotFound, "Pull request does not exist.")
+		return
+	}
+	s.mu.Lock()
+	activities := []bitbucketServerActivity{}
+	for _, t := range s.threads {
+		activity := bitbucketServerActivity{ID: t.ID, Action: "COMMENTED", CommentAction: "ADDED", Comment: bitbucketServerCommentOf(t, 0)}
+		if t.Path != "" {
+			activity.CommentAnchor = &bitbucketServerAnchor{Path: t.Path}
+			// a comment on the file has no line
+			if t.Line > 0 {
+				activity.CommentAnchor.Line, activity.CommentAnchor.LineType, activity.CommentAnchor.FileType = t.Line, "ADDED", "TO"
+			}
+		}
+		activities = append(activities, activity)
+	}
+	s.mu.Unlock()
+
+	start := queryInt(r, "start")
+	if start > len(activities) {
+		start = len(activities)
+	}
+	end := start + s.pageSize(queryInt(r, "limit"))
+	if end > len(activities) {
+		end = len(activities)
+	}
+	resp := map[string]interface{}{
+		"values":     activities[start:end],
+		"start":      start,
+		"size":       end - start,
+		"isLastPage": end == len(activities),
+	}
+	if end < len(activities) {
+		resp["nextPageStart"] = end
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) bitbucketServerCreateComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketServerPRMatches(args) {
+		bitbucketServerError(w, http.StatusNotFound, "Pull request does not exist.")
+		return
+	}
+	var req struct {
+		Text   string                 `json:"text"`
+		Anchor *bitbucketServerAnchor `json:"anchor"`
+		Parent *struct {
+			ID int `json:"id"`
+		} `json:"parent"`
+	}
+	if err := decodeJSON(r, &req); err != nil || req.Text == "" {
+		bitbucketServerError(w, http.StatusBadRequest, "Please enter a non-empty value for text.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Parent != nil {
+		t, _ := s.comment(req.Parent.ID)
+		if t == nil {
+			bitbucketServerError(w, http.StatusNotFound, fmt.Sprintf("Comment %d does not exist.", req.Parent.ID))
+			return
+		}
+		t.Comments = append(t.Comments, Comment{ID: s.newID(), Body: req.Text})
+		writeJSON(w, http.StatusCreated, bitbucketServerCommentOf(t, len(t.Comments)-1))
+		return
+	}
+	t := &Thread{ID: s.newID()}
+	if req.Anchor != nil && req.Anchor.Path != "" {
+		t.Path, t.StartLine, t.Line = req.Anchor.Path, req.Anchor.Line, req.Anchor.Line
+	}
+	t.Comments = []Comment{{ID: s.newID(), Body: req.Text}}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusCreated, bitbucketServerCommentOf(t, 0))
+}
+
+func (s *Server) bitbucketServerComment(w http.ResponseWriter, args []string) (*Thread, *Comment, int) {
+	id, _ := strconv.Atoi(args[3])
+	t, c := s.comment(id)
+	if c == nil {
+		bitbucketServerError(w, http.StatusNotFound, fmt.Sprintf("Comment %d does not exist.", id))
+		return nil, nil, 0
+	}
+	for i := range t.Comments {
+		if t.Comments[i].ID == id {
+			return t, c, i
+		}
+	}
+	return nil, nil, 0
+}
+
+func (s *Server) bitbucketServerGetComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketServerPRMatches(args) {
+		bitbucketServerError(w, http.StatusNotFound, "Pull request does not exist.")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, c, i := s.bitbucketServerComment(w, args); c != nil {
+		writeJSON(w, http.StatusOK, bitbucketServerCommentOf(t, i))
+	}
+}
+
+// bitbucketServerUpdateComment edits the comment, rejecting stale versions
+// with 409 as Bitbucket Server does.
+func (s *Server) bitbucketServerUpdateComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketServerPRMatches(args) {
+		bitbucketServerError(w, http.StatusNotFound, "Pull request does not exist.")
+		return
+	}
+	var req struct {
+		Text    string `json:"text"`
+		Version *int   `json:"version"`
+	}
+	if err := decodeJSON(r, &req); err != nil || req.Version == nil {
+		bitbucketServerError(w, http.StatusBadRequest, "The version of the comment must be provided.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, c, i := s.bitbucketServerComment(w, args)
+	if c == nil {
+		return
+	}
+	if *req.Version != c.Version {
+		bitbucketServerError(w, http.StatusConflict, "You are attempting to modify a comment based on out-of-date information.")
+		return
+	}
+	c.Body = req.Text
+	c.Version++
+	writeJSON(w, http.StatusOK, bitbucketServerCommentOf(t, i))
+}
+
+// bitbucketServerDeleteComment deletes the comment at the version given,
+// comments with replies can't be deleted.
+func (s *Server) bitbucketServerDeleteComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !bitbucketServerPRMatches(args) {
+		bitbucketServerError(w, http.StatusNotFound, "Pull request does not exist.")
+		return
+	}
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil {
+		bitbucketServerError(w, http.StatusBadRequest, "The version of the comment must be provided.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, c, i := s.bitbucketServerComment(w, args)
+	if c == nil {
+		return
+	}
+	if version != c.Version {
+		bitbucketServerError(w, http.StatusConflict, "You are attempting to modify a comment based on out-of-date information.")
+		return
+	}
+	if i == 0 && len(t.Comments) > 1 {
+		bitbucketServerError(w, http.StatusConflict, "This comment has replies which must be deleted first.")
+		return
+	}
+	s.removeComment(c.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func bitbucketServerError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
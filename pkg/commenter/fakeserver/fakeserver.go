@@ -0,0 +1,590 @@
+package fakeserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+)
+
+// Vendor selects the API a Server emulates.
+type Vendor string
+
+const (
+	GitHub          Vendor = "github"
+	GitLab          Vendor = "gitlab"
+	Azure           Vendor = "azure"
+	Bitbucket       Vendor = "bitbucket"
+	BitbucketServer Vendor = "bitbucket-server"
+)
+
+// The coordinates of the pull request every server holds, requests for any
+// other pull request get a 404.
+const (
+	// Owner is the GitHub owner and the Bitbucket Cloud workspace
+	Owner = "aqua"
+	// Project is the GitLab project id, the Azure project and the Bitbucket
+	// Server project key
+	Project = "project"
+	// Repo is the repository name, and the repository id on Azure
+	Repo     = "repo"
+	PRNumber = 7
+
+	HeadSHA = "4e5d1b2c3a4f5e6d7c8b9a0f1e2d3c4b5a6f7e8d"
+	BaseSHA = "0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b"
+)
+
+const defaultPageSize = 100
+
+// File is a file changed by the pull request.
+type File struct {
+	Path string
+	// Patch is the unified diff of the file, its hunks decide which lines of
+	// the new version can be commented
+	Patch string
+	// Status is added, modified or removed, modified when empty
+	Status string
+}
+
+// Thread is a conversation on the pull request, anchored to a file when Path
+// is set and a general comment otherwise. Comments[0] is the root, the rest
+// are its replies.
+type Thread struct {
+	ID        int
+	Path      string
+	StartLine int
+	// Line is 0 for a comment on the file rather than on its lines
+	Line     int
+	Resolved bool
+	Outdated bool
+	// Status is the Azure thread status, active when empty
+	Status string
+	// Properties is the Azure thread property bag
+	Properties map[string]string
+	Comments   []Comment
+}
+
+type Comment struct {
+	ID   int
+	Body string
+	// Version is bumped on every edit, as Bitbucket Server does
+	Version int
+	// Deleted comments are only still listed by Bitbucket Cloud
+	Deleted bool
+	// ReviewID is the GitHub review the comment was submitted with
+	ReviewID int
+}
+
+// Fault makes matching requests fail instead of being served.
+type Fault struct {
+	// Method matches every method when empty
+	Method string
+	// Path is matched as a substring of the request path
+	Path string
+	// Writes restricts the fault to requests that change the pull request
+	Writes bool
+	Status int
+	Body   string
+	Header http.Header
+	// Times is the number of requests that fail, every request fails when 0
+	Times int
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// Server emulates the subset of a vendor API the providers use, serving a
+// single pull request held in memory. It is safe for concurrent use.
+type Server struct {
+	// URL is the root of the server, see APIURL for the base URL of the API
+	URL    string
+	Vendor Vendor
+	// PageSize bounds the items of every list response, set it before the first
+	// request to exercise pagination
+	PageSize int
+	// Token is the credential requests must carry, anything goes when empty
+	Token string
+	// EnterpriseVersion is reported by GitHub responses, as GitHub Enterprise
+	// Server does, github.com when empty
+	EnterpriseVersion string
+	// App requires GitHub requests to authenticate as the GitHub App, see
+	// GitHubApp, Token is then ignored
+	App *GitHubApp
+
+	ts       *httptest.Server
+	routes   []route
+	mu       sync.Mutex
+	files    []File
+	threads  []*Thread
+	nextID   int
+	faults   []*Fault
+	requests []Request
+	reviews  int
+	sleeps   []time.Duration
+	// appTokens are the installation tokens created for App, with their expiry
+	appTokens map[string]time.Time
+}
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handle  func(w http.ResponseWriter, r *http.Request, args []string)
+}
+
+// New starts a server emulating the vendor, Close it once done.
+func New(vendor Vendor) *Server {
+	s := &Server{Vendor: vendor, PageSize: defaultPageSize, nextID: 1000}
+	switch vendor {
+	case GitHub:
+		s.routes = s.githubRoutes()
+	case GitLab:
+		s.routes = s.gitlabRoutes()
+	case Azure:
+		s.routes = s.azureRoutes()
+	case Bitbucket:
+		s.routes = s.bitbucketRoutes()
+	case BitbucketServer:
+		s.routes = s.bitbucketServerRoutes()
+	default:
+		panic(fmt.Sprintf("fakeserver: unsupported vendor %q", vendor))
+	}
+	s.ts = httptest.NewServer(s)
+	s.URL = s.ts.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// APIURL is the base URL the provider of the vendor is configured with.
+func (s *Server) APIURL() string {
+	switch s.Vendor {
+	case GitLab:
+		return s.URL + "/api/v4"
+	case Azure:
+		return s.URL + "/"
+	case Bitbucket:
+		return s.URL + "/2.0/repositories"
+	}
+	// GitHub is configured as an enterprise server, which adds /api/v3/ itself
+	return s.URL
+}
+
+// Client returns the transport of the providers under test. Its retries
+// don't sleep, the waits they asked for are recorded instead, see Sleeps.
+func (s *Server) Client() *transport.Client {
+	c := transport.New()
+	c.Clock = &clock{s: s, now: time.Now()}
+	return c
+}
+
+// Sleeps returns the waits between retries of the clients returned by Client.
+func (s *Server) Sleeps() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Duration(nil), s.sleeps...)
+}
+
+type clock struct {
+	s   *Server
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+
+	c.s.mu.Lock()
+	c.s.sleeps = append(c.s.sleeps, d)
+	c.s.mu.Unlock()
+	return ctx.Err()
+}
+
+// AddFile adds a file to the changes of the pull request.
+func (s *Server) AddFile(path, patch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, File{Path: path, Patch: patch})
+}
+
+// AddChange adds a file to the changes of the pull request, an added or
+// removed one when its Status is set.
+func (s *Server) AddChange(f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, f)
+}
+
+// AddThread adds an existing conversation, the ids left at 0 are assigned.
+func (s *Server) AddThread(t Thread) Thread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.ID == 0 {
+		t.ID = s.newID()
+	}
+	for i := range t.Comments {
+		if t.Comments[i].ID == 0 {
+			t.Comments[i].ID = s.newID()
+		}
+	}
+	s.threads = append(s.threads, &t)
+	return t.copy()
+}
+
+// Threads returns the conversations currently on the pull request.
+func (s *Server) Threads() []Thread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	threads := make([]Thread, 0, len(s.threads))
+	for _, t := range s.threads {
+		threads = append(threads, t.copy())
+	}
+	return threads
+}
+
+// Comments returns the comments currently on the pull request, deleted ones
+// left out.
+func (s *Server) Comments() []Comment {
+	var comments []Comment
+	for _, t := range s.Threads() {
+		for _, c := range t.Comments {
+			if !c.Deleted {
+				comments = append(comments, c)
+			}
+		}
+	}
+	return comments
+}
+
+// Resolve marks the thread as resolved, as a reviewer would.
+func (s *Server) Resolve(threadID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.thread(threadID); t != nil {
+		t.Resolved = true
+	}
+}
+
+// Inject makes the matching requests fail, faults are tried in order.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults drops every fault not exhausted yet.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Count returns the number of requests with the method whose path contains
+// path, any method matches when method is empty.
+func (s *Server) Count(method, path string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if (method == "" || r.Method == method) && strings.Contains(r.Path, path) {
+			n++
+		}
+	}
+	return n
+}
+
+// Writes returns the number of requests that changed, or tried to change, the
+// pull request. GitHub GraphQL queries and App tokens don't count.
+func (s *Server) Writes() int {
+	n := 0
+	for _, r := range s.Requests() {
+		if isWrite(r.Method, r.Path) {
+			n++
+		}
+	}
+	return n
+}
+
+func isWrite(method, path string) bool {
+	return method != http.MethodGet && !strings.HasSuffix(path, "/graphql") && !strings.HasSuffix(path, "/access_tokens") &&
+		!strings.HasSuffix(path, "/filediffs")
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: string(body)})
+	fault := s.fault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		for key, values := range fault.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(fault.Status)
+		_, _ = w.Write([]byte(fault.Body))
+		return
+	}
+	if s.Vendor == GitHub && s.EnterpriseVersion != "" {
+		w.Header().Set("X-GitHub-Enterprise-Version", s.EnterpriseVersion)
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	matched := false
+	for _, rt := range s.routes {
+		args := rt.pattern.FindStringSubmatch(r.URL.Path)
+		if args == nil {
+			continue
+		}
+		matched = true
+		if rt.method == r.Method {
+			rt.handle(w, r, args[1:])
+			return
+		}
+	}
+	if matched {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) fault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.Contains(r.URL.Path, f.Path) ||
+			(f.Writes && !isWrite(r.Method, r.URL.Path)) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Vendor == GitHub && s.App != nil {
+		return s.appAuthorized(r)
+	}
+	if s.Token == "" {
+		return true
+	}
+	if r.Header.Get("PRIVATE-TOKEN") == s.Token {
+		return true
+	}
+	if _, password, ok := r.BasicAuth(); ok && password == s.Token {
+		return true
+	}
+	return strings.HasSuffix(r.Header.Get("Authorization"), " "+s.Token)
+}
+
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) thread(id int) *Thread {
+	for _, t := range s.threads {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// comment finds a comment by id along with its thread.
+func (s *Server) comment(id int) (*Thread, *Comment) {
+	for _, t := range s.threads {
+		for i := range t.Comments {
+			if t.Comments[i].ID == id {
+				return t, &t.Comments[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// removeComment deletes the comment, and its thread once it has no comments left.
+func (s *Server) removeComment(id int) bool {
+	for ti, t := range s.threads {
+		for i := range t.Comments {
+			if t.Comments[i].ID != id {
+				continue
+			}
+			t.Comments = append(t.Comments[:i], t.Comments[i+1:]...)
+			if len(t.Comments) == 0 {
+				s.threads = append(s.threads[:ti], s.threads[ti+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles returns a copy of the files of the pull request.
+func (s *Server) changedFiles() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]File(nil), s.files...)
+}
+
+func (s *Server) file(path string) *File {
+	for i := range s.files {
+		if s.files[i].Path == path {
+			return &s.files[i]
+		}
+	}
+	return nil
+}
+
+// newFileThread adds a thread on a file rather than on its lines, unless the
+// pull request doesn't change the file.
+func (s *Server) newFileThread(path, body string) (*Thread, bool) {
+	if f := s.file(path); f == nil || f.Status == "removed" {
+		return nil, false
+	}
+	t := &Thread{ID: s.newID(), Path: path}
+	t.Comments = []Comment{{ID: s.newID(), Body: body}}
+	s.threads = append(s.threads, t)
+	return t, true
+}
+
+// inDiff reports whether the lines of the new version of the file are all
+// covered by a hunk of its patch.
+func (s *Server) inDiff(path string, lines ...int) bool {
+	f := s.file(path)
+	if f == nil {
+		return false
+	}
+	hunks := parseHunks(f.Patch)
+	for _, line := range lines {
+		covered := false
+		for _, h := range hunks {
+			if line >= h.start && line <= h.end {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Thread) copy() Thread {
+	c := *t
+	c.Comments = append([]Comment(nil), t.Comments...)
+	if t.Properties != nil {
+		c.Properties = make(map[string]string, len(t.Properties))
+		for k, v := range t.Properties {
+			c.Properties[k] = v
+		}
+	}
+	return c
+}
+
+type hunk struct {
+	start, end int
+}
+
+var hunkRe = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseHunks returns the line ranges of the new version covered by the hunks.
+func parseHunks(patch string) []hunk {
+	var hunks []hunk
+	for _, m := range hunkRe.FindAllStringSubmatch(patch, -1) {
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count > 0 {
+			hunks = append(hunks, hunk{start: start, end: start + count - 1})
+		}
+	}
+	return hunks
+}
+
+// page returns the bounds of the 1-based page, and the next page or 0 when it
+// is the last one.
+func page(total, number, size int) (start, end, next int) {
+	if number < 1 {
+		number = 1
+	}
+	start = (number - 1) * size
+	if start > total {
+		start = total
+	}
+	end = start + size
+	if end >= total {
+		return start, total, 0
+	}
+	return start, end, number + 1
+}
+
+func (s *Server) pageSize(requested int) int {
+	if requested > 0 && requested < s.PageSize {
+		return requested
+	}
+	return s.PageSize
+}
+
+func queryInt(r *http.Request, key string) int {
+	n, _ := strconv.Atoi(r.URL.Query().Get(key))
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
@@ -0,0 +1,171 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPatch = "@@ -1,2 +1,4 @@\n a\n+b\n+c\n d\n@@ -10 +12,0 @@\n-x\n@@ -20,2 +22,2 @@\n e\n-f\n+g\n"
+
+func do(t *testing.T, method, url, contentType, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestParseHunks(t *testing.T) {
+	hunks := parseHunks(testPatch)
+	want := []hunk{{start: 1, end: 4}, {start: 22, end: 23}}
+	if fmt.Sprint(hunks) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, hunks)
+	}
+}
+
+func TestGitLab_RejectsPositionsOutsideTheDiff(t *testing.T) {
+	s := New(GitLab)
+	defer s.Close()
+	s.AddFile("a.go", testPatch)
+
+	post := func(line int) int {
+		form := url.Values{
+			"body":                    {"finding"},
+			"position[head_sha]":      {HeadSHA},
+			"position[new_path]":      {"a.go"},
+			"position[new_line]":      {fmt.Sprint(line)},
+			"position[base_sha]":      {BaseSHA},
+			"position[start_sha]":     {BaseSHA},
+			"position[position_type]": {"text"},
+		}
+		endpoint := fmt.Sprintf("%s/projects/%s/merge_requests/%d/discussions", s.APIURL(), Project, PRNumber)
+		return do(t, http.MethodPost, endpoint, "application/x-www-form-urlencoded", form.Encode()).StatusCode
+	}
+	if status := post(3); status != http.StatusCreated {
+		t.Fatalf("expected 201 for a line in the diff, got %d", status)
+	}
+	if status := post(10); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a line outside the diff, got %d", status)
+	}
+	if threads := s.Threads(); len(threads) != 1 || threads[0].Path != "a.go" || threads[0].Line != 3 {
+		t.Fatalf("unexpected threads %+v", threads)
+	}
+}
+
+func TestGitLab_PaginatesDiscussions(t *testing.T) {
+	s := New(GitLab)
+	defer s.Close()
+	s.PageSize = 2
+	for i := 0; i < 5; i++ {
+		s.AddThread(Thread{Comments: []Comment{{Body: fmt.Sprint(i)}}})
+	}
+
+	var bodies []string
+	next := "1"
+	for next != "" {
+		resp := do(t, http.MethodGet, fmt.Sprintf("%s/projects/%s/merge_requests/%d/discussions?page=%s", s.APIURL(), Project, PRNumber, next), "", "")
+		var discussions []gitlabDiscussion
+		if err := json.NewDecoder(resp.Body).Decode(&discussions); err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range discussions {
+			bodies = append(bodies, d.Notes[0].Body)
+		}
+		next = resp.Header.Get("x-next-page")
+	}
+	if strings.Join(bodies, ",") != "0,1,2,3,4" {
+		t.Fatalf("unexpected bodies %v", bodies)
+	}
+}
+
+func TestInject_FailsMatchingRequestsTimes(t *testing.T) {
+	s := New(Bitbucket)
+	defer s.Close()
+	s.Inject(Fault{Method: http.MethodGet, Path: "/comments", Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}, Times: 2})
+
+	endpoint := fmt.Sprintf("%s/%s/%s/pullrequests/%d/comments", s.APIURL(), Owner, Repo, PRNumber)
+	for i := 0; i < 2; i++ {
+		resp := do(t, http.MethodGet, endpoint, "", "")
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+			t.Fatalf("expected injected 429, got %d", resp.StatusCode)
+		}
+	}
+	if resp := do(t, http.MethodGet, endpoint, "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the fault to be exhausted, got %d", resp.StatusCode)
+	}
+	if n := s.Count(http.MethodGet, "/comments"); n != 3 {
+		t.Fatalf("expected 3 recorded requests, got %d", n)
+	}
+}
+
+func TestToken_RejectsOtherCredentials(t *testing.T) {
+	s := New(Azure)
+	defer s.Close()
+	s.Token = "secret"
+
+	endpoint := fmt.Sprintf("%s%s/_apis/git/repositories/%s/pullRequests/%d/threads", s.APIURL(), Project, Repo, PRNumber)
+	for password, want := range map[string]int{"secret": http.StatusOK, "wrong": http.StatusUnauthorized} {
+		req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+		req.SetBasicAuth("", password)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("password %q: expected %d, got %d", password, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestBitbucketServer_EnforcesCommentVersions(t *testing.T) {
+	s := New(BitbucketServer)
+	defer s.Close()
+	thread := s.AddThread(Thread{Path: "a.go", Line: 3, Comments: []Comment{{Body: "root"}, {Body: "reply"}}})
+	root, reply := thread.Comments[0].ID, thread.Comments[1].ID
+	endpoint := func(id int) string {
+		return fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/comments/%d", s.APIURL(), Project, Repo, PRNumber, id)
+	}
+
+	if resp := do(t, http.MethodPut, endpoint(root), "application/json", `{"text":"edited","version":1}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale version, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, endpoint(root), "application/json", `{"text":"edited","version":0}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, endpoint(root)+"?version=1", "", ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a comment with replies, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, endpoint(reply)+"?version=0", "", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodDelete, endpoint(root)+"?version=1", "", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if threads := s.Threads(); len(threads) != 0 {
+		t.Fatalf("expected the thread to be gone, got %+v", threads)
+	}
+}
+
+func TestUnknownPullRequest_NotFound(t *testing.T) {
+	s := New(GitHub)
+	defer s.Close()
+
+	resp := do(t, http.MethodGet, fmt.Sprintf("%s/api/v3/repos/%s/%s/pulls/%d", s.URL, Owner, Repo, PRNumber+1), "", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,533 @@
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v44/github"
+)
+
+// GitHub is served as an enterprise server, REST under /api/v3 and GraphQL at
+// /api/graphql, github.com's /graphql is accepted too.
+const githubRepo = `^/api/v3/repos/([^/]+)/([^/]+)`
+
+func (s *Server) githubRoutes() []route {
+	return []route{
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/pulls/(\d+)$`), s.githubGetPR},
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/pulls/(\d+)/files$`), s.githubListFiles},
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/pulls/(\d+)/comments$`), s.githubListReviewComments},
+		{http.MethodPost, regexp.MustCompile(githubRepo + `/pulls/(\d+)/comments$`), s.githubCreateReviewComment},
+		{http.MethodPatch, regexp.MustCompile(githubRepo + `/pulls/comments/(\d+)$`), s.githubEditComment},
+		{http.MethodDelete, regexp.MustCompile(githubRepo + `/pulls/comments/(\d+)$`), s.githubDeleteComment},
+		{http.MethodPost, regexp.MustCompile(githubRepo + `/pulls/(\d+)/reviews$`), s.githubCreateReview},
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/pulls/(\d+)/reviews/(\d+)/comments$`), s.githubListReviewComments},
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/issues/(\d+)/comments$`), s.githubListIssueComments},
+		{http.MethodPost, regexp.MustCompile(githubRepo + `/issues/(\d+)/comments$`), s.githubCreateIssueComment},
+		{http.MethodPatch, regexp.MustCompile(githubRepo + `/issues/comments/(\d+)$`), s.githubEditComment},
+		{http.MethodDelete, regexp.MustCompile(githubRepo + `/issues/comments/(\d+)$`), s.githubDeleteComment},
+		{http.MethodPost, regexp.MustCompile(`^(/api)?/graphql$`), s.githubGraphQL},
+		{http.MethodGet, regexp.MustCompile(githubRepo + `/installation$`), s.githubGetInstallation},
+		{http.MethodPost, regexp.MustCompile(`^/api/v3/app/installations/(\d+)/access_tokens$`), s.githubCreateInstallationToken},
+	}
+}
+
+func githubRepoMatches(args []string) bool {
+	return args[0] == Owner && args[1] == Repo
+}
+
+func githubPRMatches(args []string) bool {
+	return githubRepoMatches(args) && args[2] == strconv.Itoa(PRNumber)
+}
+
+func (s *Server) githubHTMLURL(anchor string) string {
+	return fmt.Sprintf("%s/%s/%s/pull/%d#%s", s.URL, Owner, Repo, PRNumber, anchor)
+}
+
+func (s *Server) githubGetPR(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.PullRequest{
+		Number:  github.Int(PRNumber),
+		State:   github.String("open"),
+		HTMLURL: github.String(fmt.Sprintf("%s/%s/%s/pull/%d", s.URL, Owner, Repo, PRNumber)),
+		Head:    &github.PullRequestBranch{SHA: github.String(HeadSHA)},
+		Base:    &github.PullRequestBranch{SHA: github.String(BaseSHA)},
+	})
+}
+
+func (s *Server) githubListFiles(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	files := make([]*github.CommitFile, 0, len(s.files))
+	for _, f := range s.files {
+		status := f.Status
+		if status == "" {
+			status = "modified"
+		}
+		files = append(files, &github.CommitFile{
+			SHA:         github.String(HeadSHA),
+			Filename:    github.String(f.Path),
+			Status:      github.String(status),
+			Patch:       github.String(f.Patch),
+			ContentsURL: github.String(fmt.Sprintf("%s/api/v3/repos/%s/%s/contents/%s?ref=%s", s.URL, Owner, Repo, f.Path, HeadSHA)),
+		})
+	}
+	s.mu.Unlock()
+	s.githubWritePage(w, r, len(files), func(start, end int) interface{} { return files[start:end] })
+}
+
+// githubReviewComment renders a comment of an inline thread, replies point at
+// the root of the thread.
+func (s *Server) githubReviewComment(t *Thread, i int) *github.PullRequestComment {
+	c := t.Comments[i]
+	comment := &github.PullRequestComment{
+		ID:       github.Int64(int64(c.ID)),
+		Body:     github.String(c.Body),
+		Path:     github.String(t.Path),
+		Side:     github.String("RIGHT"),
+		CommitID: github.String(HeadSHA),
+		HTMLURL:  github.String(s.githubHTMLURL(fmt.Sprintf("discussion_r%d", c.ID))),
+	}
+	if t.Line > 0 {
+		comment.Line = github.Int(t.Line)
+	}
+	if t.StartLine > 0 && t.StartLine != t.Line {
+		comment.StartLine = github.Int(t.StartLine)
+		comment.StartSide = github.String("RIGHT")
+	}
+	if i > 0 {
+		comment.InReplyTo = github.Int64(int64(t.Comments[0].ID))
+	}
+	if c.ReviewID > 0 {
+		comment.PullRequestReviewID = github.Int64(int64(c.ReviewID))
+	}
+	return comment
+}
+
+// githubListReviewComments lists the inline comments of the pull request, or
+// of one of its reviews.
+func (s *Server) githubListReviewComments(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	reviewID := 0
+	if len(args) > 3 {
+		reviewID, _ = strconv.Atoi(args[3])
+	}
+	s.mu.Lock()
+	var comments []*github.PullRequestComment
+	for _, t := range s.threads {
+		if t.Path == "" {
+			continue
+		}
+		for i, c := range t.Comments {
+			if reviewID == 0 || c.ReviewID == reviewID {
+				comments = append(comments, s.githubReviewComment(t, i))
+			}
+		}
+	}
+	s.mu.Unlock()
+	s.githubWritePage(w, r, len(comments), func(start, end int) interface{} { return comments[start:end] })
+}
+
+func (s *Server) githubCreateReviewComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var req struct {
+		github.PullRequestComment
+		SubjectType string `json:"subject_type"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.SubjectType == "file" {
+		t, ok := s.newFileThread(req.GetPath(), req.GetBody())
+		if !ok {
+			githubValidationFailed(w)
+			return
+		}
+		writeJSON(w, http.StatusCreated, s.githubReviewComment(t, 0))
+		return
+	}
+	if req.InReplyTo != nil {
+		t, _ := s.comment(int(req.GetInReplyTo()))
+		if t == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		t.Comments = append(t.Comments, Comment{ID: s.newID(), Body: req.GetBody()})
+		writeJSON(w, http.StatusCreated, s.githubReviewComment(t, len(t.Comments)-1))
+		return
+	}
+	t, ok := s.githubNewThread(req.GetPath(), req.GetStartLine(), req.GetLine(), req.GetBody(), 0)
+	if !ok {
+		githubValidationFailed(w)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.githubReviewComment(t, 0))
+}
+
+// githubNewThread adds an inline thread, unless its lines are outside the diff.
+func (s *Server) githubNewThread(path string, startLine, line int, body string, reviewID int) (*Thread, bool) {
+	if startLine == 0 {
+		startLine = line
+	}
+	if !s.inDiff(path, startLine, line) {
+		return nil, false
+	}
+	t := &Thread{ID: s.newID(), Path: path, StartLine: startLine, Line: line}
+	t.Comments = []Comment{{ID: s.newID(), Body: body, ReviewID: reviewID}}
+	s.threads = append(s.threads, t)
+	return t, true
+}
+
+func githubValidationFailed(w http.ResponseWriter) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"message": "Validation Failed",
+		"errors": []map[string]string{{
+			"resource": "PullRequestReviewComment",
+			"code":     "custom",
+			"field":    "pull_request_review_thread.line",
+			"message":  "could not be resolved",
+		}},
+	})
+}
+
+func (s *Server) githubEditComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubRepoMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	id, _ := strconv.Atoi(args[2])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, c := s.comment(id)
+	if c == nil || (t.Path == "") != strings.Contains(r.URL.Path, "/issues/") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	c.Body = req.Body
+	c.Version++
+	if t.Path == "" {
+		writeJSON(w, http.StatusOK, s.githubIssueComment(c))
+		return
+	}
+	for i := range t.Comments {
+		if t.Comments[i].ID == id {
+			writeJSON(w, http.StatusOK, s.githubReviewComment(t, i))
+			return
+		}
+	}
+}
+
+func (s *Server) githubDeleteComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubRepoMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	id, _ := strconv.Atoi(args[2])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, _ := s.comment(id)
+	if t == nil || (t.Path == "") != strings.Contains(r.URL.Path, "/issues/") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.removeComment(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// githubCreateReview submits the comments as one review. As GitHub does, the
+// whole review is rejected when any of its comments is outside the diff.
+func (s *Server) githubCreateReview(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var req github.PullRequestReviewRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range req.Comments {
+		startLine := c.GetStartLine()
+		if startLine == 0 {
+			startLine = c.GetLine()
+		}
+		if !s.inDiff(c.GetPath(), startLine, c.GetLine()) {
+			githubValidationFailed(w)
+			return
+		}
+	}
+	s.reviews++
+	reviewID := s.newID()
+	for _, c := range req.Comments {
+		s.githubNewThread(c.GetPath(), c.GetStartLine(), c.GetLine(), c.GetBody(), reviewID)
+	}
+	writeJSON(w, http.StatusOK, &github.PullRequestReview{
+		ID:       github.Int64(int64(reviewID)),
+		Body:     github.String(req.GetBody()),
+		State:    github.String("COMMENTED"),
+		CommitID: github.String(HeadSHA),
+		HTMLURL:  github.String(s.githubHTMLURL(fmt.Sprintf("pullrequestreview-%d", reviewID))),
+	})
+}
+
+// Reviews returns the number of GitHub reviews submitted so far.
+func (s *Server) Reviews() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reviews
+}
+
+func (s *Server) githubIssueComment(c *Comment) *github.IssueComment {
+	return &github.IssueComment{
+		ID:      github.Int64(int64(c.ID)),
+		Body:    github.String(c.Body),
+		HTMLURL: github.String(s.githubHTMLURL(fmt.Sprintf("issuecomment-%d", c.ID))),
+	}
+}
+
+func (s *Server) githubListIssueComments(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.mu.Lock()
+	var comments []*github.IssueComment
+	for _, t := range s.threads {
+		if t.Path != "" {
+			continue
+		}
+		for i := range t.Comments {
+			comments = append(comments, s.githubIssueComment(&t.Comments[i]))
+		}
+	}
+	s.mu.Unlock()
+	s.githubWritePage(w, r, len(comments), func(start, end int) interface{} { return comments[start:end] })
+}
+
+func (s *Server) githubCreateIssueComment(w http.ResponseWriter, r *http.Request, args []string) {
+	if !githubPRMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var req github.IssueComment
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &Thread{ID: s.newID(), Comments: []Comment{{ID: s.newID(), Body: req.GetBody()}}}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusCreated, s.githubIssueComment(&t.Comments[0]))
+}
+
+// githubWritePage writes the page asked for with per_page and page, linking the
+// next one as GitHub does.
+func (s *Server) githubWritePage(w http.ResponseWriter, r *http.Request, total int, items func(start, end int) interface{}) {
+	size := s.pageSize(queryInt(r, "per_page"))
+	start, end, next := page(total, queryInt(r, "page"), size)
+	if next > 0 {
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=%d&page=%d>; rel="next"`, s.URL, r.URL.Path, size, next))
+	}
+	writeJSON(w, http.StatusOK, items(start, end))
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type githubGraphQLComment struct {
+	DatabaseID int    `json:"databaseId"`
+	URL        string `json:"url"`
+	Body       string `json:"body"`
+	Path       string `json:"path"`
+	Line       *int   `json:"line"`
+	StartLine  *int   `json:"startLine"`
+}
+
+type githubGraphQLThread struct {
+	ID         string                `json:"id"`
+	IsResolved bool                  `json:"isResolved"`
+	IsOutdated bool                  `json:"isOutdated"`
+	Path       string                `json:"path"`
+	Line       *int                  `json:"line"`
+	StartLine  *int                  `json:"startLine"`
+	Comments   githubGraphQLComments `json:"comments"`
+}
+
+type githubGraphQLComments struct {
+	PageInfo githubPageInfo         `json:"pageInfo"`
+	Nodes    []githubGraphQLComment `json:"nodes"`
+}
+
+type githubPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// githubGraphQL answers the reviewThreads query of a pull request, and the
+// query of the next comments of a thread by its node id. Cursors are the
+// offset of the next thread or comment.
+func (s *Server) githubGraphQL(w http.ResponseWriter, r *http.Request, _ []string) {
+	var req graphQLRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	if strings.Contains(req.Query, "node(id:") {
+		s.githubGraphQLThreadComments(w, req)
+		return
+	}
+	if !strings.Contains(req.Query, "reviewThreads") {
+		githubGraphQLError(w, "fakeserver only answers reviewThreads and node queries")
+		return
+	}
+	number, _ := req.Variables["number"].(float64)
+	if req.Variables["owner"] != Owner || req.Variables["name"] != Repo || int(number) != PRNumber {
+		githubGraphQLError(w, "Could not resolve to a PullRequest")
+		return
+	}
+	offset := 0
+	if cursor, ok := req.Variables["threadCursor"].(string); ok {
+		offset, _ = strconv.Atoi(cursor)
+	}
+
+	s.mu.Lock()
+	var threads []githubGraphQLThread
+	for _, t := range s.threads {
+		if t.Path != "" {
+			threads = append(threads, s.githubGraphQLThread(t, 0))
+		}
+	}
+	s.mu.Unlock()
+
+	size := s.pageSize(100)
+	if offset > len(threads) {
+		offset = len(threads)
+	}
+	end := offset + size
+	if end > len(threads) {
+		end = len(threads)
+	}
+	var resp struct {
+		Data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						PageInfo githubPageInfo        `json:"pageInfo"`
+						Nodes    []githubGraphQLThread `json:"nodes"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		} `json:"data"`
+	}
+	page := &resp.Data.Repository.PullRequest.ReviewThreads
+	page.Nodes = append([]githubGraphQLThread{}, threads[offset:end]...)
+	page.PageInfo = githubPageInfo{HasNextPage: end < len(threads), EndCursor: strconv.Itoa(end)}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// githubGraphQLThreadComments answers the comments of a thread from the
+// commentCursor on.
+func (s *Server) githubGraphQLThreadComments(w http.ResponseWriter, req graphQLRequest) {
+	id, _ := req.Variables["id"].(string)
+	offset := 0
+	if cursor, ok := req.Variables["commentCursor"].(string); ok {
+		offset, _ = strconv.Atoi(cursor)
+	}
+	threadID, _ := strconv.Atoi(strings.TrimPrefix(id, "PRRT_"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.threads {
+		if t.ID == threadID && t.Path != "" {
+			var resp struct {
+				Data struct {
+					Node struct {
+						Comments githubGraphQLComments `json:"comments"`
+					} `json:"node"`
+				} `json:"data"`
+			}
+			resp.Data.Node.Comments = s.githubGraphQLThread(t, offset).Comments
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+	githubGraphQLError(w, fmt.Sprintf("Could not resolve to a node with the global id of '%s'", id))
+}
+
+// githubGraphQLThread renders the thread with a page of its comments from
+// offset on.
+func (s *Server) githubGraphQLThread(t *Thread, offset int) githubGraphQLThread {
+	line, startLine := t.Line, t.StartLine
+	if startLine == 0 {
+		startLine = line
+	}
+	out := githubGraphQLThread{
+		ID:         fmt.Sprintf("PRRT_%d", t.ID),
+		IsResolved: t.Resolved,
+		IsOutdated: t.Outdated,
+		Path:       t.Path,
+		Line:       &line,
+		StartLine:  &startLine,
+	}
+	out.Comments.Nodes = []githubGraphQLComment{}
+	if offset > len(t.Comments) {
+		offset = len(t.Comments)
+	}
+	end := offset + s.pageSize(100)
+	if end > len(t.Comments) {
+		end = len(t.Comments)
+	}
+	out.Comments.PageInfo = githubPageInfo{HasNextPage: end < len(t.Comments), EndCursor: strconv.Itoa(end)}
+	for _, c := range t.Comments[offset:end] {
+		out.Comments.Nodes = append(out.Comments.Nodes, githubGraphQLComment{
+			DatabaseID: c.ID,
+			URL:        s.githubHTMLURL(fmt.Sprintf("discussion_r%d", c.ID)),
+			Body:       c.Body,
+			Path:       t.Path,
+			Line:       &line,
+			StartLine:  &startLine,
+		})
+	}
+	return out
+}
+
+func githubGraphQLError(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   nil,
+		"errors": []map[string]string{{"message": message}},
+	})
+}
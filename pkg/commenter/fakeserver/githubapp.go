@@ -0,0 +1,118 @@
+package fakeserver
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v44/github"
+)
+
+// GitHubApp makes a GitHub server authenticate requests as GitHub does those
+// of an App installed on the repository: the installation is found and its
+// tokens created with a JWT signed by the key of the App, any other request
+// must carry one of these tokens before it expires.
+type GitHubApp struct {
+	ID  int64
+	Key *rsa.PublicKey
+	// InstallationID identifies the installation of the App on the repository
+	InstallationID int64
+	// TokenTTL is the lifetime of the installation tokens, an hour when zero
+	TokenTTL time.Duration
+}
+
+func isAppPath(path string) bool {
+	return strings.HasSuffix(path, "/installation") || strings.HasSuffix(path, "/access_tokens")
+}
+
+// appAuthorized checks the JWT of the App on its endpoints and an unexpired
+// installation token on the others.
+func (s *Server) appAuthorized(r *http.Request) bool {
+	credential := r.Header.Get("Authorization")
+	if i := strings.IndexByte(credential, ' '); i >= 0 {
+		credential = credential[i+1:]
+	}
+	if isAppPath(r.URL.Path) {
+		return s.validJWT(credential)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.appTokens[credential]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// validJWT verifies the RS256 signature of the JWT, that it is issued by the
+// App and that it expires within the 10 minutes GitHub allows.
+func (s *Server) validJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || !strings.Contains(string(header), `"RS256"`) {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(s.App.Key, crypto.SHA256, digest[:], signature) != nil {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Iss != strconv.FormatInt(s.App.ID, 10) {
+		return false
+	}
+	now := time.Now()
+	exp := time.Unix(claims.Exp, 0)
+	return exp.After(now) && exp.Before(now.Add(10*time.Minute+time.Second))
+}
+
+func (s *Server) githubGetInstallation(w http.ResponseWriter, r *http.Request, args []string) {
+	if s.App == nil || !githubRepoMatches(args) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Installation{
+		ID:    github.Int64(s.App.InstallationID),
+		AppID: github.Int64(s.App.ID),
+	})
+}
+
+func (s *Server) githubCreateInstallationToken(w http.ResponseWriter, r *http.Request, args []string) {
+	if s.App == nil || args[0] != strconv.FormatInt(s.App.InstallationID, 10) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	ttl := s.App.TokenTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	s.mu.Lock()
+	token := fmt.Sprintf("ghs_%d", s.newID())
+	expiresAt := time.Now().Add(ttl)
+	if s.appTokens == nil {
+		s.appTokens = make(map[string]time.Time)
+	}
+	s.appTokens[token] = expiresAt
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, &github.InstallationToken{
+		Token:     github.String(token),
+		ExpiresAt: &expiresAt,
+	})
+}
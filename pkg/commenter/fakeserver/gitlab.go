@@ -0,0 +1,325 @@
+package fakeserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const gitlabMR = `^/api/v4/projects/([^/]+)/merge_requests/(\d+)`
+
+func (s *Server) gitlabRoutes() []route {
+	return []route{
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `$`), s.gitlabGetMR},
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `/versions$`), s.gitlabVersions},
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `/diffs$`), s.gitlabDiffs},
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `/changes$`), s.gitlabChanges},
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `/discussions$`), s.gitlabListDiscussions},
+		{http.MethodPost, regexp.MustCompile(gitlabMR + `/discussions$`), s.gitlabCreateDiscussion},
+		{http.MethodPut, regexp.MustCompile(gitlabMR + `/discussions/(\d+)/notes/(\d+)$`), s.gitlabUpdateNote},
+		{http.MethodDelete, regexp.MustCompile(gitlabMR + `/discussions/(\d+)/notes/(\d+)$`), s.gitlabDeleteNote},
+		{http.MethodGet, regexp.MustCompile(gitlabMR + `/notes$`), s.gitlabListNotes},
+		{http.MethodPost, regexp.MustCompile(gitlabMR + `/notes$`), s.gitlabCreateNote},
+		{http.MethodPut, regexp.MustCompile(gitlabMR + `/notes/(\d+)$`), s.gitlabUpdateNote},
+		{http.MethodDelete, regexp.MustCompile(gitlabMR + `/notes/(\d+)$`), s.gitlabDeleteNote},
+	}
+}
+
+type gitlabPosition struct {
+	PositionType string `json:"position_type"`
+	NewPath      string `json:"new_path"`
+	OldPath      string `json:"old_path"`
+	NewLine      int    `json:"new_line,omitempty"`
+	BaseSHA      string `json:"base_sha"`
+	HeadSHA      string `json:"head_sha"`
+	StartSHA     string `json:"start_sha"`
+}
+
+type gitlabNote struct {
+	ID         int             `json:"id"`
+	Type       string          `json:"type,omitempty"`
+	Body       string          `json:"body"`
+	System     bool            `json:"system"`
+	Resolvable bool            `json:"resolvable"`
+	Resolved   bool            `json:"resolved"`
+	Position   *gitlabPosition `json:"position,omitempty"`
+}
+
+type gitlabDiscussion struct {
+	ID             string       `json:"id"`
+	IndividualNote bool         `json:"individual_note"`
+	Notes          []gitlabNote `json:"notes"`
+}
+
+func gitlabMRMatches(args []string) bool {
+	return args[0] == Project && args[1] == strconv.Itoa(PRNumber)
+}
+
+func (s *Server) gitlabGetMR(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"iid":     PRNumber,
+		"state":   "opened",
+		"web_url": fmt.Sprintf("%s/%s/%s/-/merge_requests/%d", s.URL, Owner, Repo, PRNumber),
+		"diff_refs": map[string]string{
+			"base_sha":  BaseSHA,
+			"head_sha":  HeadSHA,
+			"start_sha": BaseSHA,
+		},
+	})
+}
+
+func (s *Server) gitlabVersions(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, []map[string]interface{}{{
+		"id":               1,
+		"head_commit_sha":  HeadSHA,
+		"base_commit_sha":  BaseSHA,
+		"start_commit_sha": BaseSHA,
+		"state":            "collected",
+	}})
+}
+
+type gitlabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+func (s *Server) gitlabDiffsOf() []gitlabDiff {
+	diffs := []gitlabDiff{}
+	for _, f := range s.changedFiles() {
+		diffs = append(diffs, gitlabDiff{
+			OldPath:     f.Path,
+			NewPath:     f.Path,
+			Diff:        f.Patch,
+			NewFile:     f.Status == "added",
+			DeletedFile: f.Status == "removed",
+		})
+	}
+	return diffs
+}
+
+// gitlabDiffs lists the diff of every file, a page at a time.
+func (s *Server) gitlabDiffs(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	diffs := s.gitlabDiffsOf()
+	start, end := s.gitlabPage(w, r, len(diffs))
+	writeJSON(w, http.StatusOK, diffs[start:end])
+}
+
+// gitlabChanges returns the merge request with the diff of every file, the
+// endpoint GitLab deprecated in favor of diffs.
+func (s *Server) gitlabChanges(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"iid":     PRNumber,
+		"changes": s.gitlabDiffsOf(),
+	})
+}
+
+func gitlabDiscussionOf(t *Thread) gitlabDiscussion {
+	d := gitlabDiscussion{ID: strconv.Itoa(t.ID), IndividualNote: t.Path == "", Notes: []gitlabNote{}}
+	for _, c := range t.Comments {
+		d.Notes = append(d.Notes, gitlabNoteOf(t, c))
+	}
+	return d
+}
+
+func gitlabNoteOf(t *Thread, c Comment) gitlabNote {
+	n := gitlabNote{ID: c.ID, Body: c.Body}
+	if t.Path != "" {
+		n.Type = "DiffNote"
+		n.Resolvable = true
+		n.Resolved = t.Resolved
+		n.Position = &gitlabPosition{
+			PositionType: "text",
+			NewPath:      t.Path,
+			OldPath:      t.Path,
+			NewLine:      t.Line,
+			BaseSHA:      BaseSHA,
+			HeadSHA:      HeadSHA,
+			StartSHA:     BaseSHA,
+		}
+		if t.Line == 0 {
+			n.Position.PositionType = "file"
+		}
+	}
+	return n
+}
+
+func (s *Server) gitlabListDiscussions(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	s.mu.Lock()
+	discussions := make([]gitlabDiscussion, 0, len(s.threads))
+	for _, t := range s.threads {
+		discussions = append(discussions, gitlabDiscussionOf(t))
+	}
+	s.mu.Unlock()
+	start, end := s.gitlabPage(w, r, len(discussions))
+	writeJSON(w, http.StatusOK, discussions[start:end])
+}
+
+// gitlabCreateDiscussion starts a discussion, on a diff line when a position is
+// given, or on a file with the file position type of GitLab 16.4. Like GitLab,
+// positions outside the diff are rejected with 400.
+func (s *Server) gitlabCreateDiscussion(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "400 Bad request")
+		return
+	}
+	body := r.PostForm.Get("body")
+	if body == "" {
+		writeError(w, http.StatusBadRequest, "400 Bad request - body is missing")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.PostForm.Get("position[position_type]") == "file" {
+		t, ok := s.newFileThread(r.PostForm.Get("position[new_path]"), body)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "400 Bad request - Note {:position=>[\"is invalid\"]}")
+			return
+		}
+		writeJSON(w, http.StatusCreated, gitlabDiscussionOf(t))
+		return
+	}
+	t := &Thread{ID: s.newID()}
+	if path := r.PostForm.Get("position[new_path]"); path != "" {
+		line, _ := strconv.Atoi(r.PostForm.Get("position[new_line]"))
+		if r.PostForm.Get("position[head_sha]") != HeadSHA || !s.inDiff(path, line) {
+			writeError(w, http.StatusBadRequest, `400 Bad request - Note {:line_code=>["can't be blank", "must be a valid line code"]}`)
+			return
+		}
+		t.Path, t.StartLine, t.Line = path, line, line
+	}
+	t.Comments = []Comment{{ID: s.newID(), Body: body}}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusCreated, gitlabDiscussionOf(t))
+}
+
+// gitlabUpdateNote edits the body of a note, and resolves or reopens its
+// discussion when asked to.
+func (s *Server) gitlabUpdateNote(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "400 Bad request")
+		return
+	}
+	id, _ := strconv.Atoi(args[len(args)-1])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, c := s.comment(id)
+	if c == nil || (len(args) == 4 && args[2] != strconv.Itoa(t.ID)) {
+		writeError(w, http.StatusNotFound, "404 Note Not Found")
+		return
+	}
+	if body := r.PostForm.Get("body"); body != "" {
+		c.Body = body
+		c.Version++
+	}
+	if resolved := r.PostForm.Get("resolved"); resolved != "" {
+		t.Resolved = resolved == "true"
+	}
+	writeJSON(w, http.StatusOK, gitlabNoteOf(t, *c))
+}
+
+func (s *Server) gitlabDeleteNote(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	id, _ := strconv.Atoi(args[len(args)-1])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, _ := s.comment(id)
+	if t == nil || (len(args) == 4 && args[2] != strconv.Itoa(t.ID)) {
+		writeError(w, http.StatusNotFound, "404 Note Not Found")
+		return
+	}
+	s.removeComment(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// gitlabListNotes lists every note of the merge request, discussion notes
+// included, as GitLab does.
+func (s *Server) gitlabListNotes(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	s.mu.Lock()
+	notes := []gitlabNote{}
+	for _, t := range s.threads {
+		for _, c := range t.Comments {
+			notes = append(notes, gitlabNoteOf(t, c))
+		}
+	}
+	s.mu.Unlock()
+	start, end := s.gitlabPage(w, r, len(notes))
+	writeJSON(w, http.StatusOK, notes[start:end])
+}
+
+func (s *Server) gitlabCreateNote(w http.ResponseWriter, r *http.Request, args []string) {
+	if !gitlabMRMatches(args) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+	if err := r.ParseForm(); err != nil || strings.TrimSpace(r.PostForm.Get("body")) == "" {
+		writeError(w, http.StatusBadRequest, "400 Bad request - body is missing")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &Thread{ID: s.newID(), Comments: []Comment{{ID: s.newID(), Body: r.PostForm.Get("body")}}}
+	s.threads = append(s.threads, t)
+	writeJSON(w, http.StatusCreated, gitlabNoteOf(t, t.Comments[0]))
+}
+
+// gitlabPage sets the pagination headers of the page asked for with page and
+// per_page, and returns its bounds.
+func (s *Server) gitlabPage(w http.ResponseWriter, r *http.Request, total int) (int, int) {
+	number := queryInt(r, "page")
+	if number < 1 {
+		number = 1
+	}
+	start, end, next := page(total, number, s.pageSize(queryInt(r, "per_page")))
+	w.Header().Set("x-page", strconv.Itoa(number))
+	w.Header().Set("x-total", strconv.Itoa(total))
+	if next > 0 {
+		w.Header().Set("x-next-page", strconv.Itoa(next))
+	} else {
+		w.Header().Set("x-next-page", "")
+	}
+	return start, end
+}
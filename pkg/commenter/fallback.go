@@ -0,0 +1,245 @@
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// OutOfDiff is the policy applied to a finding outside the PR diff.
+type OutOfDiff string
+
+const (
+	// OutOfDiffDrop skips the finding, see Result.Reason
+	OutOfDiffDrop OutOfDiff = "drop"
+	// OutOfDiffNearest moves the finding to the line of its file in the diff
+	// closest to it
+	OutOfDiffNearest OutOfDiff = "nearest"
+	// OutOfDiffFile writes the finding as a comment on its file instead of its lines
+	OutOfDiffFile OutOfDiff = "file"
+	// OutOfDiffSummary lists the finding in a section of the PR summary comment
+	OutOfDiffSummary OutOfDiff = "summary"
+)
+
+// OutOfDiffPolicies lists the policies in the order they are documented.
+var OutOfDiffPolicies = []OutOfDiff{OutOfDiffDrop, OutOfDiffNearest, OutOfDiffFile, OutOfDiffSummary}
+
+// ParseOutOfDiff returns the policy named s, drop when s is empty.
+func ParseOutOfDiff(s string) (OutOfDiff, error) {
+	if s == "" {
+		return OutOfDiffDrop, nil
+	}
+	for _, policy := range OutOfDiffPolicies {
+		if string(policy) == s {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown out of diff policy %q", s)
+}
+
+// FileCommentWriter is implemented by providers that can anchor a comment to
+// a file of the PR rather than to its lines.
+type FileCommentWriter interface {
+	// WriteFileComment writes the finding on its file, the lines are ignored.
+	// A commenter.NotInDiffError is reported when the PR doesn't change the file.
+	WriteFileComment(ctx context.Context, f Finding) Result
+}
+
+// FallbackOptions configures the repository returned by NewFallbackRepository.
+type FallbackOptions struct {
+	Policy OutOfDiff
+	// SummaryID identifies the summary comment of the summary policy, see
+	// SummaryWriter, "aqua" when empty
+	SummaryID string
+	// SummaryTitle heads the summary comment, "Aqua findings" when empty
+	SummaryTitle string
+	// Marker is removed from the findings listed in the summary by
+	// WriteFindings, ReconcileFindings is given its own
+	Marker string
+}
+
+type fallbackRepository struct {
+	RepositoryV2
+	repo Repository
+	opts FallbackOptions
+	// written are the findings of every WriteFindings call, which add to the
+	// comments of the PR, outside those out of the diff
+	written []Finding
+	outside []Finding
+}
+
+// NewFallbackRepository adapts repo to RepositoryV2 like NewRepositoryV2, and
+// applies the policy of opts to the findings the provider skips as outside
+// the PR diff. Result.Fallback reports the policy applied to each of them,
+// drop when the provider can't apply the chosen one: the nearest policy needs
+// a line of the file in the diff, the file policy a FileCommentWriter and the
+// summary policy a SummaryWriter.
+func NewFallbackRepository(repo Repository, opts FallbackOptions) RepositoryV2 {
+	if opts.Policy == "" {
+		opts.Policy = OutOfDiffDrop
+	}
+	if opts.SummaryID == "" {
+		opts.SummaryID = "aqua"
+	}
+	if opts.SummaryTitle == "" {
+		opts.SummaryTitle = "Aqua findings"
+	}
+	return &fallbackRepository{RepositoryV2: NewRepositoryV2(repo), repo: repo, opts: opts}
+}
+
+func (r *fallbackRepository) WriteFindings(ctx context.Context, findings []Finding) ([]Result, error) {
+	results, err := r.RepositoryV2.WriteFindings(ctx, findings)
+	if err != nil {
+		return results, err
+	}
+	r.written = append(r.written, findings...)
+	outside := r.apply(ctx, results)
+	if len(outside) == 0 {
+		return results, nil
+	}
+	r.outside = append(r.outside, outside...)
+	r.upsertSummary(ctx, r.opts.Marker, r.written, r.outside, results)
+	return results, nil
+}
+
+// ReconcileFindings reconciles the findings and applies the policy to those
+// outside the diff. With the summary policy the summary is always brought up
+// to date, so that findings back in the diff leave it.
+func (r *fallbackRepository) ReconcileFindings(ctx context.Context, marker string, findings []Finding) ([]Result, error) {
+	results, err := r.RepositoryV2.ReconcileFindings(ctx, marker, findings)
+	if err != nil {
+		return results, err
+	}
+	outside := r.apply(ctx, results)
+	if r.opts.Policy == OutOfDiffSummary {
+		r.upsertSummary(ctx, marker, findings, outside, results)
+	}
+	return results, nil
+}
+
+// apply applies the policy to the results skipped as outside the diff, in
+// place, and returns the findings left for the summary.
+func (r *fallbackRepository) apply(ctx context.Context, results []Result) []Finding {
+	var outside []Finding
+	for i, result := range results {
+		if result.Status != StatusSkipped || !errors.Is(result.Err, ErrNotInDiff) {
+			continue
+		}
+		if ctx.Err() != nil {
+			results[i].Fallback = OutOfDiffDrop
+			continue
+		}
+		switch r.opts.Policy {
+		case OutOfDiffNearest:
+			results[i] = r.writeNearest(ctx, result)
+		case OutOfDiffFile:
+			results[i] = r.writeFile(ctx, result)
+		case OutOfDiffSummary:
+			if _, ok := r.repo.(SummaryWriter); ok {
+				results[i].Fallback = OutOfDiffSummary
+				outside = append(outside, result.Finding)
+				continue
+			}
+			results[i].Fallback = OutOfDiffDrop
+		default:
+			results[i].Fallback = OutOfDiffDrop
+		}
+	}
+	return outside
+}
+
+func (r *fallbackRepository) writeNearest(ctx context.Context, skipped Result) Result {
+	var notInDiff NotInDiffError
+	if !errors.As(skipped.Err, &notInDiff) || notInDiff.Nearest <= 0 {
+		skipped.Fallback = OutOfDiffDrop
+		return skipped
+	}
+	moved := skipped.Finding
+	moved.StartLine, moved.EndLine = notInDiff.Nearest, notInDiff.Nearest
+	// the suggestion replaces the lines of the finding, not the nearest one
+	moved.Suggestion = ""
+	results, _ := r.RepositoryV2.WriteFindings(ctx, []Finding{moved})
+	result := results[0]
+	result.Finding = skipped.Finding
+	result.Fallback = OutOfDiffNearest
+	if result.Status == StatusSkipped {
+		result.Fallback = OutOfDiffDrop
+	}
+	return result
+}
+
+func (r *fallbackRepository) writeFile(ctx context.Context, skipped Result) Result {
+	w, ok := r.repo.(FileCommentWriter)
+	if !ok {
+		skipped.Fallback = OutOfDiffDrop
+		return skipped
+	}
+	result := w.WriteFileComment(ctx, skipped.Finding)
+	result.Fallback = OutOfDiffFile
+	if result.Status == StatusSkipped {
+		result.Fallback = OutOfDiffDrop
+	}
+	return result
+}
+
+// upsertSummary writes the summary of findings with a section listing those
+// outside the diff, and reports its outcome on the results of the latter.
+func (r *fallbackRepository) upsertSummary(ctx context.Context, marker string, findings, outside []Finding, results []Result) {
+	w, ok := r.repo.(SummaryWriter)
+	if !ok || ctx.Err() != nil {
+		return
+	}
+	body := RenderSummary(r.opts.SummaryTitle, findings) + "\n" + RenderOutOfDiff(outside, marker)
+	summary := w.UpsertSummary(ctx, r.opts.SummaryID, body)
+	for i := range results {
+		if results[i].Fallback != OutOfDiffSummary || results[i].Status != StatusSkipped {
+			continue
+		}
+		results[i].Status = summary.Status
+		results[i].CommentID = summary.CommentID
+		results[i].URL = summary.URL
+		results[i].Reason = ""
+		results[i].Err = summary.Err
+	}
+}
+
+// RenderOutOfDiff renders the Markdown section of the summary listing the
+// findings outside the PR diff. The marker and the hidden metadata of their
+// bodies are left out, the summary must not be taken for an inline comment.
+func RenderOutOfDiff(findings []Finding, marker string) string {
+	var sb strings.Builder
+	sb.WriteString("#### Outside the diff\n\n")
+	if len(findings) == 0 {
+		sb.WriteString("No findings outside the diff.\n")
+		return sb.String()
+	}
+	for _, f := range findings {
+		location := f.Path
+		if f.StartLine > 0 {
+			location = fmt.Sprintf("%s:%d", f.Path, f.StartLine)
+		}
+		fmt.Fprintf(&sb, "- `%s`", location)
+		if title := summaryLine(f.Body, marker); title != "" {
+			sb.WriteString(" " + title)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// summaryLine returns the first line of the visible body.
+func summaryLine(body, marker string) string {
+	body = fingerprint.Strip(body)
+	if marker != "" {
+		body = strings.ReplaceAll(body, marker, "")
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package commenter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// diffRepo only accepts comments on the lines of its diff, and on the files
+// of the diff when written at file level.
+type diffRepo struct {
+	legacyRepo
+	diff      map[string][]int
+	lines     []string
+	files     []string
+	summaries map[string]string
+}
+
+func newDiffRepo() *diffRepo {
+	return &diffRepo{
+		diff:      map[string][]int{"main.go": {10, 11, 12}},
+		summaries: make(map[string]string),
+	}
+}
+
+func (r *diffRepo) WriteFinding(_ context.Context, f Finding) Result {
+	lines, ok := r.diff[f.Path]
+	if !ok {
+		return FailedResult(f, NotInDiffError{Path: f.Path, Line: f.StartLine})
+	}
+	for _, line := range lines {
+		if line == f.StartLine {
+			r.lines = append(r.lines, f.Path+":"+strconv.Itoa(f.StartLine))
+			return Result{Finding: f, Status: StatusCreated, CommentID: "line"}
+		}
+	}
+	return FailedResult(f, NotInDiffError{Path: f.Path, Line: f.StartLine, Nearest: lines[0]})
+}
+
+func (r *diffRepo) UpsertSummary(_ context.Context, id, body string) Result {
+	status := StatusCreated
+	if _, ok := r.summaries[id]; ok {
+		status = StatusEdited
+	}
+	r.summaries[id] = body
+	return Result{Status: status, CommentID: "summary"}
+}
+
+type fileRepo struct {
+	*diffRepo
+}
+
+func (r fileRepo) WriteFileComment(_ context.Context, f Finding) Result {
+	if _, ok := r.diff[f.Path]; !ok {
+		return FailedResult(f, NotInDiffError{Path: f.Path})
+	}
+	r.files = append(r.files, f.Path)
+	return Result{Finding: f, Status: StatusCreated, CommentID: "file"}
+}
+
+var outsideFindings = []Finding{
+	{Path: "main.go", StartLine: 11, EndLine: 11, Body: "in the diff"},
+	{Path: "main.go", StartLine: 40, EndLine: 40, Body: "below the diff"},
+	{Path: "other.go", StartLine: 3, EndLine: 3, Body: "unchanged file"},
+}
+
+func TestFallbackRepository_Policies(t *testing.T) {
+	tests := []struct {
+		policy   OutOfDiff
+		repo     func() Repository
+		statuses []Status
+		applied  []OutOfDiff
+	}{
+		{
+			policy:   OutOfDiffDrop,
+			repo:     func() Repository { return newDiffRepo() },
+			statuses: []Status{StatusCreated, StatusSkipped, StatusSkipped},
+			applied:  []OutOfDiff{"", OutOfDiffDrop, OutOfDiffDrop},
+		},
+		{
+			policy:   OutOfDiffNearest,
+			repo:     func() Repository { return newDiffRepo() },
+			statuses: []Status{StatusCreated, StatusCreated, StatusSkipped},
+			applied:  []OutOfDiff{"", OutOfDiffNearest, OutOfDiffDrop},
+		},
+		{
+			policy:   OutOfDiffFile,
+			repo:     func() Repository { return fileRepo{newDiffRepo()} },
+			statuses: []Status{StatusCreated, StatusCreated, StatusSkipped},
+			applied:  []OutOfDiff{"", OutOfDiffFile, OutOfDiffDrop},
+		},
+		{
+			// the provider can't write file comments
+			policy:   OutOfDiffFile,
+			repo:     func() Repository { return newDiffRepo() },
+			statuses: []Status{StatusCreated, StatusSkipped, StatusSkipped},
+			applied:  []OutOfDiff{"", OutOfDiffDrop, OutOfDiffDrop},
+		},
+		{
+			policy:   OutOfDiffSummary,
+			repo:     func() Repository { return newDiffRepo() },
+			statuses: []Status{StatusCreated, StatusCreated, StatusCreated},
+			applied:  []OutOfDiff{"", OutOfDiffSummary, OutOfDiffSummary},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			results, err := NewFallbackRepository(tt.repo(), FallbackOptions{Policy: tt.policy}).
+				WriteFindings(context.Background(), outsideFindings)
+			if err != nil {
+				t.Fatalf("write findings: %v", err)
+			}
+			for i, r := range results {
+				if r.Status != tt.statuses[i] || r.Fallback != tt.applied[i] {
+					t.Errorf("finding %d: expected %s with policy %q, got %s with %q (%v)", i, tt.statuses[i], tt.applied[i], r.Status, r.Fallback, r.Err)
+				}
+				if r.Finding.Path != outsideFindings[i].Path || r.Finding.StartLine != outsideFindings[i].StartLine {
+					t.Errorf("finding %d: expected the original finding to be reported, got %+v", i, r.Finding)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackRepository_NearestMovesToDiffLine(t *testing.T) {
+	repo := newDiffRepo()
+	if _, err := NewFallbackRepository(repo, FallbackOptions{Policy: OutOfDiffNearest}).
+		WriteFindings(context.Background(), outsideFindings[1:2]); err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	if len(repo.lines) != 1 || repo.lines[0] != "main.go:10" {
+		t.Fatalf("expected the finding to be moved to the first diff line, got %v", repo.lines)
+	}
+}
+
+func TestFallbackRepository_SummaryListsOutsideFindings(t *testing.T) {
+	repo := newDiffRepo()
+	findings := []Finding{
+		{Path: "main.go", StartLine: 11, EndLine: 11, Body: "in the diff"},
+		{Path: "other.go", StartLine: 3, EndLine: 3, Body: "[marker]\n**Hardcoded secret**\n<!-- aqua-meta: fp=abc -->"},
+	}
+	results, err := NewFallbackRepository(repo, FallbackOptions{Policy: OutOfDiffSummary, SummaryID: "scan"}).
+		ReconcileFindings(context.Background(), "[marker]", findings)
+	if err != nil {
+		t.Fatalf("reconcile findings: %v", err)
+	}
+	if results[1].CommentID != "summary" {
+		t.Fatalf("expected the finding to point at the summary, got %+v", results[1])
+	}
+	body := repo.summaries["scan"]
+	if !strings.Contains(body, "- `other.go:3` **Hardcoded secret**") {
+		t.Fatalf("expected the finding to be listed, got:\n%s", body)
+	}
+	if strings.Contains(body, "[marker]") || strings.Contains(body, "main.go") {
+		t.Fatalf("expected neither the marker nor the findings in the diff to be listed, got:\n%s", body)
+	}
+
+	// a finding back in the diff leaves the summary
+	if _, err := NewFallbackRepository(repo, FallbackOptions{Policy: OutOfDiffSummary, SummaryID: "scan"}).
+		ReconcileFindings(context.Background(), "[marker]", findings[:1]); err != nil {
+		t.Fatalf("reconcile findings: %v", err)
+	}
+	if body := repo.summaries["scan"]; !strings.Contains(body, "No findings outside the diff.") {
+		t.Fatalf("expected the summary to be emptied, got:\n%s", body)
+	}
+}
+
+func TestParseOutOfDiff(t *testing.T) {
+	if policy, err := ParseOutOfDiff(""); err != nil || policy != OutOfDiffDrop {
+		t.Fatalf("expected drop by default, got %q, %v", policy, err)
+	}
+	if policy, err := ParseOutOfDiff("nearest"); err != nil || policy != OutOfDiffNearest {
+		t.Fatalf("expected nearest, got %q, %v", policy, err)
+	}
+	if _, err := ParseOutOfDiff("snap"); err == nil {
+		t.Fatalf("expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,68 @@
+package commenter
+
+import (
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+const (
+	fingerprintPrefix = "<!-- aqua-fingerprint:"
+	fingerprintSuffix = "-->"
+)
+
+// EmbedFingerprint appends the fingerprint sentinel to body, unless it already
+// carries a fingerprint. Use fingerprint.Embed to attach the full metadata.
+func EmbedFingerprint(body, fp string) string {
+	if fp == "" || ExtractFingerprint(body) != "" {
+		return body
+	}
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return body + fingerprintPrefix + " " + fp + " " + fingerprintSuffix
+}
+
+// ExtractFingerprint returns the fingerprint embedded in body, either as a
+// sentinel or in a metadata block, or "" for legacy comments
+func ExtractFingerprint(body string) string {
+	m, _ := fingerprint.Parse(body)
+	return m.Fingerprint
+}
+
+// Unchanged reports whether the existing comment already renders body, in
+// which case editing it would be a no-op. The hash stored in the metadata is
+// preferred over comparing bodies, since providers may normalize what they store.
+func Unchanged(existing, body string) bool {
+	if existing == body {
+		return true
+	}
+	old, ok := fingerprint.Parse(existing)
+	if !ok || old.BodyHash == "" {
+		return false
+	}
+	current, ok := fingerprint.Parse(body)
+	if !ok {
+		return false
+	}
+	if current.BodyHash == "" {
+		current.BodyHash = fingerprint.HashBody(body)
+	}
+	return old == current
+}
+
+// NewFinding builds a finding whose body ends with the marker and carries meta
+// hidden the way the provider renders invisibly, ready to be reconciled.
+func NewFinding(path string, startLine, endLine int, body, marker string, meta fingerprint.Metadata, provider string) Finding {
+	body = strings.TrimRight(body, "\n")
+	if marker != "" && !strings.Contains(body, marker) {
+		body += "\n\n" + marker
+	}
+	return Finding{
+		Path:        path,
+		StartLine:   startLine,
+		EndLine:     endLine,
+		Body:        fingerprint.Embed(body, meta, fingerprint.StyleFor(provider)),
+		Fingerprint: meta.Fingerprint,
+	}
+}
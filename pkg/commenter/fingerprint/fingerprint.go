@@ -0,0 +1,194 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Style is how the metadata block is hidden from readers of the comment.
+type Style int
+
+const (
+	// HTMLComment hides the block in an HTML comment, for renderers that drop them
+	HTMLComment Style = iota
+	// LinkReference hides the block in an unused Markdown link reference
+	// definition, for renderers that escape HTML and would show a comment as text
+	LinkReference
+)
+
+// Provider names as used by the vendor flag of the CLI.
+const (
+	GitHub          = "github"
+	GitLab          = "gitlab"
+	Azure           = "azure"
+	Bitbucket       = "bitbucket"
+	BitbucketServer = "bitbucket-server"
+)
+
+const (
+	metaKey    = "aqua-meta:"
+	summaryKey = "aqua-summary:"
+)
+
+var (
+	htmlMetaRe      = regexp.MustCompile(`(?m)\n?<!--\s*aqua-meta:\s*([^\s]*)\s*-->`)
+	linkRefMetaRe   = regexp.MustCompile(`(?m)\n?^\[//\]: # \(aqua-meta:\s*([^\s)]*)\)$`)
+	legacySentinel  = regexp.MustCompile(`\n?<!--\s*aqua-fingerprint:\s*([0-9a-fA-F]+)\s*-->`)
+	whitespaceRunRe = regexp.MustCompile(`\s+`)
+)
+
+// Metadata is carried hidden in every Aqua comment so that later runs can
+// identify the finding behind it.
+type Metadata struct {
+	Fingerprint    string
+	RuleID         string
+	Severity       string
+	ScannerVersion string
+	// BodyHash is the hash of the visible body, see HashBody
+	BodyHash string
+}
+
+// StyleFor returns the hiding style that renders invisibly on the provider.
+// Bitbucket Server escapes HTML and Azure DevOps shows HTML comments in some
+// views, both hide unused link reference definitions.
+func StyleFor(provider string) Style {
+	switch provider {
+	case BitbucketServer, Azure:
+		return LinkReference
+	default:
+		return HTMLComment
+	}
+}
+
+// StyleOf returns the style the metadata of body is hidden with, HTMLComment
+// when it has none.
+func StyleOf(body string) Style {
+	if linkRefMetaRe.MatchString(body) {
+		return LinkReference
+	}
+	return HTMLComment
+}
+
+// Compute builds a deterministic fingerprint from the rule, the file and the
+// offending code. The line number is deliberately left out and the snippet is
+// normalized, so the fingerprint survives code moving up or down the file and
+// re-indentation.
+func Compute(ruleID, path, snippet string) string {
+	h := sha256.New()
+	h.Write([]byte(ruleID))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.TrimPrefix(path, "/")))
+	h.Write([]byte{0})
+	h.Write([]byte(NormalizeSnippet(snippet)))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// NormalizeSnippet collapses whitespace and drops blank lines.
+func NormalizeSnippet(snippet string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(snippet, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(whitespaceRunRe.ReplaceAllString(line, " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HashBody hashes the visible part of body, i.e. without any metadata block.
+func HashBody(body string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(Strip(body))))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// Embed replaces any metadata in body with m, hidden using style. BodyHash is
+// computed from body when left empty.
+func Embed(body string, m Metadata, style Style) string {
+	body = Strip(body)
+	if m.BodyHash == "" {
+		m.BodyHash = HashBody(body)
+	}
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return body + m.block(style)
+}
+
+// Parse extracts the metadata from body. Comments written before metadata
+// existed only carry the fingerprint sentinel, which is returned as well.
+func Parse(body string) (Metadata, bool) {
+	for _, re := range []*regexp.Regexp{htmlMetaRe, linkRefMetaRe} {
+		if m := re.FindStringSubmatch(body); len(m) == 2 {
+			if meta, err := decode(m[1]); err == nil {
+				return meta, true
+			}
+		}
+	}
+	if m := legacySentinel.FindStringSubmatch(body); len(m) == 2 {
+		return Metadata{Fingerprint: strings.ToLower(m[1])}, true
+	}
+	return Metadata{}, false
+}
+
+// Strip removes every metadata block and fingerprint sentinel from body.
+func Strip(body string) string {
+	for _, re := range []*regexp.Regexp{htmlMetaRe, linkRefMetaRe, legacySentinel} {
+		body = re.ReplaceAllString(body, "")
+	}
+	return body
+}
+
+func (m Metadata) block(style Style) string {
+	encoded := m.encode()
+	if style == LinkReference {
+		// The blank line keeps the definition from being read as part of a
+		// preceding paragraph.
+		return fmt.Sprintf("\n[//]: # (%s %s)", metaKey, encoded)
+	}
+	return fmt.Sprintf("<!-- %s %s -->", metaKey, encoded)
+}
+
+func (m Metadata) encode() string {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("fp", strings.ToLower(m.Fingerprint))
+	set("rule", m.RuleID)
+	set("sev", m.Severity)
+	set("ver", m.ScannerVersion)
+	set("hash", m.BodyHash)
+	// Query escaping leaves neither spaces nor parentheses, so the value can't
+	// terminate either hiding style early.
+	return v.Encode()
+}
+
+func decode(encoded string) (Metadata, error) {
+	v, err := url.ParseQuery(encoded)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return Metadata{
+		Fingerprint:    strings.ToLower(v.Get("fp")),
+		RuleID:         v.Get("rule"),
+		Severity:       v.Get("sev"),
+		ScannerVersion: v.Get("ver"),
+		BodyHash:       v.Get("hash"),
+	}, nil
+}
+
+// SummaryMarker returns the hidden marker identifying the PR-level summary
+// comment id, hidden using style.
+func SummaryMarker(id string, style Style) string {
+	id = url.QueryEscape(id)
+	if style == LinkReference {
+		return fmt.Sprintf("[//]: # (%s %s)", summaryKey, id)
+	}
+	return fmt.Sprintf("<!-- %s %s -->", summaryKey, id)
+}
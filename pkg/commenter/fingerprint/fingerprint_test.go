@@ -0,0 +1,103 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	base := Compute("AVD-AWS-0086", "main.tf", "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"public\"\n}")
+
+	if len(base) != 32 {
+		t.Fatalf("expected a 32 char fingerprint, got %q", base)
+	}
+	if got := Compute("AVD-AWS-0086", "main.tf", "resource  \"aws_s3_bucket\" \"b\" {\r\n\n\tacl = \"public\"\n}\n"); got != base {
+		t.Fatalf("whitespace changes must not change the fingerprint, got %s want %s", got, base)
+	}
+	if got := Compute("AVD-AWS-0086", "/main.tf", "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"public\"\n}"); got != base {
+		t.Fatalf("a leading slash must not change the fingerprint, got %s want %s", got, base)
+	}
+	if got := Compute("AVD-AWS-0087", "main.tf", "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"public\"\n}"); got == base {
+		t.Fatalf("a different rule must change the fingerprint")
+	}
+	if got := Compute("AVD-AWS-0086", "other.tf", "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"public\"\n}"); got == base {
+		t.Fatalf("a different path must change the fingerprint")
+	}
+}
+
+func TestEmbedParseRoundTrip(t *testing.T) {
+	meta := Metadata{
+		Fingerprint:    "DEADBEEF",
+		RuleID:         "AVD-AWS-0086",
+		Severity:       "HIGH",
+		ScannerVersion: "trivy 0.50.1 (dev)",
+	}
+	for name, style := range map[string]Style{"html comment": HTMLComment, "link reference": LinkReference} {
+		t.Run(name, func(t *testing.T) {
+			body := Embed("**Public bucket**\nfix it", meta, style)
+
+			got, ok := Parse(body)
+			if !ok {
+				t.Fatalf("no metadata found in %q", body)
+			}
+			want := meta
+			want.Fingerprint = "deadbeef"
+			want.BodyHash = HashBody("**Public bucket**\nfix it")
+			if got != want {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+			if strings.TrimSpace(Strip(body)) != "**Public bucket**\nfix it" {
+				t.Fatalf("strip left %q", Strip(body))
+			}
+			if again := Embed(body, meta, style); again != body {
+				t.Fatalf("embedding twice must be stable, got %q want %q", again, body)
+			}
+		})
+	}
+}
+
+func TestEmbed_Styles(t *testing.T) {
+	html := Embed("body", Metadata{Fingerprint: "abc"}, HTMLComment)
+	if !strings.Contains(html, "<!-- aqua-meta: fp=abc&hash=") {
+		t.Fatalf("unexpected html block %q", html)
+	}
+	ref := Embed("body", Metadata{Fingerprint: "abc"}, LinkReference)
+	if !strings.Contains(ref, "\n\n[//]: # (aqua-meta: fp=abc&hash=") || strings.Contains(ref, "<!--") {
+		t.Fatalf("unexpected link reference block %q", ref)
+	}
+}
+
+func TestParse_LegacySentinel(t *testing.T) {
+	got, ok := Parse("hello\n<!-- aqua-fingerprint: CAFEBABE -->")
+	if !ok || got.Fingerprint != "cafebabe" {
+		t.Fatalf("got %+v, %v", got, ok)
+	}
+	if _, ok := Parse("no metadata here"); ok {
+		t.Fatalf("expected no metadata")
+	}
+}
+
+func TestHashBody_IgnoresMetadata(t *testing.T) {
+	plain := HashBody("hello")
+	if got := HashBody(Embed("hello", Metadata{Fingerprint: "abc"}, LinkReference)); got != plain {
+		t.Fatalf("metadata must not change the hash, got %s want %s", got, plain)
+	}
+	if got := HashBody("hello!"); got == plain {
+		t.Fatalf("visible changes must change the hash")
+	}
+}
+
+func TestStyleFor(t *testing.T) {
+	tests := map[string]Style{
+		GitHub:          HTMLComment,
+		GitLab:          HTMLComment,
+		Bitbucket:       HTMLComment,
+		BitbucketServer: LinkReference,
+		Azure:           LinkReference,
+	}
+	for provider, want := range tests {
+		if got := StyleFor(provider); got != want {
+			t.Errorf("StyleFor(%s) = %v, want %v", provider, got, want)
+		}
+	}
+}
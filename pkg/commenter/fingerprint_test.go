@@ -0,0 +1,32 @@
+package commenter
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func TestUnchanged(t *testing.T) {
+	meta := fingerprint.Metadata{Fingerprint: "deadbeef", Severity: "HIGH"}
+	body := fingerprint.Embed("finding text", meta, fingerprint.HTMLComment)
+
+	tests := []struct {
+		name     string
+		existing string
+		body     string
+		want     bool
+	}{
+		{"identical bodies", body, body, true},
+		{"stored body normalized by the provider", "finding text\r\n" + body[len("finding text\n"):], body, true},
+		{"visible text changed", body, fingerprint.Embed("new text", meta, fingerprint.HTMLComment), false},
+		{"metadata changed", body, fingerprint.Embed("finding text", fingerprint.Metadata{Fingerprint: "deadbeef", Severity: "LOW"}, fingerprint.HTMLComment), false},
+		{"legacy sentinel bodies compared verbatim", EmbedFingerprint("a", "deadbeef"), EmbedFingerprint("b", "deadbeef"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Unchanged(tc.existing, tc.body); got != tc.want {
+				t.Fatalf("Unchanged() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
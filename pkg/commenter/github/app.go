@@ -0,0 +1,149 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/google/go-github/v44/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtLifetime stays below the 10 minutes GitHub accepts, iat is backdated
+	// by jwtClockSkew against clocks running ahead of GitHub's
+	jwtLifetime  = 9 * time.Minute
+	jwtClockSkew = time.Minute
+	// tokenRefreshMargin renews the installation tokens before they expire,
+	// they are valid for an hour
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// WithApp authenticates as the installation of the GitHub App on the
+// repository instead of with a token. privateKey is the PEM encoded key of
+// the App, its installation tokens are renewed before they expire.
+func WithApp(appID int64, privateKey []byte) Option {
+	return func(gh *Github) {
+		gh.appID = appID
+		gh.appKey = privateKey
+	}
+}
+
+// tokenSource returns the credentials of the requests, the installation
+// tokens of the App when set with WithApp, the token otherwise.
+func (c *Github) tokenSource(apiUrl string, isEnterprise bool) (oauth2.TokenSource, error) {
+	if c.appID == 0 {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.Token}), nil
+	}
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = transport.Default
+	}
+	return newInstallationTokenSource(apiUrl, isEnterprise, httpClient, c.appID, c.appKey, c.Owner, c.Repo)
+}
+
+// newInstallationTokenSource finds the installation of the App on the
+// repository and returns a source of its tokens.
+func newInstallationTokenSource(apiUrl string, isEnterprise bool, httpClient *transport.Client, appID int64, privateKey []byte, owner, repo string) (oauth2.TokenSource, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	jwt := oauth2.ReuseTokenSource(nil, &appJWTSource{appID: appID, key: key})
+	client, err := newGithubClient(apiUrl, isEnterprise, authenticate(httpClient, jwt))
+	if err != nil {
+		return nil, err
+	}
+	installation, _, err := client.Apps.FindRepositoryInstallation(context.Background(), owner, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed find the installation of app %d on %s/%s: %w", appID, owner, repo, mapError(err))
+	}
+	return oauth2.ReuseTokenSource(nil, &installationTokenSource{apps: client.Apps, id: installation.GetID()}), nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed parse app private key: no PEM data")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed parse app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("failed parse app private key: not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// appJWTSource signs the JWTs authenticating as the App itself, which only
+// gives access to its installations.
+type appJWTSource struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+func (s *appJWTSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	expiry := now.Add(jwtLifetime)
+	jwt, err := signJWT(s.key, map[string]interface{}{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": expiry.Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: jwt, TokenType: "Bearer", Expiry: expiry.Add(-jwtClockSkew)}, nil
+}
+
+// signJWT encodes the claims in a JWT signed with RS256.
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed sign app jwt: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationTokenSource creates the tokens of the installation, the
+// oauth2.ReuseTokenSource wrapping it asks for a new one once the previous
+// one is about to expire.
+type installationTokenSource struct {
+	apps *github.AppsService
+	id   int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := s.apps.CreateInstallationToken(context.Background(), s.id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed create installation token: %w", mapError(err))
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "Bearer",
+		Expiry:      token.GetExpiresAt().Add(-tokenRefreshMargin),
+	}, nil
+}
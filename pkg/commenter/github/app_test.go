@@ -0,0 +1,112 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func newAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func newFakeApp(t *testing.T, ttl time.Duration) (*fakeserver.Server, []byte) {
+	t.Helper()
+	key, pemKey := newAppKey(t)
+	s := fakeserver.New(fakeserver.GitHub)
+	s.App = &fakeserver.GitHubApp{ID: 42, Key: &key.PublicKey, InstallationID: 7, TokenTTL: ttl}
+	s.AddFile("a.go", fakePatch)
+	return s, pemKey
+}
+
+func TestApp_AuthenticatesRESTAndGraphQL(t *testing.T) {
+	s, pemKey := newFakeApp(t, 0)
+	defer s.Close()
+
+	c, err := NewGithubServer(s.APIURL(), "", fakeserver.Owner, fakeserver.Repo, fakeserver.PRNumber,
+		WithHTTPClient(s.Client()), WithApp(42, pemKey))
+	if err != nil {
+		t.Fatalf("new github: %v", err)
+	}
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{
+		conformance.Finding("a.go", 3, "deadbeef", "current run"),
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be created, got %+v", results[0])
+	}
+	if n := s.Count(http.MethodPost, "/graphql"); n == 0 {
+		t.Fatalf("expected the review threads to be queried")
+	}
+	if n := s.Count(http.MethodPost, "/access_tokens"); n != 1 {
+		t.Fatalf("expected a single installation token, got %d", n)
+	}
+}
+
+func TestApp_RefreshesExpiringTokens(t *testing.T) {
+	// tokens expiring within the refresh margin are renewed on every request
+	s, pemKey := newFakeApp(t, time.Minute)
+	defer s.Close()
+
+	c, err := NewGithubServer(s.APIURL(), "", fakeserver.Owner, fakeserver.Repo, fakeserver.PRNumber,
+		WithHTTPClient(s.Client()), WithApp(42, pemKey))
+	if err != nil {
+		t.Fatalf("new github: %v", err)
+	}
+	if _, err := c.WriteFindings(context.Background(), []commenter.Finding{
+		conformance.Finding("a.go", 2, "one", "first"),
+		conformance.Finding("a.go", 3, "two", "second"),
+	}); err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	if n := s.Count(http.MethodPost, "/access_tokens"); n < 2 {
+		t.Fatalf("expected the token to be renewed, got %d tokens", n)
+	}
+	if n := len(s.Comments()); n != 2 {
+		t.Fatalf("expected 2 comments, got %d", n)
+	}
+}
+
+func TestApp_WrongKeyIsUnauthorized(t *testing.T) {
+	s, _ := newFakeApp(t, 0)
+	defer s.Close()
+	_, otherKey := newAppKey(t)
+
+	_, err := NewGithubServer(s.APIURL(), "", fakeserver.Owner, fakeserver.Repo, fakeserver.PRNumber,
+		WithHTTPClient(s.Client()), WithApp(42, otherKey))
+	if !errors.Is(err, commenter.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, _ := newAppKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	parsed, err := parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil || !parsed.Equal(key) {
+		t.Fatalf("expected the PKCS8 key to be parsed, got %v", err)
+	}
+	if _, err := parsePrivateKey([]byte("not a key")); err == nil {
+		t.Fatalf("expected an error without PEM data")
+	}
+}
@@ -1,31 +1,24 @@
 package github
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 	"github.com/samber/lo"
 )
 
-type chunkLines struct {
-	Start int
-	End   int
-}
-
 type commitFileInfo struct {
 	FileName     string
-	ChunkLines   []chunkLines
+	ChunkLines   []diff.Hunk
 	sha          string
 	likelyBinary bool
 }
 
-func (cl *chunkLines) Contains(line int) bool {
-	return line >= cl.Start && line <= cl.End
-}
+func getCommitFileInfo(ctx context.Context, ghConnector *connector) ([]*commitFileInfo, error) {
 
-func getCommitFileInfo(ghConnector *connector) ([]*commitFileInfo, error) {
-
-	prFiles, err := ghConnector.getFilesForPr()
+	prFiles, err := ghConnector.getFilesForPr(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +43,7 @@ func getCommitFileInfo(ghConnector *connector) ([]*commitFileInfo, error) {
 }
 
 func (cfi commitFileInfo) calculatePosition(line int) *int {
-	ch, _ := lo.Find(cfi.ChunkLines, func(lines chunkLines) bool {
+	ch, _ := lo.Find(cfi.ChunkLines, func(lines diff.Hunk) bool {
 		return lines.Contains(line)
 	})
 
@@ -58,6 +51,20 @@ func (cfi commitFileInfo) calculatePosition(line int) *int {
 	return &position
 }
 
+// inOneChunk reports whether a single chunk covers the lines, which a
+// suggestion can then replace.
+func (cfi commitFileInfo) inOneChunk(startLine, endLine int) bool {
+	return lo.ContainsBy(cfi.ChunkLines, func(lines diff.Hunk) bool {
+		return lines.Contains(startLine) && lines.Contains(endLine)
+	})
+}
+
+// nearestLine returns the line of the diff closest to line, the earliest one
+// on a tie, or 0 when the diff of the file has no line.
+func (cfi commitFileInfo) nearestLine(line int) int {
+	return diff.Nearest(cfi.ChunkLines, line)
+}
+
 func (cfi commitFileInfo) isBinary() bool {
 	return cfi.likelyBinary
 }
@@ -2,21 +2,29 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
 	"github.com/google/go-github/v44/github"
 	"golang.org/x/oauth2"
 )
 
-const githubAbuseErrorRetries = 6
-
 type connector struct {
-	prs      *github.PullRequestsService
-	comments *github.IssuesService
-	owner    string
-	repo     string
-	prNumber int
+	client *github.Client
+	// enterpriseVersion is the release of GitHub Enterprise Server, empty on
+	// github.com
+	enterpriseVersion string
+	prs               *github.PullRequestsService
+	comments          *github.IssuesService
+	http              *transport.Client
+	owner             string
+	repo              string
+	prNumber          int
 }
 
 type existingComment struct {
@@ -25,33 +33,51 @@ type existingComment struct {
 	commentId *int64
 }
 
-type commentFn func() (*github.Response, error)
-
 // create github connector and check if supplied pr number exists
-func createConnector(apiUrl, token, owner, repo string, prNumber int, isEnterprise bool) (*connector, error) {
-
-	client, err := newGithubClient(apiUrl, token, isEnterprise)
+func createConnector(apiUrl string, source oauth2.TokenSource, owner, repo string, prNumber int, isEnterprise bool, httpClient *transport.Client) (*connector, error) {
+	if httpClient == nil {
+		httpClient = transport.Default
+	}
+	httpClient = authenticate(httpClient, source)
+	client, err := newGithubClient(apiUrl, isEnterprise, httpClient)
 	if err != nil {
 		return nil, err
 	}
-	if _, _, err := client.PullRequests.Get(context.Background(), owner, repo, prNumber); err != nil {
-		return nil, newPrDoesNotExistError(owner, repo, prNumber)
+	_, resp, err := client.PullRequests.Get(context.Background(), owner, repo, prNumber)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, newPrDoesNotExistError(owner, repo, prNumber, err)
+		}
+		return nil, mapError(err)
 	}
 
 	return &connector{
-		prs:      client.PullRequests,
-		comments: client.Issues,
-		owner:    owner,
-		repo:     repo,
-		prNumber: prNumber,
+		client:            client,
+		enterpriseVersion: resp.Header.Get(enterpriseVersionHeader),
+		prs:               client.PullRequests,
+		comments:          client.Issues,
+		http:              httpClient,
+		owner:             owner,
+		repo:              repo,
+		prNumber:          prNumber,
 	}, nil
 }
 
-func newGithubClient(apiUrl, token string, isEnterprise bool) (*github.Client, error) {
+// authenticate returns a copy of httpClient sending a token of the source
+// with every attempt, shared by the REST and GraphQL requests.
+func authenticate(httpClient *transport.Client, source oauth2.TokenSource) *transport.Client {
+	authed := *httpClient
+	authed.Transport = &oauth2.Transport{
+		Source: source,
+		Base:   httpClient.Transport,
+	}
+	return &authed
+}
 
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
+// newGithubClient sends the requests with the transport, which retries them
+// once the rate limit is lifted.
+func newGithubClient(apiUrl string, isEnterprise bool, httpClient *transport.Client) (*github.Client, error) {
+	tc := httpClient.HTTPClient()
 
 	if isEnterprise {
 		return github.NewEnterpriseClient(apiUrl, apiUrl, tc)
@@ -60,77 +86,127 @@ func newGithubClient(apiUrl, token string, isEnterprise bool) (*github.Client, e
 	return github.NewClient(tc), nil
 }
 
-func (c *connector) writeReviewComment(block *github.PullRequestComment, commentId *int64) error {
-
-	ctx := context.Background()
-	if commentId != nil {
-		return writeCommentWithRetries(c.owner, c.repo, c.prNumber, func() (*github.Response, error) {
-			_, resp, err := c.prs.EditComment(ctx, c.owner, c.repo, *commentId, &github.PullRequestComment{
-				Body: block.Body,
-			})
-			return resp, err
-		})
-	}
-
-	return writeCommentWithRetries(c.owner, c.repo, c.prNumber, func() (*github.Response, error) {
-		_, resp, err := c.prs.CreateComment(ctx, c.owner, c.repo, c.prNumber, block)
-		return resp, err
-	})
+func (c *connector) httpClient() *transport.Client {
+	return commenter.HTTPClient(c.http)
 }
 
-func writeCommentWithRetries(owner, repo string, prNumber int, commentFn commentFn) error {
-
-	var abuseError AbuseRateLimitError
-	for i := 0; i < githubAbuseErrorRetries; i++ {
-
-		retrySeconds := i * i
-		time.Sleep(time.Second * time.Duration(retrySeconds))
-
-		if resp, err := commentFn(); err != nil {
-			// If we get a 403 or 422, we are being rate or abuse limited by GitHub,
-			// and we want to retry, while increasing the wait time between retries.
-			if resp != nil && (resp.StatusCode == 422 || resp.StatusCode == 403) {
-				abuseError = newAbuseRateLimitError(owner, repo, prNumber, retrySeconds)
-				continue
-			}
-			return fmt.Errorf("write comment: %v", err)
+func (c *connector) writeReviewComment(ctx context.Context, block *github.PullRequestComment) (*github.PullRequestComment, error) {
+	written, _, err := c.prs.CreateComment(ctx, c.owner, c.repo, c.prNumber, block)
+	if err != nil {
+		if outsideDiff(err) {
+			return nil, commenter.NotInDiffError{Path: block.GetPath(), Line: block.GetLine(), Err: err}
 		}
-		return nil
+		return nil, fmt.Errorf("write comment: %w", mapError(err))
 	}
-	return abuseError
+	return written, nil
 }
 
-func (c *connector) getFilesForPr() ([]*github.CommitFile, error) {
+// fileComment is a review comment on a file rather than on its lines, which
+// go-github doesn't model.
+type fileComment struct {
+	Body        string `json:"body"`
+	Path        string `json:"path"`
+	CommitID    string `json:"commit_id"`
+	SubjectType string `json:"subject_type"`
+}
 
-	files, _, err := c.prs.ListFiles(context.Background(), c.owner, c.repo, c.prNumber, nil)
+func (c *connector) writeFileComment(ctx context.Context, path, body, commitID string) (*github.PullRequestComment, error) {
+	req, err := c.client.NewRequest(http.MethodPost, fmt.Sprintf("repos/%s/%s/pulls/%d/comments", c.owner, c.repo, c.prNumber),
+		&fileComment{Body: body, Path: path, CommitID: commitID, SubjectType: "file"})
 	if err != nil {
 		return nil, err
 	}
+	written := new(github.PullRequestComment)
+	if _, err := c.client.Do(ctx, req, written); err != nil {
+		if outsideDiff(err) {
+			return nil, commenter.NotInDiffError{Path: path, Err: err}
+		}
+		return nil, fmt.Errorf("write file comment: %w", mapError(err))
+	}
+	return written, nil
+}
 
-	var commitFiles []*github.CommitFile
-	for _, file := range files {
-		if *file.Status != "deleted" {
-			commitFiles = append(commitFiles, file)
+// mapError maps the errors of go-github, returned once the transport gave up
+// on retrying the request, onto the commenter errors.
+func mapError(err error) error {
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return commenter.RateLimitError{RetryAfter: abuseErr.GetRetryAfter(), Err: err}
+	}
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		retryAfter := time.Until(rateErr.Rate.Reset.Time)
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		return commenter.RateLimitError{RetryAfter: retryAfter, Err: err}
+	}
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		return commenter.ResponseError(err, respErr.Response.StatusCode, respErr.Response.Header, respErr.Error())
+	}
+	return err
+}
+
+// outsideDiff tells a review comment GitHub rejected as its line can't be
+// resolved against the diff.
+func outsideDiff(err error) bool {
+	var respErr *github.ErrorResponse
+	if !errors.As(err, &respErr) || respErr.Response == nil || respErr.Response.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e.Message, "could not be resolved") || strings.Contains(e.Message, "part of the diff") {
+			return true
 		}
 	}
-	return commitFiles, nil
+	return false
 }
 
-func (c *connector) getExistingComments() ([]*existingComment, error) {
+// listPageSize is the largest page GitHub serves, the default of 30 would
+// take more requests on large PRs
+const listPageSize = 100
 
-	ctx := context.Background()
-	comments, _, err := c.prs.ListComments(ctx, c.owner, c.repo, c.prNumber, &github.PullRequestListCommentsOptions{})
-	if err != nil {
-		return nil, err
+// getFilesForPr lists every file of the PR, deleted files excluded
+func (c *connector) getFilesForPr(ctx context.Context) ([]*github.CommitFile, error) {
+	var commitFiles []*github.CommitFile
+	opts := &github.ListOptions{PerPage: listPageSize}
+	for {
+		files, resp, err := c.prs.ListFiles(ctx, c.owner, c.repo, c.prNumber, opts)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		for _, file := range files {
+			if file.GetStatus() != "deleted" {
+				commitFiles = append(commitFiles, file)
+			}
+		}
+		if resp.NextPage == 0 {
+			return commitFiles, nil
+		}
+		opts.Page = resp.NextPage
 	}
+}
 
+// getExistingComments lists every review comment of the PR
+func (c *connector) getExistingComments(ctx context.Context) ([]*existingComment, error) {
 	var existingComments []*existingComment
-	for _, comment := range comments {
-		existingComments = append(existingComments, &existingComment{
-			filename:  comment.Path,
-			comment:   comment.Body,
-			commentId: comment.ID,
-		})
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: listPageSize}}
+	for {
+		comments, resp, err := c.prs.ListComments(ctx, c.owner, c.repo, c.prNumber, opts)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		for _, comment := range comments {
+			existingComments = append(existingComments, &existingComment{
+				filename:  comment.Path,
+				comment:   comment.Body,
+				commentId: comment.ID,
+			})
+		}
+		if resp.NextPage == 0 {
+			return existingComments, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	return existingComments, nil
 }
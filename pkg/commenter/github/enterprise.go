@@ -0,0 +1,98 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+// enterpriseVersionHeader carries the release of GitHub Enterprise Server in
+// every API response, github.com doesn't send it
+const enterpriseVersionHeader = "X-GitHub-Enterprise-Version"
+
+// The first GitHub Enterprise Server release whose review threads have the
+// line fields reconciliation matches comments with
+const (
+	minThreadsMajor = 3
+	minThreadsMinor = 0
+)
+
+// graphQLEndpoint derives the GraphQL endpoint from the base URL of the REST
+// API: https://ghe.example.com/api/v3/ serves it at /api/graphql, github.com
+// at https://api.github.com/graphql.
+func graphQLEndpoint(apiUrl *url.URL) string {
+	if apiUrl == nil {
+		return defaultGraphQLEndpoint
+	}
+	u := *apiUrl
+	path := strings.TrimSuffix(u.Path, "/")
+	if strings.HasSuffix(path, "/api/v3") {
+		u.Path = strings.TrimSuffix(path, "/v3") + "/graphql"
+	} else {
+		u.Path = path + "/graphql"
+	}
+	return u.String()
+}
+
+// supportsReviewThreads tells whether the server has the review threads
+// reconciliation needs, always true on github.com and on versions that can't
+// be parsed.
+func (c *connector) supportsReviewThreads() bool {
+	if c.enterpriseVersion == "" {
+		return true
+	}
+	parts := strings.SplitN(c.enterpriseVersion, ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return true
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return true
+	}
+	return major > minThreadsMajor || (major == minThreadsMajor && minor >= minThreadsMinor)
+}
+
+// gqlError holds the errors of a GraphQL response.
+type gqlError struct {
+	Messages []string
+}
+
+func (e gqlError) Error() string {
+	return "graphql: " + strings.Join(e.Messages, "; ")
+}
+
+// unsupportedSchema tells a query rejected as it asks for fields the schema of
+// the server doesn't have yet.
+func unsupportedSchema(err error) bool {
+	var gqlErr gqlError
+	if !errors.As(err, &gqlErr) {
+		return false
+	}
+	for _, msg := range gqlErr.Messages {
+		if strings.Contains(msg, "doesn't exist on type") {
+			return true
+		}
+	}
+	return false
+}
+
+// repost reconciles without review threads, like the providers without a
+// reconciler do: the Aqua comments are removed and the findings written again.
+func (c *Github) repost(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	if c.ghConnector.enterpriseVersion != "" {
+		fmt.Printf("GitHub Enterprise Server %s doesn't support review threads, reposting the comments\n", c.ghConnector.enterpriseVersion)
+	}
+	if err := c.RemoveAquaComments(ctx, marker); err != nil {
+		return commenter.FailFindings(current, err), err
+	}
+	return c.WriteFindings(ctx, current)
+}
@@ -0,0 +1,40 @@
+package github
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestGraphQLEndpoint(t *testing.T) {
+	for apiUrl, want := range map[string]string{
+		"https://ghe.example.com/api/v3/":    "https://ghe.example.com/api/graphql",
+		"https://ghe.example.com/api/v3":     "https://ghe.example.com/api/graphql",
+		"https://example.com/github/api/v3/": "https://example.com/github/api/graphql",
+		"https://api.github.com/":            "https://api.github.com/graphql",
+	} {
+		u, err := url.Parse(apiUrl)
+		if err != nil {
+			t.Fatalf("parse %s: %v", apiUrl, err)
+		}
+		if got := graphQLEndpoint(u); got != want {
+			t.Errorf("%s: expected %s, got %s", apiUrl, want, got)
+		}
+	}
+	if got := graphQLEndpoint(nil); got != defaultGraphQLEndpoint {
+		t.Errorf("expected github.com without an API URL, got %s", got)
+	}
+}
+
+func TestSupportsReviewThreads(t *testing.T) {
+	for version, want := range map[string]bool{
+		"":        true,
+		"2.22.9":  false,
+		"3.0.0":   true,
+		"3.11.2":  true,
+		"unknown": true,
+	} {
+		if got := (&connector{enterpriseVersion: version}).supportsReviewThreads(); got != want {
+			t.Errorf("%q: expected %v, got %v", version, want, got)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package github
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
 
 // CommentAlreadyWrittenError returned when the error can't be written as it already exists
 type CommentAlreadyWrittenError struct {
@@ -9,19 +14,15 @@ type CommentAlreadyWrittenError struct {
 }
 
 // CommentNotValidError returned when the comment is for a file or line not in the pr
-type CommentNotValidError struct {
-	filepath string
-	lineNo   int
-}
+type CommentNotValidError = commenter.NotInDiffError
 
-// PrDoesNotExistError returned when the PR can't be found, either as 401 or not existing
-type PrDoesNotExistError struct {
-	owner    string
-	repo     string
-	prNumber int
-}
+// PrDoesNotExistError returned when the PR can't be found
+type PrDoesNotExistError = commenter.PrNotFoundError
 
 // AbuseRateLimitError return when the GitHub abuse rate limit is hit
+//
+// Deprecated: rate limits are retried by the transport and then reported as a
+// commenter.RateLimitError.
 type AbuseRateLimitError struct {
 	owner            string
 	repo             string
@@ -33,30 +34,26 @@ func (e CommentAlreadyWrittenError) Error() string {
 	return fmt.Sprintf("The file [%s] already has the comment written [%s]", e.filepath, e.comment)
 }
 
-func newCommentNotValidError(filepath string, line int) CommentNotValidError {
+// NewCommentNotValidError is returned for a line outside the diff of the file
+func NewCommentNotValidError(filepath string, line int) CommentNotValidError {
 	return CommentNotValidError{
-		filepath: filepath,
-		lineNo:   line,
+		Path: filepath,
+		Line: line,
 	}
 }
 
-func (e CommentNotValidError) Error() string {
-	return fmt.Sprintf("There is nothing to comment on at line [%d] in file [%s]", e.lineNo, e.filepath)
-}
-
-func newPrDoesNotExistError(owner, repo string, prNumber int) PrDoesNotExistError {
+func newPrDoesNotExistError(owner, repo string, prNumber int, err error) PrDoesNotExistError {
 	return PrDoesNotExistError{
-		owner:    owner,
-		repo:     repo,
-		prNumber: prNumber,
+		Repo:     owner + "/" + repo,
+		PrNumber: strconv.Itoa(prNumber),
+		Err:      err,
 	}
 }
 
-func (e PrDoesNotExistError) Error() string {
-	return fmt.Sprintf("PR number [%d] not found for %s/%s", e.prNumber, e.owner, e.repo)
-}
-
-func newAbuseRateLimitError(owner, repo string, prNumber, backoffInSeconds int) AbuseRateLimitError {
+// NewAbuseRateLimitError is returned once the retries on the abuse rate limit are exhausted
+//
+// Deprecated: use commenter.RateLimitError.
+func NewAbuseRateLimitError(owner, repo string, prNumber, backoffInSeconds int) AbuseRateLimitError {
 	return AbuseRateLimitError{
 		owner:            owner,
 		repo:             repo,
@@ -68,3 +65,7 @@ func newAbuseRateLimitError(owner, repo string, prNumber, backoffInSeconds int)
 func (e AbuseRateLimitError) Error() string {
 	return fmt.Sprintf("Abuse limit reached on PR [%d] not found for %s/%s", e.prNumber, e.owner, e.repo)
 }
+
+func (e AbuseRateLimitError) Is(target error) bool {
+	return target == commenter.ErrRateLimited
+}
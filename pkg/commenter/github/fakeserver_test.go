@@ -0,0 +1,287 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+const fakePatch = "@@ -1,5 +1,10 @@\n a\n+b\n+c\n+d\n+e\n+f\n g\n h\n i\n j\n"
+
+func newFakeGithub(t *testing.T, s *fakeserver.Server) *Github {
+	t.Helper()
+	c, err := NewGithubServer(s.APIURL(), "token", fakeserver.Owner, fakeserver.Repo, fakeserver.PRNumber, WithHTTPClient(s.Client()))
+	if err != nil {
+		t.Fatalf("new github: %v", err)
+	}
+	return c
+}
+
+func TestFakeServer_BatchReview(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+
+	c := newFakeGithub(t, s)
+	c.BatchReviews = true
+	results, err := c.WriteFindings(context.Background(), []commenter.Finding{
+		conformance.Finding("a.go", 2, "deadbeef", "first"),
+		conformance.Finding("a.go", 6, "cafebabe", "second"),
+	})
+	if err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	if counts := commenter.Summarize(results); counts[commenter.StatusCreated] != 2 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if n := s.Reviews(); n != 1 {
+		t.Fatalf("expected one review, got %d", n)
+	}
+	if n := len(s.Comments()); n != 2 {
+		t.Fatalf("expected 2 comments, got %d", n)
+	}
+}
+
+func TestFakeServer_UpsertSummary(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+
+	c := newFakeGithub(t, s)
+	for i, want := range []commenter.Status{commenter.StatusCreated, commenter.StatusUnchanged, commenter.StatusEdited} {
+		body := "totals"
+		if i == 2 {
+			body = "new totals"
+		}
+		if result := c.UpsertSummary(context.Background(), "scan", body); result.Status != want {
+			t.Fatalf("run %d: expected %s, got %+v", i, want, result)
+		}
+	}
+	if comments := s.Comments(); len(comments) != 1 || !strings.Contains(comments[0].Body, "new totals") {
+		t.Fatalf("unexpected comments %+v", comments)
+	}
+}
+
+func TestFakeServer_RetriesSecondaryRateLimit(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.Inject(fakeserver.Fault{Method: http.MethodPost, Path: "/pulls/7/comments", Status: http.StatusForbidden,
+		Body: `{"message":"You have exceeded a secondary rate limit."}`, Header: http.Header{"Retry-After": {"60"}}, Times: 1})
+
+	result := newFakeGithub(t, s).WriteFinding(context.Background(), conformance.Finding("a.go", 3, "deadbeef", "first"))
+	if result.Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be written once the limit is lifted, got %+v", result)
+	}
+	if sleeps := s.Sleeps(); len(sleeps) != 1 || sleeps[0] != time.Minute {
+		t.Fatalf("expected to wait as asked by Retry-After, got %v", sleeps)
+	}
+}
+
+func TestFakeServer_RejectedCommentIsNotRetried(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.Inject(fakeserver.Fault{Method: http.MethodPost, Path: "/pulls/7/comments", Status: http.StatusUnprocessableEntity,
+		Body: `{"message":"Validation Failed"}`})
+
+	result := newFakeGithub(t, s).WriteFinding(context.Background(), conformance.Finding("a.go", 3, "deadbeef", "first"))
+	if result.Status != commenter.StatusFailed {
+		t.Fatalf("expected the finding to fail, got %+v", result)
+	}
+	if n := s.Count(http.MethodPost, "/pulls/7/comments"); n != 1 {
+		t.Fatalf("expected a single attempt, got %d", n)
+	}
+}
+
+func TestFakeServer_OutOfDiffFallback(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+
+	ctx := context.Background()
+	results, err := commenter.NewFallbackRepository(newFakeGithub(t, s), commenter.FallbackOptions{Policy: commenter.OutOfDiffNearest}).
+		WriteFindings(ctx, []commenter.Finding{conformance.Finding("a.go", 40, "deadbeef", "below the diff")})
+	if err != nil {
+		t.Fatalf("nearest: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated || results[0].Fallback != commenter.OutOfDiffNearest {
+		t.Fatalf("expected the finding to be moved, got %+v", results[0])
+	}
+
+	results, err = commenter.NewFallbackRepository(newFakeGithub(t, s), commenter.FallbackOptions{Policy: commenter.OutOfDiffFile}).
+		WriteFindings(ctx, []commenter.Finding{conformance.Finding("a.go", 40, "cafebabe", "on the file")})
+	if err != nil {
+		t.Fatalf("file: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated || results[0].Fallback != commenter.OutOfDiffFile || results[0].CommentID == "" {
+		t.Fatalf("expected a file comment, got %+v", results[0])
+	}
+
+	threads := s.Threads()
+	if len(threads) != 2 || threads[0].Line != 10 || threads[1].Line != 0 || threads[1].Path != "a.go" {
+		t.Fatalf("expected a comment on the last diff line and one on the file, got %+v", threads)
+	}
+}
+
+func TestFakeServer_PagesFilesAndComments(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.PageSize = 2
+	for _, path := range []string{"a.go", "b.go", "c.go", "d.go", "e.go"} {
+		s.AddFile(path, fakePatch)
+		s.AddThread(fakeserver.Thread{Path: path, Line: 2, Comments: []fakeserver.Comment{{Body: "on " + path}}})
+	}
+
+	c := newFakeGithub(t, s)
+	if n := s.Count(http.MethodGet, "/files") + s.Count(http.MethodGet, "/comments"); n != 0 {
+		t.Fatalf("expected nothing to be listed before it is needed, got %d requests", n)
+	}
+
+	ctx := context.Background()
+	if result := c.WriteFinding(ctx, commenter.Finding{Path: "e.go", StartLine: 2, EndLine: 2, Body: "on e.go"}); result.Status != commenter.StatusUnchanged {
+		t.Fatalf("expected the comment on the last page to be found, got %+v", result)
+	}
+	if result := c.WriteFinding(ctx, commenter.Finding{Path: "e.go", StartLine: 3, EndLine: 3, Body: "new"}); result.Status != commenter.StatusCreated {
+		t.Fatalf("expected the file on the last page to be in the diff, got %+v", result)
+	}
+	if n := s.Count(http.MethodGet, "/files"); n != 3 {
+		t.Fatalf("expected the 3 pages of files to be listed once, got %d", n)
+	}
+	if n := s.Count(http.MethodGet, "/comments"); n != 3 {
+		t.Fatalf("expected the 3 pages of comments to be listed once, got %d", n)
+	}
+}
+
+func TestFakeServer_RemoveOnlyListsComments(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.AddThread(fakeserver.Thread{Path: "a.go", Line: 2, Comments: []fakeserver.Comment{{Body: aquaBody("old")}}})
+
+	if err := newFakeGithub(t, s).RemovePreviousAquaComments(testMarker); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if n := s.Count(http.MethodGet, "/files"); n != 0 {
+		t.Fatalf("expected the files not to be listed, got %d requests", n)
+	}
+	if n := len(s.Comments()); n != 0 {
+		t.Fatalf("expected the comment to be removed, got %d", n)
+	}
+}
+
+func TestFakeServer_PagesThreadComments(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.PageSize = 2
+	s.AddFile("a.go", fakePatch)
+	s.AddThread(fakeserver.Thread{Path: "a.go", Line: 2, Comments: []fakeserver.Comment{
+		{Body: "why is this flagged?"},
+		{Body: "see the docs"},
+		{Body: "still unsure"},
+		{Body: aquaBody("stale finding, reposted in the discussion")},
+		{Body: "thanks"},
+	}})
+
+	if _, err := newFakeGithub(t, s).ReconcileFindings(context.Background(), testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if n := s.Count(http.MethodPost, "/graphql"); n != 3 {
+		t.Fatalf("expected the threads and 2 more pages of comments to be queried, got %d", n)
+	}
+	for _, c := range s.Comments() {
+		if strings.Contains(c.Body, testMarker) {
+			t.Fatalf("expected the Aqua comment past the first page to be deleted, got %+v", s.Comments())
+		}
+	}
+	if n := len(s.Comments()); n != 4 {
+		t.Fatalf("expected the other comments to be kept, got %d", n)
+	}
+}
+
+func TestFakeServer_EnterpriseWithoutReviewThreadsReposts(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.EnterpriseVersion = "2.22.9"
+	s.AddFile("a.go", fakePatch)
+	s.AddThread(fakeserver.Thread{Path: "a.go", Line: 2, Comments: []fakeserver.Comment{{Body: aquaBody("previous run")}}})
+
+	results, err := newFakeGithub(t, s).ReconcileFindings(context.Background(), testMarker, []commenter.Finding{
+		conformance.Finding("a.go", 3, "deadbeef", "current run"),
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be reposted, got %+v", results[0])
+	}
+	if n := s.Count(http.MethodPost, "/graphql"); n != 0 {
+		t.Fatalf("expected no GraphQL query, got %d", n)
+	}
+	comments := s.Comments()
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, "current run") {
+		t.Fatalf("expected only the reposted comment, got %+v", comments)
+	}
+}
+
+func TestFakeServer_SchemaWithoutThreadFieldsReposts(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.EnterpriseVersion = "3.4.0"
+	s.AddFile("a.go", fakePatch)
+	s.Inject(fakeserver.Fault{
+		Method: http.MethodPost, Path: "/api/graphql", Status: http.StatusOK,
+		Body: `{"errors":[{"message":"Field 'startLine' doesn't exist on type 'PullRequestReviewThread'"}]}`,
+	})
+
+	results, err := newFakeGithub(t, s).ReconcileFindings(context.Background(), testMarker, []commenter.Finding{
+		conformance.Finding("a.go", 3, "deadbeef", "current run"),
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if results[0].Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be reposted, got %+v", results[0])
+	}
+}
+
+func TestFakeServer_Suggestion(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitHub)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.AddFile("b.go", "@@ -1,2 +1,3 @@\n a\n+b\n c\n@@ -10,2 +11,3 @@\n x\n+y\n z\n")
+
+	c := newFakeGithub(t, s)
+	ctx := context.Background()
+	inHunk := conformance.Finding("a.go", 3, "deadbeef", "outdated")
+	inHunk.EndLine = 4
+	inHunk.Suggestion = "fixed"
+	acrossHunks := conformance.Finding("b.go", 3, "cafebabe", "outdated")
+	acrossHunks.EndLine = 11
+	acrossHunks.Suggestion = "fixed"
+	if _, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{inHunk, acrossHunks}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	comments := s.Comments()
+	if len(comments) != 2 || !strings.Contains(comments[0].Body, "```suggestion\nfixed\n```") ||
+		!strings.Contains(comments[1].Body, "```diff\n+fixed\n```") {
+		t.Fatalf("expected a suggestion block in the hunk and a diff block across hunks, got %+v", comments)
+	}
+
+	inHunk.Suggestion = "fixed again"
+	results, err := c.ReconcileFindings(ctx, testMarker, []commenter.Finding{inHunk, acrossHunks})
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if results[0].Status != commenter.StatusEdited || results[1].Status != commenter.StatusUnchanged {
+		t.Fatalf("expected only the changed suggestion to be edited, got %+v", results)
+	}
+	if results[0].Finding.Body != inHunk.Body {
+		t.Fatalf("expected the finding to be reported as given, got %q", results[0].Finding.Body)
+	}
+}
@@ -8,21 +8,34 @@ import (
 	"strings"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 	"github.com/google/go-github/v44/github"
 	"github.com/samber/lo"
 )
 
 type Github struct {
-	ghConnector      *connector
-	existingComments []*existingComment
-	files            []*commitFileInfo
-	Token            string
-	Owner            string
-	Repo             string
-	PrNumber         int
-
-	// GraphQLEndpoint is overridable for tests / future GHE support.
+	ghConnector *connector
+	httpClient  *transport.Client
+	// files and comments are loaded on first need, see loadFiles and loadComments
+	files    map[string]*commitFileInfo
+	comments *commentIndex
+	// appID and appKey authenticate as a GitHub App, see WithApp
+	appID    int64
+	appKey   []byte
+	Token    string
+	Owner    string
+	Repo     string
+	PrNumber int
+
+	// GraphQLEndpoint overrides the endpoint derived from the API URL, see
+	// graphQLEndpoint.
 	GraphQLEndpoint string
+
+	// BatchReviews submits new comments as pull request reviews instead of
+	// posting them one by one, see WriteFindings.
+	BatchReviews bool
 }
 
 var (
@@ -30,63 +43,64 @@ var (
 	commitRefRegex = regexp.MustCompile(".+ref=(.+)")
 )
 
-func NewGithub(token, owner, repo string, prNumber int) (gh *Github, err error) {
-	if len(token) == 0 {
-		return gh, fmt.Errorf("failed GITHUB_TOKEN has not been set")
+// Option configures the Github returned by NewGithub and NewGithubServer
+type Option func(*Github)
+
+// WithHTTPClient sends the requests of the Github with the client instead of transport.Default
+func WithHTTPClient(client *transport.Client) Option {
+	return func(gh *Github) {
+		gh.httpClient = client
 	}
-	ghConnector, err := createConnector("", token, owner, repo, prNumber, false)
-	if err != nil {
-		return gh, fmt.Errorf("failed create github connector: %w", err)
+}
+
+// WithBatchReviews submits new comments as pull request reviews, see BatchReviews
+func WithBatchReviews() Option {
+	return func(gh *Github) {
+		gh.BatchReviews = true
 	}
-	commitFileInfos, existingComments, err := loadPr(ghConnector)
-	if err != nil {
-		return nil, fmt.Errorf("failed load pr: %w", err)
-	}
-	return &Github{
-		Token:            token,
-		Owner:            owner,
-		PrNumber:         prNumber,
-		Repo:             repo,
-		ghConnector:      ghConnector,
-		files:            commitFileInfos,
-		existingComments: existingComments,
-	}, nil
 }
 
-func NewGithubServer(apiUrl, token, owner, repo string, prNumber int) (gh *Github, err error) {
-	if len(token) == 0 {
-		return gh, fmt.Errorf("failed GITHUB_TOKEN has not been set, for github Enterprise")
+func NewGithub(token, owner, repo string, prNumber int, opts ...Option) (gh *Github, err error) {
+	gh = newGithub(token, owner, repo, prNumber, opts)
+	if len(token) == 0 && gh.appID == 0 {
+		return nil, fmt.Errorf("failed GITHUB_TOKEN has not been set")
 	}
-	ghConnector, err := createConnector(apiUrl, token, owner, repo, prNumber, true)
+	source, err := gh.tokenSource("", false)
 	if err != nil {
-		return gh, fmt.Errorf("failed create github connector, for github Enterprise: %w", err)
+		return nil, fmt.Errorf("failed authenticate github app: %w", err)
 	}
-	commitFileInfos, existingComments, err := loadPr(ghConnector)
-	if err != nil {
-		return nil, fmt.Errorf("failed load pr, for github Enterprise: %w", err)
-	}
-	return &Github{
-		Token:            token,
-		Owner:            owner,
-		PrNumber:         prNumber,
-		Repo:             repo,
-		ghConnector:      ghConnector,
-		files:            commitFileInfos,
-		existingComments: existingComments,
-	}, nil
+	if gh.ghConnector, err = createConnector("", source, owner, repo, prNumber, false, gh.httpClient); err != nil {
+		return nil, fmt.Errorf("failed create github connector: %w", err)
+	}
+	return gh, nil
 }
-func loadPr(ghConnector *connector) ([]*commitFileInfo, []*existingComment, error) {
 
-	commitFileInfos, err := getCommitFileInfo(ghConnector)
+func NewGithubServer(apiUrl, token, owner, repo string, prNumber int, opts ...Option) (gh *Github, err error) {
+	gh = newGithub(token, owner, repo, prNumber, opts)
+	if len(token) == 0 && gh.appID == 0 {
+		return nil, fmt.Errorf("failed GITHUB_TOKEN has not been set, for github Enterprise")
+	}
+	source, err := gh.tokenSource(apiUrl, true)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("failed authenticate github app, for github Enterprise: %w", err)
 	}
+	if gh.ghConnector, err = createConnector(apiUrl, source, owner, repo, prNumber, true, gh.httpClient); err != nil {
+		return nil, fmt.Errorf("failed create github connector, for github Enterprise: %w", err)
+	}
+	return gh, nil
+}
 
-	existingComments, err := ghConnector.getExistingComments()
-	if err != nil {
-		return nil, nil, err
+func newGithub(token, owner, repo string, prNumber int, opts []Option) *Github {
+	gh := &Github{
+		Token:    token,
+		Owner:    owner,
+		PrNumber: prNumber,
+		Repo:     repo,
 	}
-	return commitFileInfos, existingComments, nil
+	for _, opt := range opts {
+		opt(gh)
+	}
+	return gh
 }
 
 func getCommitInfo(file *github.CommitFile) (cfi *commitFileInfo, err error) {
@@ -110,49 +124,24 @@ func getCommitInfo(file *github.CommitFile) (cfi *commitFileInfo, err error) {
 		likelyBinary: isBinary,
 	}, nil
 }
-func parseChunkPositions(patch, filename string) (lines []chunkLines, err error) {
-	if patch != "" {
-		groups := patchRegex.FindAllStringSubmatch(patch, -1)
-		if len(groups) < 1 {
-			return nil, fmt.Errorf("the patch details for [%s] could not be resolved", filename)
-		}
 
-		for _, patchGroup := range groups {
-			endPos := 2
-			if len(patchGroup) > 2 && patchGroup[2] == "" {
-				endPos = 1
-			}
-
-			chunkStart, err := strconv.Atoi(patchGroup[1])
-			if err != nil {
-				chunkStart = -1
-			}
-			chunkEnd, err := strconv.Atoi(patchGroup[endPos])
-			if err != nil {
-				chunkEnd = -1
-			}
-
-			lines = append(lines, chunkLines{chunkStart, chunkStart + (chunkEnd - 1)})
-		}
+// parseChunkPositions returns the hunks of the patch of the file, a file
+// without patch, like a binary one, has none.
+func parseChunkPositions(patch, filename string) ([]diff.Hunk, error) {
+	if patch != "" && !patchRegex.MatchString(patch) {
+		return nil, fmt.Errorf("the patch details for [%s] could not be resolved", filename)
 	}
-	return lines, nil
+	return diff.ParseHunks(patch), nil
 }
 
+// checkCommentRelevant tells a line of the diff of the file, the files must
+// have been loaded
 func (c *Github) checkCommentRelevant(filename string, line int) bool {
-
-	for _, file := range c.files {
-		if relevant := func(file *commitFileInfo) bool {
-			if file.FileName == filename && !file.isResolvable() {
-				if (line == commenter.FIRST_AVAILABLE_LINE) || (checkIfLineInChunk(line, file)) {
-					return true
-				}
-			}
-			return false
-		}(file); relevant {
-			return true
-		}
+	file, ok := c.files[filename]
+	if !ok || file.isResolvable() {
+		return false
 	}
-	return false
+	return line == commenter.FIRST_AVAILABLE_LINE || checkIfLineInChunk(line, file)
 }
 
 func checkIfLineInChunk(line int, file *commitFileInfo) bool {
@@ -160,7 +149,7 @@ func checkIfLineInChunk(line int, file *commitFileInfo) bool {
 		return true
 	}
 
-	_, found := lo.Find(file.ChunkLines, func(lines chunkLines) bool {
+	_, found := lo.Find(file.ChunkLines, func(lines diff.Hunk) bool {
 		return lines.Contains(line)
 	})
 
@@ -168,19 +157,24 @@ func checkIfLineInChunk(line int, file *commitFileInfo) bool {
 }
 
 func (c *Github) getFileInfo(file string, line int) (*commitFileInfo, error) {
+	if !c.checkCommentRelevant(file, line) {
+		return nil, fmt.Errorf("file not found, shouldn't have got to here")
+	}
+	return c.files[file], nil
+}
 
-	for _, info := range c.files {
-		if info.FileName == file && !info.isResolvable() {
-			if (line == commenter.FIRST_AVAILABLE_LINE) || (checkIfLineInChunk(line, info)) {
-				return info, nil
-			}
-		}
+// notInDiff reports the line outside the diff with the line of the diff of the
+// file closest to it.
+func (c *Github) notInDiff(file string, line int) CommentNotValidError {
+	err := NewCommentNotValidError(file, line)
+	if info, ok := c.files[file]; ok && !info.isResolvable() {
+		err.Nearest = info.nearestLine(line)
 	}
-	return nil, fmt.Errorf("file not found, shouldn't have got to here")
+	return err
 }
 
 func getFirstChunkLine(file commitFileInfo) int {
-	lines := lo.MinBy(file.ChunkLines, func(lines chunkLines, minLines chunkLines) bool {
+	lines := lo.MinBy(file.ChunkLines, func(lines diff.Hunk, minLines diff.Hunk) bool {
 		return lines.Start < minLines.Start
 
 	})
@@ -201,79 +195,215 @@ func buildComment(file, comment string, line int, info commitFileInfo) *github.P
 	}
 }
 
-func (c *Github) writeCommentIfRequired(prComment *github.PullRequestComment) error {
-	var commentId *int64
-	for _, existing := range c.existingComments {
-		commentId = func(ec *existingComment) *int64 {
-			if *ec.filename == *prComment.Path && *ec.comment == *prComment.Body {
-				return ec.commentId
-			}
-			return nil
-		}(existing)
-		if commentId != nil {
-			break
-		}
+func (c *Github) writeCommentIfRequired(ctx context.Context, prComment *github.PullRequestComment) (*github.PullRequestComment, commenter.Status, error) {
+	// The same comment is already on the file, editing it would be a no-op
+	existing, err := c.findExistingComment(ctx, prComment)
+	if err != nil {
+		return nil, "", err
+	}
+	if existing != nil {
+		return &github.PullRequestComment{ID: existing.commentId}, commenter.StatusUnchanged, nil
+	}
+	if dryrun.Intercept(ctx, commentEntry(prComment)) {
+		return nil, commenter.StatusCreated, nil
 	}
 
-	if err := c.ghConnector.writeReviewComment(prComment, commentId); err != nil {
-		return fmt.Errorf("write review comment: %w", err)
+	written, err := c.ghConnector.writeReviewComment(ctx, prComment)
+	if err != nil {
+		return nil, "", fmt.Errorf("write review comment: %w", err)
 	}
-	return nil
+	c.addComment(written)
+	return written, commenter.StatusCreated, nil
 }
 
-// WriteMultiLineComment writes a multiline review on a file in the github PR
-func (c *Github) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
-	if startLine == 0 {
-		startLine = 1
+// commentEntry describes the review comment in a dry run plan, with the lines
+// resolved against the diff.
+func commentEntry(prComment *github.PullRequestComment) dryrun.Entry {
+	startLine := prComment.GetLine()
+	if prComment.StartLine != nil {
+		startLine = prComment.GetStartLine()
 	}
-	if endLine == 0 {
-		endLine = 1
+	return dryrun.Entry{
+		Action:    dryrun.Create,
+		Path:      prComment.GetPath(),
+		StartLine: startLine,
+		EndLine:   prComment.GetLine(),
+		Body:      prComment.GetBody(),
 	}
+}
 
-	if endLine < startLine {
-		startLine++
-		endLine = startLine
+func (c *Github) findExistingComment(ctx context.Context, prComment *github.PullRequestComment) (*existingComment, error) {
+	if err := c.loadComments(ctx); err != nil {
+		return nil, err
 	}
+	return c.comments.find(prComment.GetPath(), prComment.GetBody()), nil
+}
 
-	if !c.checkCommentRelevant(file, startLine) || !c.checkCommentRelevant(file, endLine) {
-		return newCommentNotValidError(file, startLine)
+// addComment indexes a comment written by this run, so it isn't duplicated
+func (c *Github) addComment(written *github.PullRequestComment) {
+	if c.comments == nil || written == nil {
+		return
 	}
-	if startLine == endLine {
-		return c.WriteLineComment(file, comment, endLine)
+	c.comments.add(&existingComment{
+		filename:  written.Path,
+		comment:   written.Body,
+		commentId: written.ID,
+	})
+}
+
+// WriteMultiLineComment writes a multiline review on a file in the github PR
+func (c *Github) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	_, _, err := c.writeMultiLineComment(context.Background(), file, comment, startLine, endLine)
+	return err
+}
+
+func (c *Github) writeMultiLineComment(ctx context.Context, file, comment string, startLine, endLine int) (*github.PullRequestComment, commenter.Status, error) {
+	prComment, err := c.prepareComment(ctx, file, comment, startLine, endLine)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.writeCommentIfRequired(ctx, prComment)
+}
+
+// prepareComment validates the lines against the PR diff and builds the
+// review comment that would be written for them.
+func (c *Github) prepareComment(ctx context.Context, file, comment string, startLine, endLine int) (*github.PullRequestComment, error) {
+	if err := c.loadFiles(ctx); err != nil {
+		return nil, err
+	}
+	startLine, endLine = commenter.NormalizeLines(startLine, endLine)
+	if !c.checkCommentRelevant(file, startLine) {
+		return nil, c.notInDiff(file, startLine)
+	}
+	if !c.checkCommentRelevant(file, endLine) {
+		return nil, c.notInDiff(file, endLine)
 	}
 
 	info, err := c.getFileInfo(file, endLine)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	prComment := buildComment(file, comment, endLine, *info)
-	prComment.StartLine = &startLine
-	return c.writeCommentIfRequired(prComment)
+	if startLine != endLine {
+		prComment.StartLine = &startLine
+	}
+	return prComment, nil
 }
 
 // WriteLineComment writes a single review line on a file of the github PR
 func (c *Github) WriteLineComment(file, comment string, line int) error {
+	_, _, err := c.writeLineComment(context.Background(), file, comment, line)
+	return err
+}
+
+func (c *Github) writeLineComment(ctx context.Context, file, comment string, line int) (*github.PullRequestComment, commenter.Status, error) {
+	if err := c.loadFiles(ctx); err != nil {
+		return nil, "", err
+	}
+	line, _ = commenter.NormalizeLines(line, line)
 	if !c.checkCommentRelevant(file, line) {
-		return newCommentNotValidError(file, line)
+		return nil, "", c.notInDiff(file, line)
 	}
 	info, err := c.getFileInfo(file, line)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	prComment := buildComment(file, comment, line, *info)
 
-	return c.writeCommentIfRequired(prComment)
+	return c.writeCommentIfRequired(ctx, prComment)
+}
+
+// WriteFinding writes the finding as a review comment and reports the comment it produced
+func (c *Github) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	body, err := c.findingBody(ctx, f)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	written, status, err := c.writeMultiLineComment(ctx, f.Path, body, f.StartLine, f.EndLine)
+	return findingResult(f, written, status, err)
+}
+
+// findingBody renders the suggestion of the finding as a suggestion block when
+// a single chunk of the diff covers its lines, as a diff block otherwise.
+func (c *Github) findingBody(ctx context.Context, f commenter.Finding) (string, error) {
+	if f.Suggestion == "" {
+		return f.Body, nil
+	}
+	if err := c.loadFiles(ctx); err != nil {
+		return "", err
+	}
+	format := commenter.SuggestionDiff
+	startLine, endLine := commenter.NormalizeLines(f.StartLine, f.EndLine)
+	if info, ok := c.files[f.Path]; ok && startLine != commenter.FIRST_AVAILABLE_LINE && info.inOneChunk(startLine, endLine) {
+		format = commenter.SuggestionBlock
+	}
+	return commenter.RenderSuggestion(f, format), nil
+}
+
+// WriteFileComment writes the finding as a review comment on its file
+func (c *Github) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	if err := c.loadFiles(ctx); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	info, ok := c.files[f.Path]
+	if !ok {
+		return commenter.FailedResult(f, commenter.NotInDiffError{Path: f.Path})
+	}
+	// a file comment can't replace lines, the suggestion is shown as a diff
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	existing, err := c.findExistingComment(ctx, &github.PullRequestComment{Path: &f.Path, Body: &body})
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	if existing != nil {
+		return findingResult(f, &github.PullRequestComment{ID: existing.commentId}, commenter.StatusUnchanged, nil)
+	}
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f).WithBody(body)) {
+		return findingResult(f, nil, commenter.StatusCreated, nil)
+	}
+	written, err := c.ghConnector.writeFileComment(ctx, f.Path, body, info.sha)
+	if err == nil {
+		c.addComment(written)
+	}
+	return findingResult(f, written, commenter.StatusCreated, err)
+}
+
+func findingResult(f commenter.Finding, written *github.PullRequestComment, status commenter.Status, err error) commenter.Result {
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+
+	result := commenter.Result{Finding: f, Status: status}
+	if written != nil {
+		result.CommentID = strconv.FormatInt(written.GetID(), 10)
+		result.URL = written.GetHTMLURL()
+	}
+	return result
 }
 
 func (c *Github) RemovePreviousAquaComments(msg string) error {
-	ctx := context.Background()
-	for _, existing := range c.existingComments {
-		if strings.Contains(*existing.comment, msg) {
-			if _, err := c.ghConnector.prs.DeleteComment(ctx, c.Owner, c.Repo, *existing.commentId); err != nil {
-				return err
-			}
+	return c.RemoveAquaComments(context.Background(), msg)
+}
+
+// RemoveAquaComments deletes every review comment containing the marker
+func (c *Github) RemoveAquaComments(ctx context.Context, msg string) error {
+	if err := c.loadComments(ctx); err != nil {
+		return err
+	}
+	var kept []*existingComment
+	for i, existing := range c.comments.all {
+		if !strings.Contains(deref(existing.comment), msg) {
+			kept = append(kept, existing)
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.FormatInt(*existing.commentId, 10), deref(existing.filename), "")) {
+			continue
+		}
+		if _, err := c.ghConnector.prs.DeleteComment(ctx, c.Owner, c.Repo, *existing.commentId); err != nil {
+			c.comments = newCommentIndex(append(kept, c.comments.all[i:]...))
+			return mapError(err)
 		}
 	}
-	c.existingComments = nil
+	c.comments = newCommentIndex(kept)
 	return nil
 }
@@ -7,10 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"net/url"
 )
 
-// Default endpoint for github.com. GHE rewrites this; we only support github.com today.
+// defaultGraphQLEndpoint is the endpoint of github.com, GitHub Enterprise
+// Server's is derived from its API URL, see graphQLEndpoint.
 const defaultGraphQLEndpoint = "https://api.github.com/graphql"
 
 const reviewThreadsQuery = `
@@ -27,8 +28,10 @@ query($owner: String!, $name: String!, $number: Int!, $threadCursor: String) {
           line
           startLine
           comments(first: 100) {
+            pageInfo { hasNextPage endCursor }
             nodes {
               databaseId
+              url
               body
               path
               line
@@ -41,24 +44,49 @@ query($owner: String!, $name: String!, $number: Int!, $threadCursor: String) {
   }
 }`
 
-type gqlReviewComment struct {
-	DatabaseID int64   `json:"databaseId"`
-	Body       string  `json:"body"`
-	Path       string  `json:"path"`
-	Line       *int    `json:"line"`
-	StartLine  *int    `json:"startLine"`
-}
+// threadCommentsQuery pages through the comments of a thread past the first
+// page returned with it
+const threadCommentsQuery = `
+query($id: ID!, $commentCursor: String) {
+  node(id: $id) {
+    ... on PullRequestReviewThread {
+      comments(first: 100, after: $commentCursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          databaseId
+          url
+          body
+          path
+          line
+          startLine
+        }
+      }
+    }
+  }
+}`
 
-type gqlReviewThread struct {
-	ID         string `json:"id"`
-	IsResolved bool   `json:"isResolved"`
-	IsOutdated bool   `json:"isOutdated"`
+type gqlReviewComment struct {
+	DatabaseID int64  `json:"databaseId"`
+	URL        string `json:"url"`
+	Body       string `json:"body"`
 	Path       string `json:"path"`
 	Line       *int   `json:"line"`
 	StartLine  *int   `json:"startLine"`
-	Comments   struct {
-		Nodes []gqlReviewComment `json:"nodes"`
-	} `json:"comments"`
+}
+
+type gqlReviewThread struct {
+	ID         string      `json:"id"`
+	IsResolved bool        `json:"isResolved"`
+	IsOutdated bool        `json:"isOutdated"`
+	Path       string      `json:"path"`
+	Line       *int        `json:"line"`
+	StartLine  *int        `json:"startLine"`
+	Comments   gqlComments `json:"comments"`
+}
+
+type gqlComments struct {
+	PageInfo gqlPageInfo        `json:"pageInfo"`
+	Nodes    []gqlReviewComment `json:"nodes"`
 }
 
 type gqlPageInfo struct {
@@ -66,89 +94,126 @@ type gqlPageInfo struct {
 	EndCursor   string `json:"endCursor"`
 }
 
-type gqlReviewThreadsResponse struct {
-	Data struct {
-		Repository struct {
-			PullRequest struct {
-				ReviewThreads struct {
-					PageInfo gqlPageInfo       `json:"pageInfo"`
-					Nodes    []gqlReviewThread `json:"nodes"`
-				} `json:"reviewThreads"`
-			} `json:"pullRequest"`
-		} `json:"repository"`
-	} `json:"data"`
+type gqlReviewThreadsData struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				PageInfo gqlPageInfo       `json:"pageInfo"`
+				Nodes    []gqlReviewThread `json:"nodes"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+type gqlThreadCommentsData struct {
+	Node struct {
+		Comments gqlComments `json:"comments"`
+	} `json:"node"`
+}
+
+type gqlResponse struct {
+	Data   json.RawMessage `json:"data"`
 	Errors []struct {
 		Message string `json:"message"`
 	} `json:"errors"`
 }
 
-// fetchReviewThreads pages through every review thread on the PR and returns them flattened.
-func (c *connector) fetchReviewThreads(ctx context.Context, token, endpoint string) ([]gqlReviewThread, error) {
-	if endpoint == "" {
-		endpoint = defaultGraphQLEndpoint
-	}
-
+// fetchReviewThreads pages through every review thread on the PR, and through
+// the comments of the threads having more than a page of them.
+func (c *connector) fetchReviewThreads(ctx context.Context, endpoint string) ([]gqlReviewThread, error) {
 	var all []gqlReviewThread
-	cursor := ""
+	var cursor interface{}
 	for {
-		vars := map[string]interface{}{
-			"owner":  c.owner,
-			"name":   c.repo,
-			"number": c.prNumber,
-		}
-		if cursor != "" {
-			vars["threadCursor"] = cursor
-		} else {
-			vars["threadCursor"] = nil
-		}
-
-		body, err := json.Marshal(map[string]interface{}{
-			"query":     reviewThreadsQuery,
-			"variables": vars,
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
-		if err != nil {
+		var data gqlReviewThreadsData
+		if err := c.graphQL(ctx, endpoint, reviewThreadsQuery, map[string]interface{}{
+			"owner":        c.owner,
+			"name":         c.repo,
+			"number":       c.prNumber,
+			"threadCursor": cursor,
+		}, &data); err != nil {
 			return nil, err
 		}
-		req.Header.Set("Authorization", "Bearer "+token)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("graphql request: %w", err)
-		}
-		raw, err := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		if err != nil {
-			return nil, err
+		page := data.Repository.PullRequest.ReviewThreads
+		for _, thread := range page.Nodes {
+			if err := c.fetchThreadComments(ctx, endpoint, &thread); err != nil {
+				return nil, err
+			}
+			all = append(all, thread)
 		}
-		if resp.StatusCode/100 != 2 {
-			return nil, fmt.Errorf("graphql http %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+		if !page.PageInfo.HasNextPage {
+			return all, nil
 		}
+		cursor = page.PageInfo.EndCursor
+	}
+}
 
-		var parsed gqlReviewThreadsResponse
-		if err := json.Unmarshal(raw, &parsed); err != nil {
-			return nil, fmt.Errorf("graphql decode: %w", err)
+// fetchThreadComments adds the comments of the thread past the first page.
+func (c *connector) fetchThreadComments(ctx context.Context, endpoint string, thread *gqlReviewThread) error {
+	pageInfo := thread.Comments.PageInfo
+	for pageInfo.HasNextPage {
+		var data gqlThreadCommentsData
+		if err := c.graphQL(ctx, endpoint, threadCommentsQuery, map[string]interface{}{
+			"id":            thread.ID,
+			"commentCursor": pageInfo.EndCursor,
+		}, &data); err != nil {
+			return fmt.Errorf("list comments of thread %s: %w", thread.ID, err)
 		}
-		if len(parsed.Errors) > 0 {
-			msgs := make([]string, 0, len(parsed.Errors))
-			for _, e := range parsed.Errors {
-				msgs = append(msgs, e.Message)
-			}
-			return nil, fmt.Errorf("graphql: %s", strings.Join(msgs, "; "))
+		comments := data.Node.Comments
+		thread.Comments.Nodes = append(thread.Comments.Nodes, comments.Nodes...)
+		pageInfo = comments.PageInfo
+	}
+	return nil
+}
+
+// graphQL sends the query with the authenticated client of the REST API and
+// decodes its data into out.
+func (c *connector) graphQL(ctx context.Context, endpoint, query string, vars map[string]interface{}, out interface{}) error {
+	if endpoint == "" {
+		var apiUrl *url.URL
+		if c.client != nil {
+			apiUrl = c.client.BaseURL
 		}
+		endpoint = graphQLEndpoint(apiUrl)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return err
+	}
 
-		page := parsed.Data.Repository.PullRequest.ReviewThreads
-		all = append(all, page.Nodes...)
-		if !page.PageInfo.HasNextPage {
-			break
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("graphql request: %w", err)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var parsed gqlResponse
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return fmt.Errorf("graphql decode: %w", err)
+	}
+	if len(parsed.Errors) > 0 {
+		msgs := make([]string, 0, len(parsed.Errors))
+		for _, e := range parsed.Errors {
+			msgs = append(msgs, e.Message)
 		}
-		cursor = page.PageInfo.EndCursor
+		return gqlError{Messages: msgs}
+	}
+	if err := json.Unmarshal(parsed.Data, out); err != nil {
+		return fmt.Errorf("graphql decode: %w", err)
 	}
-	return all, nil
+	return nil
 }
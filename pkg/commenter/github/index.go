@@ -0,0 +1,80 @@
+package github
+
+import (
+	"context"
+	"fmt"
+)
+
+type commentKey struct {
+	path string
+	body string
+}
+
+// commentIndex holds the review comments of the PR, indexed by path and body
+// to find the ones a new comment would duplicate.
+type commentIndex struct {
+	all    []*existingComment
+	byBody map[commentKey]*existingComment
+}
+
+func newCommentIndex(comments []*existingComment) *commentIndex {
+	idx := &commentIndex{byBody: make(map[commentKey]*existingComment, len(comments))}
+	for _, comment := range comments {
+		idx.add(comment)
+	}
+	return idx
+}
+
+func (idx *commentIndex) add(comment *existingComment) {
+	idx.all = append(idx.all, comment)
+	key := commentKey{path: deref(comment.filename), body: deref(comment.comment)}
+	if _, ok := idx.byBody[key]; !ok {
+		idx.byBody[key] = comment
+	}
+}
+
+func (idx *commentIndex) find(path, body string) *existingComment {
+	return idx.byBody[commentKey{path: path, body: body}]
+}
+
+// newFileIndex indexes the files of the PR by path.
+func newFileIndex(files []*commitFileInfo) map[string]*commitFileInfo {
+	idx := make(map[string]*commitFileInfo, len(files))
+	for _, file := range files {
+		idx[file.FileName] = file
+	}
+	return idx
+}
+
+// loadFiles lists the files of the PR on first need.
+func (c *Github) loadFiles(ctx context.Context) error {
+	if c.files != nil {
+		return nil
+	}
+	files, err := getCommitFileInfo(ctx, c.ghConnector)
+	if err != nil {
+		return fmt.Errorf("failed load pr files: %w", err)
+	}
+	c.files = newFileIndex(files)
+	return nil
+}
+
+// loadComments lists the review comments of the PR on first need.
+func (c *Github) loadComments(ctx context.Context) error {
+	if c.comments != nil {
+		return nil
+	}
+	comments, err := c.ghConnector.getExistingComments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed load pr comments: %w", err)
+	}
+	c.comments = newCommentIndex(comments)
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
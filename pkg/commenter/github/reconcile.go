@@ -3,9 +3,11 @@ package github
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
 	gh "github.com/google/go-github/v44/github"
 )
 
@@ -16,35 +18,96 @@ type aquaThread struct {
 }
 
 func (c *Github) ReconcileAquaComments(marker string, current []commenter.Finding) error {
-	ctx := context.Background()
-	threads, err := c.ghConnector.fetchReviewThreads(ctx, c.Token, c.GraphQLEndpoint)
+	results, err := c.ReconcileFindings(context.Background(), marker, current)
 	if err != nil {
-		return fmt.Errorf("list review threads: %w", err)
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings edits matching Aqua threads in place, creates comments for
+// new findings and deletes Aqua comments in threads that are no longer current.
+// Resolved threads are never touched.
+func (c *Github) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	if !c.ghConnector.supportsReviewThreads() {
+		return c.repost(ctx, marker, current)
+	}
+	threads, err := c.ghConnector.fetchReviewThreads(ctx, c.GraphQLEndpoint)
+	if unsupportedSchema(err) {
+		return c.repost(ctx, marker, current)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list review threads: %w", err)
 	}
 
 	aqua := selectAquaThreads(threads, marker)
-	byFP, legacy := indexAquaThreads(aqua)
+	byFP, legacy, duplicates := indexAquaThreads(aqua)
 
 	handled := make(map[string]bool)
 	legacyUsed := make(map[*aquaThread]bool)
 
-	for _, f := range current {
+	results := make([]commenter.Result, 0, len(current))
+	var unmatched []commenter.Finding
+	var unmatchedIdx []int
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			for _, j := range unmatchedIdx {
+				results[j] = commenter.Result{Finding: results[j].Finding, Status: commenter.StatusFailed, Err: err}
+			}
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
 		match := matchThread(f, byFP, legacy, legacyUsed)
 		if match != nil {
 			if f.Fingerprint != "" {
 				handled[f.Fingerprint] = true
 			}
+			id := strconv.FormatInt(match.topComment.DatabaseID, 10)
 			if match.thread.IsResolved {
+				results = append(results, commenter.Result{Finding: f, Status: commenter.StatusSkipped, CommentID: id, Reason: "thread is resolved"})
 				continue
 			}
-			if err := c.editComment(ctx, match.topComment.DatabaseID, f.Body); err != nil {
-				return fmt.Errorf("edit comment %d: %w", match.topComment.DatabaseID, err)
+			body, err := c.findingBody(ctx, f)
+			if err != nil {
+				results = append(results, commenter.FailedResult(f, err))
+				continue
+			}
+			if commenter.Unchanged(match.topComment.Body, body) {
+				results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: id, URL: match.topComment.URL})
+				continue
+			}
+			if dryrun.Intercept(ctx, dryrun.Edited(f, id).WithBody(body)) {
+				results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: match.topComment.URL})
+				continue
+			}
+			edited, err := c.editComment(ctx, match.topComment.DatabaseID, body)
+			if err != nil {
+				results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+					Err: fmt.Errorf("edit comment %d: %w", match.topComment.DatabaseID, err)})
+				continue
 			}
+			results = append(results, findingResult(f, edited, commenter.StatusEdited, nil))
+			continue
+		}
+		if c.BatchReviews {
+			// Collected and submitted as reviews once every thread is matched
+			unmatched = append(unmatched, f)
+			unmatchedIdx = append(unmatchedIdx, len(results))
+			results = append(results, commenter.Result{Finding: f})
 			continue
 		}
 		// No matching thread — fall through to the existing create path so we
 		// inherit checkCommentRelevant, position calculation, and retries.
-		_ = c.WriteMultiLineComment(f.Path, f.Body, f.StartLine, f.EndLine)
+		results = append(results, c.WriteFinding(ctx, f))
+	}
+
+	if len(unmatched) > 0 {
+		written, err := c.writeReview(ctx, unmatched)
+		for i, r := range written {
+			results[unmatchedIdx[i]] = r
+		}
+		if err != nil {
+			return results, err
+		}
 	}
 
 	for fp, a := range byFP {
@@ -52,7 +115,7 @@ func (c *Github) ReconcileAquaComments(marker string, current []commenter.Findin
 			continue
 		}
 		if err := c.deleteAquaCommentsInThread(ctx, a.thread, marker); err != nil {
-			return err
+			return results, err
 		}
 	}
 	for _, a := range legacy {
@@ -60,10 +123,18 @@ func (c *Github) ReconcileAquaComments(marker string, current []commenter.Findin
 			continue
 		}
 		if err := c.deleteAquaCommentsInThread(ctx, a.thread, marker); err != nil {
-			return err
+			return results, err
 		}
 	}
-	return nil
+	for _, a := range duplicates {
+		if a.thread.IsResolved {
+			continue
+		}
+		if err := c.deleteAquaCommentsInThread(ctx, a.thread, marker); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
 }
 
 func selectAquaThreads(threads []gqlReviewThread, marker string) []*aquaThread {
@@ -89,19 +160,23 @@ func selectAquaThreads(threads []gqlReviewThread, marker string) []*aquaThread {
 	return out
 }
 
-func indexAquaThreads(aqua []*aquaThread) (byFP map[string]*aquaThread, legacy []*aquaThread) {
+// indexAquaThreads indexes the threads by fingerprint, the first seen wins and
+// the threads repeating its fingerprint are returned as duplicates, stale like
+// those of the findings no longer reported.
+func indexAquaThreads(aqua []*aquaThread) (byFP map[string]*aquaThread, legacy, duplicates []*aquaThread) {
 	byFP = make(map[string]*aquaThread)
 	for _, a := range aqua {
 		if a.fingerprint == "" {
 			legacy = append(legacy, a)
 			continue
 		}
-		// First-seen wins; later duplicates fall through to deletion below.
-		if _, ok := byFP[a.fingerprint]; !ok {
-			byFP[a.fingerprint] = a
+		if _, ok := byFP[a.fingerprint]; ok {
+			duplicates = append(duplicates, a)
+			continue
 		}
+		byFP[a.fingerprint] = a
 	}
-	return byFP, legacy
+	return byFP, legacy, duplicates
 }
 
 func matchThread(f commenter.Finding, byFP map[string]*aquaThread, legacy []*aquaThread, used map[*aquaThread]bool) *aquaThread {
@@ -129,9 +204,12 @@ func intPtrEq(p *int, v int) bool {
 	return *p == v
 }
 
-func (c *Github) editComment(ctx context.Context, id int64, body string) error {
-	_, _, err := c.ghConnector.prs.EditComment(ctx, c.Owner, c.Repo, id, &gh.PullRequestComment{Body: &body})
-	return err
+func (c *Github) editComment(ctx context.Context, id int64, body string) (*gh.PullRequestComment, error) {
+	comment, _, err := c.ghConnector.prs.EditComment(ctx, c.Owner, c.Repo, id, &gh.PullRequestComment{Body: &body})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return comment, nil
 }
 
 // Only deletes comments authored by Aqua (i.e. carrying the marker) so that any
@@ -141,8 +219,11 @@ func (c *Github) deleteAquaCommentsInThread(ctx context.Context, t *gqlReviewThr
 		if !strings.Contains(cm.Body, marker) {
 			continue
 		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.FormatInt(cm.DatabaseID, 10), t.Path, "finding is no longer reported")) {
+			continue
+		}
 		if _, err := c.ghConnector.prs.DeleteComment(ctx, c.Owner, c.Repo, cm.DatabaseID); err != nil {
-			return err
+			return mapError(err)
 		}
 	}
 	return nil
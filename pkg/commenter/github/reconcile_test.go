@@ -1,7 +1,9 @@
 package github
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,9 @@ import (
 	"testing"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 	gh "github.com/google/go-github/v44/github"
 )
 
@@ -139,7 +144,8 @@ func newTestGithub(t *testing.T, threads []gqlThreadFixture, commitFiles []*comm
 		Repo:            "repo",
 		PrNumber:        42,
 		GraphQLEndpoint: ts.URL + "/graphql",
-		files:           commitFiles,
+		files:           newFileIndex(commitFiles),
+		comments:        newCommentIndex(nil),
 		ghConnector: &connector{
 			prs:      client.PullRequests,
 			owner:    "owner",
@@ -154,7 +160,7 @@ func filesCovering(path string, start, end int) []*commitFileInfo {
 	return []*commitFileInfo{{
 		FileName:   path,
 		sha:        "abc",
-		ChunkLines: []chunkLines{{Start: start, End: end}},
+		ChunkLines: []diff.Hunk{{Start: start, End: end}},
 	}}
 }
 
@@ -238,6 +244,30 @@ func TestReconcile_UnresolvedStaleFinding_Deletes(t *testing.T) {
 	}
 }
 
+func TestReconcile_DuplicateThreads_Deleted(t *testing.T) {
+	c, counts, done := newTestGithub(t,
+		[]gqlThreadFixture{
+			{path: "a.go", line: 10, commentID: 100, fingerprint: "deadbeef", body: aquaBody("duplicated finding")},
+			{path: "a.go", line: 12, commentID: 200, fingerprint: "deadbeef", body: aquaBody("duplicated finding")},
+			{resolved: true, path: "a.go", line: 14, commentID: 300, fingerprint: "deadbeef", body: aquaBody("duplicated finding")},
+		},
+		filesCovering("a.go", 1, 100),
+	)
+	defer done()
+
+	err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10,
+		Body:        EmbedFingerprint(aquaBody("duplicated finding"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.delete != 1 || counts.create != 0 {
+		t.Fatalf("expected delete=1 create=0, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+}
+
 func TestReconcile_ResolvedStaleFinding_Preserved(t *testing.T) {
 	c, counts, done := newTestGithub(t,
 		[]gqlThreadFixture{{
@@ -324,3 +354,165 @@ func TestReconcile_NonAquaThread_Ignored(t *testing.T) {
 		t.Fatalf("non-aqua thread must not be touched, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
 	}
 }
+
+func TestReconcileFindings_ReportsPerFinding(t *testing.T) {
+	c, _, done := newTestGithub(t,
+		[]gqlThreadFixture{{
+			resolved:    true,
+			path:        "a.go",
+			line:        10,
+			commentID:   100,
+			fingerprint: "deadbeef",
+			body:        aquaBody("accepted risk"),
+		}},
+		filesCovering("a.go", 1, 50),
+	)
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{
+		{Path: "a.go", StartLine: 10, EndLine: 10, Body: EmbedFingerprint(aquaBody("kept"), "deadbeef"), Fingerprint: "deadbeef"},
+		{Path: "a.go", StartLine: 20, EndLine: 20, Body: EmbedFingerprint(aquaBody("new"), "feedface"), Fingerprint: "feedface"},
+		{Path: "a.go", StartLine: 80, EndLine: 80, Body: EmbedFingerprint(aquaBody("outside"), "0ddba11"), Fingerprint: "0ddba11"},
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	want := []commenter.Status{commenter.StatusSkipped, commenter.StatusCreated, commenter.StatusSkipped}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Fatalf("result %d: got %s, want %s (%+v)", i, r.Status, want[i], r)
+		}
+	}
+	if results[1].CommentID != "999" {
+		t.Fatalf("expected created comment id to be reported, got %q", results[1].CommentID)
+	}
+	var notValid CommentNotValidError
+	if !errors.As(results[2].Err, &notValid) {
+		t.Fatalf("expected CommentNotValidError for out-of-diff finding, got %v", results[2].Err)
+	}
+}
+
+// cancelOnEdit cancels the context of the run once a comment is edited.
+type cancelOnEdit struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelOnEdit) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodPatch {
+		defer c.cancel()
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestReconcileFindings_CanceledReportsEveryFinding(t *testing.T) {
+	c, counts, done := newTestGithub(t,
+		[]gqlThreadFixture{
+			{path: "a.go", line: 10, commentID: 100, fingerprint: "deadbeef", body: aquaBody("old")},
+			{path: "a.go", line: 20, commentID: 200, fingerprint: "cafebabe", body: aquaBody("old")},
+		},
+		filesCovering("a.go", 1, 50),
+	)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := gh.NewClient(&http.Client{Transport: cancelOnEdit{cancel: cancel}})
+	client.BaseURL, _ = url.Parse(strings.TrimSuffix(c.GraphQLEndpoint, "graphql"))
+	c.ghConnector.prs = client.PullRequests
+
+	current := []commenter.Finding{
+		{Path: "a.go", StartLine: 10, EndLine: 10, Body: EmbedFingerprint(aquaBody("first"), "deadbeef"), Fingerprint: "deadbeef"},
+		{Path: "a.go", StartLine: 20, EndLine: 20, Body: EmbedFingerprint(aquaBody("second"), "cafebabe"), Fingerprint: "cafebabe"},
+		{Path: "a.go", StartLine: 30, EndLine: 30, Body: EmbedFingerprint(aquaBody("new"), "feedface"), Fingerprint: "feedface"},
+	}
+	results, err := c.ReconcileFindings(ctx, testMarker, current)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != len(current) {
+		t.Fatalf("expected %d results, got %+v", len(current), results)
+	}
+	for i, r := range results[1:] {
+		if r.Status != commenter.StatusFailed || !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("result %d: expected to fail with context.Canceled, got %+v", i+1, r)
+		}
+	}
+	if counts.edit != 1 || counts.create != 0 {
+		t.Fatalf("expected a single edit before the cancellation, got edit=%d create=%d", counts.edit, counts.create)
+	}
+}
+
+func TestReconcile_IdenticalBody_SkipsEdit(t *testing.T) {
+	body := fingerprint.Embed(aquaBody("same finding text"), fingerprint.Metadata{Fingerprint: "deadbeef"}, fingerprint.HTMLComment)
+	c, counts, done := newTestGithub(t,
+		[]gqlThreadFixture{{
+			path:        "a.go",
+			line:        10,
+			commentID:   100,
+			fingerprint: "deadbeef",
+			// GitHub hands bodies back with CRLF line endings, the stored hash still matches
+			body: strings.ReplaceAll(body, "\n", "\r\n"),
+		}},
+		filesCovering("a.go", 1, 100),
+	)
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10, Body: body, Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 0 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected zero writes, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+	if got := commenter.Summarize(results)[commenter.StatusUnchanged]; got != 1 {
+		t.Fatalf("expected one skipped edit to be reported, got %d", got)
+	}
+}
+
+func TestReconcile_DryRun_RecordsPlanWithoutWrites(t *testing.T) {
+	c, counts, done := newTestGithub(t,
+		[]gqlThreadFixture{
+			{path: "a.go", line: 10, commentID: 100, fingerprint: "deadbeef", body: aquaBody("old finding text")},
+			{path: "a.go", line: 20, commentID: 200, fingerprint: "cafebabe", body: aquaBody("finding gone")},
+		},
+		filesCovering("a.go", 1, 30),
+	)
+	defer done()
+
+	plan := dryrun.NewPlan()
+	results, err := c.ReconcileFindings(dryrun.WithPlan(context.Background(), plan), testMarker, []commenter.Finding{
+		{Path: "a.go", StartLine: 10, EndLine: 10, Body: EmbedFingerprint(aquaBody("refreshed"), "deadbeef"), Fingerprint: "deadbeef", Suggestion: "fixed"},
+		{Path: "a.go", StartLine: 5, EndLine: 6, Body: aquaBody("new"), Fingerprint: "feedface"},
+		{Path: "a.go", StartLine: 40, EndLine: 40, Body: aquaBody("outside the diff"), Fingerprint: "0ddba11"},
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 0 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected no writes, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+
+	wantStatus := []commenter.Status{commenter.StatusEdited, commenter.StatusCreated, commenter.StatusSkipped}
+	for i, status := range wantStatus {
+		if results[i].Status != status {
+			t.Errorf("finding %d: expected %s, got %+v", i, status, results[i])
+		}
+	}
+
+	entries := plan.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Action != dryrun.Edit || e.CommentID != "100" || !strings.Contains(e.Body, "refreshed") ||
+		!strings.Contains(e.Body, "```suggestion\nfixed\n```") {
+		t.Errorf("unexpected edit entry %+v", e)
+	}
+	if e := entries[1]; e.Action != dryrun.Create || e.StartLine != 5 || e.EndLine != 6 {
+		t.Errorf("unexpected create entry %+v", e)
+	}
+	if e := entries[2]; e.Action != dryrun.Delete || e.CommentID != "200" || e.Path != "a.go" {
+		t.Errorf("unexpected delete entry %+v", e)
+	}
+}
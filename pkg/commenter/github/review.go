@@ -0,0 +1,199 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/google/go-github/v44/github"
+)
+
+// maxReviewComments bounds the inline comments sent in one review. GitHub
+// rejects or times out on very large reviews, so bigger batches are split.
+const maxReviewComments = 50
+
+const reviewEvent = "COMMENT"
+
+type pendingComment struct {
+	index   int
+	finding commenter.Finding
+	comment *github.PullRequestComment
+}
+
+// WriteFindings writes one review comment per finding. With BatchReviews set
+// the comments are submitted as pull request reviews, which avoids GitHub's
+// secondary rate limits and sends a single notification per review.
+func (c *Github) WriteFindings(ctx context.Context, findings []commenter.Finding) ([]commenter.Result, error) {
+	if c.BatchReviews {
+		return c.writeReview(ctx, findings)
+	}
+
+	results := make([]commenter.Result, 0, len(findings))
+	for i, f := range findings {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(findings[i:], err)...), err
+		}
+		results = append(results, c.WriteFinding(ctx, f))
+	}
+	return results, nil
+}
+
+// writeReview validates every finding and submits the valid ones as reviews of
+// at most maxReviewComments comments each.
+func (c *Github) writeReview(ctx context.Context, findings []commenter.Finding) ([]commenter.Result, error) {
+	results := make([]commenter.Result, len(findings))
+	var pending []pendingComment
+	for i, f := range findings {
+		body, err := c.findingBody(ctx, f)
+		if err != nil {
+			results[i] = findingResult(f, nil, "", err)
+			continue
+		}
+		prComment, err := c.prepareComment(ctx, f.Path, body, f.StartLine, f.EndLine)
+		if err != nil {
+			results[i] = findingResult(f, nil, "", err)
+			continue
+		}
+		existing, err := c.findExistingComment(ctx, prComment)
+		if err != nil {
+			results[i] = findingResult(f, nil, "", err)
+			continue
+		}
+		if existing != nil {
+			results[i] = findingResult(f, &github.PullRequestComment{ID: existing.commentId}, commenter.StatusUnchanged, nil)
+			continue
+		}
+		pending = append(pending, pendingComment{index: i, finding: f, comment: prComment})
+	}
+
+	for start := 0; start < len(pending); start += maxReviewComments {
+		end := start + maxReviewComments
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err := ctx.Err(); err != nil {
+			for _, p := range pending[start:] {
+				results[p.index] = commenter.Result{Finding: p.finding, Status: commenter.StatusFailed, Err: err}
+			}
+			return results, err
+		}
+		if err := c.submitReview(ctx, pending[start:end], results); err != nil {
+			for _, p := range pending[end:] {
+				results[p.index] = commenter.Result{Finding: p.finding, Status: commenter.StatusFailed, Err: err}
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// submitReview posts the comments as one review. GitHub rejects the whole
+// review with a 422 when any comment is invalid, every comment is then retried
+// on its own and only the ones GitHub really rejects are reported as failed.
+// Any other failure may leave the review created, the comments are reported
+// as failed rather than written again and the error is returned.
+func (c *Github) submitReview(ctx context.Context, pending []pendingComment, results []commenter.Result) error {
+	if dryrun.FromContext(ctx) != nil {
+		for _, p := range pending {
+			dryrun.Intercept(ctx, commentEntry(p.comment))
+			results[p.index] = commenter.Result{Finding: p.finding, Status: commenter.StatusCreated}
+		}
+		return nil
+	}
+
+	event := reviewEvent
+	review := &github.PullRequestReviewRequest{
+		CommitID: pending[0].comment.CommitID,
+		Event:    &event,
+	}
+	for _, p := range pending {
+		review.Comments = append(review.Comments, draftComment(p.comment))
+	}
+
+	submitted, resp, err := c.ghConnector.prs.CreateReview(ctx, c.Owner, c.Repo, c.PrNumber, review)
+	if err != nil {
+		if ctx.Err() != nil || resp == nil || resp.StatusCode != http.StatusUnprocessableEntity {
+			err = fmt.Errorf("submit review: %w", mapError(err))
+			for _, p := range pending {
+				results[p.index] = commenter.Result{Finding: p.finding, Status: commenter.StatusFailed, Err: err}
+			}
+			return err
+		}
+		fmt.Printf("review with %d comments was rejected, writing them one by one: %s\n", len(pending), err)
+		for _, p := range pending {
+			if ctx.Err() != nil {
+				results[p.index] = commenter.Result{Finding: p.finding, Status: commenter.StatusFailed, Err: ctx.Err()}
+				continue
+			}
+			written, status, err := c.writeCommentIfRequired(ctx, p.comment)
+			results[p.index] = findingResult(p.finding, written, status, err)
+		}
+		return nil
+	}
+
+	// The review response doesn't carry its comments, list them to report
+	// their ids. If that fails the comments are still written, so the review
+	// link is reported instead.
+	written, err := c.listReviewComments(ctx, submitted.GetID())
+	if err != nil {
+		fmt.Printf("failed to list comments of review %d: %s\n", submitted.GetID(), err)
+	}
+	for _, p := range pending {
+		result := commenter.Result{Finding: p.finding, Status: commenter.StatusCreated, URL: submitted.GetHTMLURL()}
+		if comment := takeReviewComment(written, p.comment); comment != nil {
+			result.CommentID = strconv.FormatInt(comment.GetID(), 10)
+			result.URL = comment.GetHTMLURL()
+			c.addComment(comment)
+		}
+		results[p.index] = result
+	}
+	return nil
+}
+
+func (c *Github) listReviewComments(ctx context.Context, reviewID int64) ([]*github.PullRequestComment, error) {
+	var comments []*github.PullRequestComment
+	opts := &github.ListOptions{PerPage: listPageSize}
+	for {
+		page, resp, err := c.ghConnector.prs.ListReviewComments(ctx, c.Owner, c.Repo, c.PrNumber, reviewID, opts)
+		if err != nil {
+			return comments, mapError(err)
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// takeReviewComment finds the written comment for prComment and removes it
+// from written, so identical findings are each matched to their own comment.
+func takeReviewComment(written []*github.PullRequestComment, prComment *github.PullRequestComment) *github.PullRequestComment {
+	for i, comment := range written {
+		if comment != nil && comment.GetPath() == prComment.GetPath() && comment.GetBody() == prComment.GetBody() {
+			written[i] = nil
+			return comment
+		}
+	}
+	return nil
+}
+
+// draftComment converts a review comment to its review form, which addresses
+// lines instead of diff positions.
+func draftComment(prComment *github.PullRequestComment) *github.DraftReviewComment {
+	side := "RIGHT"
+	draft := &github.DraftReviewComment{
+		Path: prComment.Path,
+		Body: prComment.Body,
+		Line: prComment.Line,
+		Side: &side,
+	}
+	if prComment.StartLine != nil {
+		draft.StartLine = prComment.StartLine
+		draft.StartSide = &side
+	}
+	return draft
+}
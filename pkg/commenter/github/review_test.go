@@ -0,0 +1,205 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	gh "github.com/google/go-github/v44/github"
+)
+
+type reviewServer struct {
+	mu       sync.Mutex
+	reviews  [][]*gh.DraftReviewComment
+	creates  int
+	rejectAt int // reject the review when a comment is on this line
+	// failStatus fails every review with the status, as a server error would
+	failStatus int
+}
+
+func newReviewGithub(t *testing.T, srv *reviewServer, files []*commitFileInfo) (*Github, func()) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/42/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req gh.PullRequestReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode review: %v", err)
+		}
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if srv.failStatus != 0 {
+			w.WriteHeader(srv.failStatus)
+			_, _ = w.Write([]byte(`{"message":"Server Error"}`))
+			return
+		}
+		for _, c := range req.Comments {
+			if srv.rejectAt != 0 && c.GetLine() == srv.rejectAt {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"message":"Unprocessable Entity"}`))
+				return
+			}
+		}
+		srv.reviews = append(srv.reviews, req.Comments)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":%d,"html_url":"https://github.com/review/%d"}`, len(srv.reviews), len(srv.reviews))
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/42/reviews/", func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, "/repos/owner/repo/pulls/42/reviews/%d/comments", &id); err != nil {
+			t.Errorf("unexpected path %s", r.URL.Path)
+			return
+		}
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		var comments []*gh.PullRequestComment
+		for i, c := range srv.reviews[id-1] {
+			commentID := int64(id*1000 + i)
+			comments = append(comments, &gh.PullRequestComment{ID: &commentID, Path: c.Path, Body: c.Body})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(comments)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		var req gh.PullRequestComment
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.GetLine() == srv.rejectAt {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		srv.mu.Lock()
+		srv.creates++
+		srv.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	ts := httptest.NewServer(mux)
+
+	client := gh.NewClient(nil)
+	base, _ := url.Parse(ts.URL + "/")
+	client.BaseURL = base
+
+	return &Github{
+		Owner:        "owner",
+		Repo:         "repo",
+		PrNumber:     42,
+		BatchReviews: true,
+		files:        newFileIndex(files),
+		comments:     newCommentIndex(nil),
+		ghConnector: &connector{
+			prs:      client.PullRequests,
+			owner:    "owner",
+			repo:     "repo",
+			prNumber: 42,
+		},
+	}, ts.Close
+}
+
+func TestWriteFindings_Batch_SingleReview(t *testing.T) {
+	srv := &reviewServer{}
+	c, done := newReviewGithub(t, srv, filesCovering("main.tf", 1, 20))
+	defer done()
+
+	results, err := c.WriteFindings(context.Background(), []commenter.Finding{
+		{Path: "main.tf", StartLine: 3, EndLine: 3, Body: aquaBody("a")},
+		{Path: "main.tf", StartLine: 5, EndLine: 8, Body: aquaBody("b")},
+		{Path: "main.tf", StartLine: 40, EndLine: 40, Body: aquaBody("out of diff")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.reviews) != 1 || len(srv.reviews[0]) != 2 {
+		t.Fatalf("expected one review with 2 comments, got %v", srv.reviews)
+	}
+	multi := srv.reviews[0][1]
+	if multi.GetStartLine() != 5 || multi.GetLine() != 8 || multi.Position != nil {
+		t.Fatalf("unexpected multi-line draft: %v", multi)
+	}
+	if srv.creates != 0 {
+		t.Fatalf("expected no individual comments, got %d", srv.creates)
+	}
+	if results[0].Status != commenter.StatusCreated || results[0].CommentID != "1000" {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	if results[1].CommentID != "1001" {
+		t.Fatalf("unexpected result: %+v", results[1])
+	}
+	if results[2].Status != commenter.StatusSkipped {
+		t.Fatalf("expected out of diff finding to be skipped, got %+v", results[2])
+	}
+}
+
+func TestWriteFindings_Batch_SplitsLargeReviews(t *testing.T) {
+	srv := &reviewServer{}
+	c, done := newReviewGithub(t, srv, filesCovering("main.tf", 1, 200))
+	defer done()
+
+	var findings []commenter.Finding
+	for i := 1; i <= maxReviewComments+10; i++ {
+		findings = append(findings, commenter.Finding{Path: "main.tf", StartLine: i, EndLine: i, Body: aquaBody(fmt.Sprint(i))})
+	}
+	results, err := c.WriteFindings(context.Background(), findings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.reviews) != 2 || len(srv.reviews[0]) != maxReviewComments || len(srv.reviews[1]) != 10 {
+		t.Fatalf("expected reviews of %d and 10 comments, got %d reviews", maxReviewComments, len(srv.reviews))
+	}
+	if counts := commenter.Summarize(results); counts[commenter.StatusCreated] != len(findings) {
+		t.Fatalf("expected every finding created, got %v", counts)
+	}
+}
+
+func TestWriteFindings_Batch_RejectedReviewFallsBack(t *testing.T) {
+	srv := &reviewServer{rejectAt: 4}
+	c, done := newReviewGithub(t, srv, filesCovering("main.tf", 1, 20))
+	defer done()
+
+	results, err := c.WriteFindings(context.Background(), []commenter.Finding{
+		{Path: "main.tf", StartLine: 3, EndLine: 3, Body: aquaBody("a")},
+		{Path: "main.tf", StartLine: 4, EndLine: 4, Body: aquaBody("rejected")},
+		{Path: "main.tf", StartLine: 5, EndLine: 5, Body: aquaBody("c")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.reviews) != 0 {
+		t.Fatalf("expected the review to be rejected, got %d", len(srv.reviews))
+	}
+	if srv.creates != 2 {
+		t.Fatalf("expected 2 individual comments, got %d", srv.creates)
+	}
+	if results[0].Status != commenter.StatusCreated || results[2].Status != commenter.StatusCreated {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[1].Status != commenter.StatusFailed {
+		t.Fatalf("expected rejected comment to fail, got %+v", results[1])
+	}
+}
+
+func TestWriteFindings_Batch_FailedReviewIsNotRewritten(t *testing.T) {
+	srv := &reviewServer{failStatus: http.StatusBadGateway}
+	c, done := newReviewGithub(t, srv, filesCovering("main.tf", 1, 20))
+	defer done()
+
+	results, err := c.WriteFindings(context.Background(), []commenter.Finding{
+		{Path: "main.tf", StartLine: 3, EndLine: 3, Body: aquaBody("a")},
+		{Path: "main.tf", StartLine: 5, EndLine: 5, Body: aquaBody("b")},
+	})
+	if err == nil {
+		t.Fatalf("expected the failed review to be reported")
+	}
+	if srv.creates != 0 {
+		t.Fatalf("expected no individual comment, got %d", srv.creates)
+	}
+	for i, r := range results {
+		if r.Status != commenter.StatusFailed || r.Err == nil {
+			t.Fatalf("finding %d: expected a failure, got %+v", i, r)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+	"github.com/google/go-github/v44/github"
+)
+
+// UpsertSummary keeps the summary as an issue comment on the PR conversation,
+// edited in place on later runs.
+func (c *Github) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	body = commenter.SummaryBody(body, id, fingerprint.GitHub)
+
+	existing, err := c.findSummary(ctx, commenter.SummaryMarker(id, fingerprint.GitHub))
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("list issue comments: %w", err)}
+	}
+	if existing == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		created, _, err := c.ghConnector.comments.CreateComment(ctx, c.Owner, c.Repo, c.PrNumber, &github.IssueComment{Body: &body})
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("create summary comment: %w", mapError(err))}
+		}
+		return summaryResult(created, commenter.StatusCreated)
+	}
+	if existing.GetBody() == body {
+		return summaryResult(existing, commenter.StatusUnchanged)
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: strconv.FormatInt(existing.GetID(), 10), Body: body, Reason: "summary"}) {
+		return summaryResult(existing, commenter.StatusEdited)
+	}
+	edited, _, err := c.ghConnector.comments.EditComment(ctx, c.Owner, c.Repo, existing.GetID(), &github.IssueComment{Body: &body})
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: strconv.FormatInt(existing.GetID(), 10),
+			Err: fmt.Errorf("edit summary comment %d: %w", existing.GetID(), mapError(err))}
+	}
+	return summaryResult(edited, commenter.StatusEdited)
+}
+
+func (c *Github) findSummary(ctx context.Context, marker string) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: listPageSize}}
+	for {
+		comments, resp, err := c.ghConnector.comments.ListComments(ctx, c.Owner, c.Repo, c.PrNumber, opts)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), marker) {
+				return comment, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func summaryResult(comment *github.IssueComment, status commenter.Status) commenter.Result {
+	return commenter.Result{
+		Status:    status,
+		CommentID: strconv.FormatInt(comment.GetID(), 10),
+		URL:       comment.GetHTMLURL(),
+	}
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+	gh "github.com/google/go-github/v44/github"
+)
+
+func newSummaryGithub(t *testing.T, existing []*gh.IssueComment) (*Github, *[]string, func()) {
+	t.Helper()
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/issues/42/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(existing)
+		case http.MethodPost:
+			calls = append(calls, "create")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":5,"html_url":"https://github.com/c/5"}`))
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/comments/", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":3}`))
+	})
+	ts := httptest.NewServer(mux)
+
+	client := gh.NewClient(nil)
+	base, _ := url.Parse(ts.URL + "/")
+	client.BaseURL = base
+
+	return &Github{
+		Owner:       "owner",
+		Repo:        "repo",
+		PrNumber:    42,
+		ghConnector: &connector{comments: client.Issues},
+	}, &calls, ts.Close
+}
+
+func issueComment(id int64, body string) *gh.IssueComment {
+	return &gh.IssueComment{ID: &id, Body: &body}
+}
+
+func TestUpsertSummary_CreatesWhenMissing(t *testing.T) {
+	c, calls, done := newSummaryGithub(t, []*gh.IssueComment{issueComment(1, "unrelated")})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "totals")
+	if result.Status != commenter.StatusCreated || result.CommentID != "5" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 1 || (*calls)[0] != "create" {
+		t.Fatalf("unexpected calls: %v", *calls)
+	}
+}
+
+func TestUpsertSummary_EditsInPlace(t *testing.T) {
+	c, calls, done := newSummaryGithub(t, []*gh.IssueComment{
+		issueComment(1, "unrelated"),
+		issueComment(3, commenter.SummaryBody("old totals", "scan", fingerprint.GitHub)),
+	})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "new totals")
+	if result.Status != commenter.StatusEdited || result.CommentID != "3" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 1 || (*calls)[0] != "PATCH /repos/owner/repo/issues/comments/3" {
+		t.Fatalf("unexpected calls: %v", *calls)
+	}
+}
+
+func TestUpsertSummary_Unchanged(t *testing.T) {
+	c, calls, done := newSummaryGithub(t, []*gh.IssueComment{
+		issueComment(3, commenter.SummaryBody("totals", "scan", fingerprint.GitHub)),
+	})
+	defer done()
+
+	if result := c.UpsertSummary(context.Background(), "scan", "totals"); result.Status != commenter.StatusUnchanged {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("expected no writes, got %v", *calls)
+	}
+}
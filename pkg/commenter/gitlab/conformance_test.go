@@ -0,0 +1,18 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, conformance.Harness{
+		New: conformance.NewFakeBackend(fakeserver.GitLab),
+		Connect: func(t *testing.T, b conformance.Backend) commenter.Repository {
+			return newFakeGitlab(conformance.Server(b))
+		},
+	})
+}
@@ -0,0 +1,145 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
+)
+
+// FileDiff is the diff of a file changed by the merge request
+type FileDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	TooLarge    bool   `json:"too_large"`
+	Collapsed   bool   `json:"collapsed"`
+}
+
+// resolveLine validates the line against the diff of the merge request, and
+// resolves FIRST_AVAILABLE_LINE to the first line of the diff of the file.
+// Lock files are let through, GitLab can't show their diff when it is too
+// large and they are then written as a general comment.
+func (c *Gitlab) resolveLine(ctx context.Context, file string, line int) (int, error) {
+	line, _ = commenter.NormalizeLines(line, line)
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return 0, err
+	}
+	resolved, _, err := d.Resolve(file, line, line)
+	if errors.Is(err, commenter.ErrNotInDiff) && isLockFile(file) {
+		if line == commenter.FIRST_AVAILABLE_LINE {
+			line = 1
+		}
+		return line, nil
+	}
+	return resolved, err
+}
+
+// resolveFile validates the file against the diff of the merge request.
+func (c *Gitlab) resolveFile(ctx context.Context, file string) error {
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return err
+	}
+	if !d.Has(file) {
+		return commenter.NotInDiffError{Path: file}
+	}
+	return nil
+}
+
+// findingBody renders the suggestion of the finding as a suggestion block,
+// whose offsets extend the line of the note to the end line, when a single
+// hunk of the diff covers its lines, as a diff block otherwise.
+func (c *Gitlab) findingBody(ctx context.Context, f commenter.Finding) (string, error) {
+	if f.Suggestion == "" {
+		return f.Body, nil
+	}
+	d, err := c.loadDiff(ctx)
+	if err != nil {
+		return "", err
+	}
+	format := commenter.SuggestionDiff
+	startLine, endLine := commenter.NormalizeLines(f.StartLine, f.EndLine)
+	if startLine != commenter.FIRST_AVAILABLE_LINE {
+		if _, _, err := d.Resolve(f.Path, startLine, endLine); err == nil {
+			format = commenter.SuggestionOffsets
+		}
+	}
+	return commenter.RenderSuggestion(f, format), nil
+}
+
+// loadDiff gets the diff of the merge request once.
+func (c *Gitlab) loadDiff(ctx context.Context) (*diff.Diff, error) {
+	if c.diff != nil {
+		return c.diff, nil
+	}
+	files, err := c.getDiffs(ctx, nil, "1")
+	var statusErr *transport.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		// the diffs endpoint was added in GitLab 15.7
+		files, err = c.getChanges(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed get merge request diff: %w", commenter.PrError(err, c.Repo, c.PrNumber))
+	}
+
+	d := diff.New()
+	for _, f := range files {
+		switch {
+		case f.DeletedFile:
+		case f.Diff == "" && (f.TooLarge || f.Collapsed):
+			d.AddFile(f.NewPath)
+		default:
+			d.AddPatch(f.NewPath, f.Diff)
+		}
+	}
+	c.diff = d
+	return d, nil
+}
+
+func (c *Gitlab) getDiffs(ctx context.Context, files []FileDiff, page string) ([]FileDiff, error) {
+	resp, err := c.httpClient().Get(ctx,
+		fmt.Sprintf("%s/projects/%s/merge_requests/%s/diffs?page=%s", c.ApiURL, c.Repo, c.PrNumber, page),
+		map[string]string{"PRIVATE-TOKEN": c.Token})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var diffs []FileDiff
+	if err := json.NewDecoder(resp.Body).Decode(&diffs); err != nil {
+		return nil, fmt.Errorf("failed decoding gitlab diffs response with error: %w", err)
+	}
+	files = append(files, diffs...)
+
+	if resp.Header.Get("x-next-page") == "" {
+		return files, nil
+	}
+	return c.getDiffs(ctx, files, resp.Header.Get("x-next-page"))
+}
+
+func (c *Gitlab) getChanges(ctx context.Context) ([]FileDiff, error) {
+	resp, err := c.httpClient().Get(ctx,
+		fmt.Sprintf("%s/projects/%s/merge_requests/%s/changes", c.ApiURL, c.Repo, c.PrNumber),
+		map[string]string{"PRIVATE-TOKEN": c.Token})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var mr struct {
+		Changes []FileDiff `json:"changes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&mr); err != nil {
+		return nil, fmt.Errorf("failed decoding gitlab changes response with error: %w", err)
+	}
+	return mr.Changes, nil
+}
@@ -0,0 +1,126 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/conformance"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fakeserver"
+)
+
+const fakePatch = "@@ -1,5 +1,10 @@\n a\n+b\n+c\n+d\n+e\n+f\n g\n h\n i\n j\n"
+
+func newFakeGitlab(s *fakeserver.Server) *Gitlab {
+	return &Gitlab{ApiURL: s.APIURL(), Token: "token", Repo: fakeserver.Project, PrNumber: strconv.Itoa(fakeserver.PRNumber), HTTPClient: s.Client()}
+}
+
+func TestFakeServer_FileComment(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+
+	c := newFakeGitlab(s)
+	if result := c.WriteFileComment(context.Background(), conformance.Finding("a.go", 40, "deadbeef", "on the file")); result.Status != commenter.StatusCreated {
+		t.Fatalf("expected a file comment, got %+v", result)
+	}
+	if result := c.WriteFileComment(context.Background(), conformance.Finding("b.go", 3, "cafebabe", "file not changed")); !errors.Is(result.Err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected the unchanged file to be skipped, got %+v", result)
+	}
+	threads := s.Threads()
+	if len(threads) != 1 || threads[0].Path != "a.go" || threads[0].Line != 0 {
+		t.Fatalf("expected one discussion on the file, got %+v", threads)
+	}
+}
+
+func TestFakeServer_DiffFromChangesOnOlderGitlab(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.Inject(fakeserver.Fault{Method: http.MethodGet, Path: "/diffs", Status: http.StatusNotFound, Body: `{"message":"404 Not found"}`})
+
+	c := newFakeGitlab(s)
+	if err := c.WriteLineComment("a.go", "body", 3); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := c.WriteLineComment("a.go", "body", 40); !errors.Is(err, commenter.ErrNotInDiff) {
+		t.Fatalf("expected a not in diff error, got %v", err)
+	}
+	if n := s.Count(http.MethodGet, "/changes"); n != 1 {
+		t.Fatalf("expected the changes to be loaded once, got %d", n)
+	}
+}
+
+func TestFakeServer_FirstAvailableLineIsFirstDiffLine(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+	s.AddFile("a.go", "@@ -8,3 +8,4 @@\n h\n+i\n j\n k\n")
+
+	if err := newFakeGitlab(s).WriteLineComment("a.go", "body", commenter.FIRST_AVAILABLE_LINE); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if threads := s.Threads(); len(threads) != 1 || threads[0].Line != 8 {
+		t.Fatalf("expected a comment on line 8, got %+v", threads)
+	}
+}
+
+func TestFakeServer_UpsertSummary(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+
+	c := newFakeGitlab(s)
+	for i, want := range []commenter.Status{commenter.StatusCreated, commenter.StatusUnchanged, commenter.StatusEdited} {
+		body := "totals"
+		if i == 2 {
+			body = "new totals"
+		}
+		if result := c.UpsertSummary(context.Background(), "scan", body); result.Status != want {
+			t.Fatalf("run %d: expected %s, got %+v", i, want, result)
+		}
+	}
+	if comments := s.Comments(); len(comments) != 1 || !strings.Contains(comments[0].Body, "new totals") {
+		t.Fatalf("unexpected comments %+v", comments)
+	}
+}
+
+func TestFakeServer_RetriesRateLimitedWrites(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+	s.Inject(fakeserver.Fault{Method: http.MethodPost, Path: "/discussions", Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": {"3"}}, Times: 1})
+
+	result := newFakeGitlab(s).WriteFinding(context.Background(), conformance.Finding("a.go", 3, "deadbeef", "first"))
+	if result.Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be written once the limit is lifted, got %+v", result)
+	}
+	if sleeps := s.Sleeps(); len(sleeps) != 1 || sleeps[0] != 3*time.Second {
+		t.Fatalf("expected to wait as asked by Retry-After, got %v", sleeps)
+	}
+	if n := len(s.Comments()); n != 1 {
+		t.Fatalf("expected a single note, got %d", n)
+	}
+}
+
+func TestFakeServer_SuggestionOffsets(t *testing.T) {
+	s := fakeserver.New(fakeserver.GitLab)
+	defer s.Close()
+	s.AddFile("a.go", fakePatch)
+
+	f := conformance.Finding("a.go", 3, "deadbeef", "outdated")
+	f.EndLine = 5
+	f.Suggestion = "fixed"
+	result := newFakeGitlab(s).WriteFinding(context.Background(), f)
+	if result.Status != commenter.StatusCreated {
+		t.Fatalf("expected the finding to be created, got %+v", result)
+	}
+	threads := s.Threads()
+	if len(threads) != 1 || threads[0].Line != 3 || !strings.Contains(threads[0].Comments[0].Body, "```suggestion:-0+2\nfixed\n```") {
+		t.Fatalf("expected a suggestion on line 3 extended to line 5, got %+v", threads)
+	}
+}
@@ -1,7 +1,9 @@
 package gitlab
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,10 +13,12 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils"
 	"github.com/samber/lo"
 
 	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/utils/diff"
 )
 
 type DiscussionNote struct {
@@ -27,8 +31,18 @@ type Discussion struct {
 }
 
 type Note struct {
-	Id   int    `json:"id,omitempty"`
-	Body string `json:"body,omitempty"`
+	Id         int       `json:"id,omitempty"`
+	Body       string    `json:"body,omitempty"`
+	Resolvable bool      `json:"resolvable,omitempty"`
+	Resolved   bool      `json:"resolved,omitempty"`
+	Position   *Position `json:"position,omitempty"`
+}
+
+type Position struct {
+	NewPath string `json:"new_path,omitempty"`
+	OldPath string `json:"old_path,omitempty"`
+	NewLine *int   `json:"new_line,omitempty"`
+	OldLine *int   `json:"old_line,omitempty"`
 }
 
 type Version struct {
@@ -47,6 +61,11 @@ type Gitlab struct {
 	Token    string
 	Repo     string
 	PrNumber string
+	// HTTPClient sends the requests, transport.Default when nil
+	HTTPClient *transport.Client
+
+	webUrl string
+	diff   *diff.Diff
 }
 
 var lockFiles = []string{"package.json", "yarn.lock"}
@@ -73,13 +92,44 @@ func (c *Gitlab) WriteMultiLineComment(file, comment string, startLine, _ int) e
 
 // WriteLineComment writes a single review line on a file of the gitlab PR
 func (c *Gitlab) WriteLineComment(file, comment string, line int) error {
-	if line == 0 {
-		line = 1
+	_, err := c.writeLineComment(context.Background(), file, comment, line)
+	return err
+}
+
+// WriteFinding writes the finding as a merge request discussion and reports the note it produced
+func (c *Gitlab) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	// In gitlab we support one line only
+	if _, err := c.resolveLine(ctx, f.Path, f.StartLine); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	body, err := c.findingBody(ctx, f)
+	if err != nil {
+		return commenter.FailedResult(f, err)
 	}
+	if dryrun.Intercept(ctx, dryrun.Created(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	note, err := c.writeLineComment(ctx, f.Path, body, f.StartLine)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(note.Id),
+		URL:       c.noteUrl(ctx, note.Id),
+	}
+}
 
-	version, err := c.getLatestVersion()
+func (c *Gitlab) writeLineComment(ctx context.Context, file, comment string, line int) (Note, error) {
+	line, err := c.resolveLine(ctx, file, line)
 	if err != nil {
-		return fmt.Errorf("failed get latest version: %w", err)
+		return Note{}, err
+	}
+
+	version, err := c.getLatestVersion(ctx)
+	if err != nil {
+		return Note{}, fmt.Errorf("failed get latest version: %w", err)
 	}
 	urlValues := url.Values{
 		"position[position_type]": {"text"},
@@ -92,99 +142,197 @@ func (c *Gitlab) WriteLineComment(file, comment string, line int) error {
 		"body":                    {comment},
 	}
 
-	if line == commenter.FIRST_AVAILABLE_LINE {
-		line = 1
-		urlValues["position[new_line]"] = []string{strconv.Itoa(line)}
+	note, err := c.postDiscussion(ctx, urlValues)
+	if !rejected(err) {
+		return note, err
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions",
-		c.ApiURL, c.Repo, c.PrNumber),
-		strings.NewReader(urlValues.Encode()))
-	if err != nil {
-		return err
+	fmt.Printf("failed to write comment to file: %s, trying again... \n", file)
+	urlValues["position[old_line]"] = []string{strconv.Itoa(line)}
+	note, err = c.postDiscussion(ctx, urlValues)
+	if err == nil {
+		fmt.Println("comment created successfully")
+		return note, nil
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("PRIVATE-TOKEN", c.Token)
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	if !rejected(err) {
+		return Note{}, err
 	}
-	if resp.StatusCode != http.StatusCreated {
-		fmt.Printf("failed to write comment to file: %s, trying again... \n", file)
-		urlValues["position[old_line]"] = []string{strconv.Itoa(line)}
-		req, err := http.NewRequest("POST", fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions",
-			c.ApiURL, c.Repo, c.PrNumber),
-			strings.NewReader(urlValues.Encode()))
-		if err != nil {
-			return err
+
+	if isLockFile(file) {
+		note, generalErr := c.writeGeneralPrComment(ctx, file, comment)
+		if generalErr == nil {
+			fmt.Println("comment created successfully")
+			return note, nil
 		}
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Add("PRIVATE-TOKEN", c.Token)
-		resp, err := client.Do(req)
-		if err != nil {
-			return err
-		}
-		if resp.StatusCode != http.StatusCreated {
-			if lo.ContainsBy(lockFiles, func(lf string) bool {
-				return strings.Contains(string(file), lf)
-			}) {
-				resp, err := c.writeGeneralPrComment(file, comment)
-				if err != nil {
-					return err
-				} else if resp.StatusCode == http.StatusCreated {
-					fmt.Println("comment created successfully")
-					return nil
-				}
-			}
-			b, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("failed to write comment to file: %s, on line: %d, with gitlab error: %s", file, line, string(b))
+		if !rejected(generalErr) {
+			return Note{}, generalErr
 		}
+	}
+	if outsideDiff(err) {
+		return Note{}, commenter.NotInDiffError{Path: file, Line: line, Err: err}
+	}
+	return Note{}, fmt.Errorf("failed to write comment to file: %s, on line: %d, with gitlab error: %w", file, line, err)
+}
 
-		fmt.Println("comment created successfully")
+// WriteFileComment writes the finding on its file. GitLab before 16.4 has no
+// file position, the finding is then written as a general comment naming the
+// file.
+func (c *Gitlab) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	if err := c.resolveFile(ctx, f.Path); err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	// a file comment can't replace lines, the suggestion is shown as a diff
+	body := commenter.RenderSuggestion(f, commenter.SuggestionDiff)
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f).WithBody(body)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	note, err := c.writeFileComment(ctx, f.Path, body)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	return commenter.Result{
+		Finding:   f,
+		Status:    commenter.StatusCreated,
+		CommentID: strconv.Itoa(note.Id),
+		URL:       c.noteUrl(ctx, note.Id),
 	}
+}
 
-	return nil
+func (c *Gitlab) writeFileComment(ctx context.Context, file, comment string) (Note, error) {
+	version, err := c.getLatestVersion(ctx)
+	if err != nil {
+		return Note{}, fmt.Errorf("failed get latest version: %w", err)
+	}
+	note, err := c.postDiscussion(ctx, url.Values{
+		"position[position_type]": {"file"},
+		"position[base_sha]":      {version.BaseCommitSha},
+		"position[head_sha]":      {version.HeadCommitSha},
+		"position[start_sha]":     {version.StartCommitSha},
+		"position[new_path]":      {file},
+		"position[old_path]":      {file},
+		"body":                    {comment},
+	})
+	if !rejected(err) {
+		return note, err
+	}
+	note, err = c.postDiscussion(ctx, url.Values{"body": {fmt.Sprintf("**File Path:** `%s`\n\n%s", file, comment)}})
+	if err != nil {
+		return Note{}, fmt.Errorf("failed to write comment to file: %s, with gitlab error: %w", file, err)
+	}
+	return note, nil
+}
+
+func isLockFile(file string) bool {
+	return lo.ContainsBy(lockFiles, func(lf string) bool {
+		return strings.Contains(file, lf)
+	})
+}
+
+// rejected tells a position GitLab refused to create the discussion on from
+// any other failure.
+func rejected(err error) bool {
+	var statusErr *transport.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest
+}
+
+// outsideDiff tells a position GitLab refused as the line isn't in the diff,
+// which it reports as an invalid line code.
+func outsideDiff(err error) bool {
+	var statusErr *transport.StatusError
+	return rejected(err) && errors.As(err, &statusErr) && strings.Contains(statusErr.Body, "line_code")
 }
 
-func (c *Gitlab) writeGeneralPrComment(file, comment string) (*http.Response, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/projects/%s/merge_requests/%s/notes",
-		c.ApiURL, c.Repo, c.PrNumber),
-		strings.NewReader(url.Values{"body": {expendComment(comment, file)}}.Encode()))
+func (c *Gitlab) httpClient() *transport.Client {
+	return commenter.HTTPClient(c.HTTPClient)
+}
+
+func (c *Gitlab) postForm(ctx context.Context, endpoint string, values url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("PRIVATE-TOKEN", c.Token)
-	resp, err := client.Do(req)
+	return c.httpClient().Do(req)
+}
+
+func (c *Gitlab) postDiscussion(ctx context.Context, values url.Values) (Note, error) {
+	resp, err := c.postForm(ctx, c.discussionsUrl(), values)
 	if err != nil {
-		return nil, err
+		return Note{}, err
+	}
+	return decodeDiscussionNote(resp)
+}
+
+func decodeDiscussionNote(resp *http.Response) (Note, error) {
+	defer func() { _ = resp.Body.Close() }()
+	var discussion Discussion
+	if err := json.NewDecoder(resp.Body).Decode(&discussion); err != nil {
+		return Note{}, fmt.Errorf("failed decoding gitlab discussion response with error: %w", err)
+	}
+	if len(discussion.Notes) == 0 {
+		return Note{}, nil
+	}
+	return discussion.Notes[0], nil
+}
+
+func (c *Gitlab) writeGeneralPrComment(ctx context.Context, file, comment string) (Note, error) {
+	resp, err := c.postForm(ctx, c.notesUrl(), url.Values{"body": {expendComment(comment, file)}})
+	if err != nil {
+		return Note{}, err
 	}
-	return resp, nil
+	defer func() { _ = resp.Body.Close() }()
+	var note Note
+	if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
+		return Note{}, fmt.Errorf("failed decoding gitlab note response with error: %w", err)
+	}
+	return note, nil
+}
+
+// noteUrl links to a note in the merge request page. The page URL is only
+// available from the merge request itself, so it is fetched once and cached.
+func (c *Gitlab) noteUrl(ctx context.Context, noteId int) string {
+	if noteId == 0 {
+		return ""
+	}
+	if c.webUrl == "" {
+		resp, err := c.httpClient().Get(ctx, fmt.Sprintf("%s/projects/%s/merge_requests/%s",
+			c.ApiURL, c.Repo, c.PrNumber), map[string]string{"PRIVATE-TOKEN": c.Token})
+		if err != nil {
+			return ""
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var mr struct {
+			WebUrl string `json:"web_url"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&mr) != nil {
+			return ""
+		}
+		c.webUrl = mr.WebUrl
+	}
+	return fmt.Sprintf("%s#note_%d", c.webUrl, noteId)
+}
+
+func (c *Gitlab) discussionsUrl() string {
+	return fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions", c.ApiURL, c.Repo, c.PrNumber)
 }
 
 func expendComment(comment, file string) string {
 	return fmt.Sprintf("%s\n\n %s\n %s", "_The comment could not be added to the file because the size of the source diff is too large._", fmt.Sprintf("**File Path:** `%s`", file), comment)
 }
 
-func (c *Gitlab) getLatestVersion() (v Version, err error) {
+func (c *Gitlab) getLatestVersion(ctx context.Context) (v Version, err error) {
 	var vData []Version
 
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/projects/%s/merge_requests/%s/versions",
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%s/merge_requests/%s/versions",
 		c.ApiURL, c.Repo, c.PrNumber), nil)
 	if err != nil {
 		return v, err
 	}
 	req.Header.Add("PRIVATE-TOKEN", c.Token)
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return v, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return v, fmt.Errorf("failed get gitlab PR version: %s", string(b))
+		return v, fmt.Errorf("failed get gitlab PR version: %w", commenter.PrError(err, c.Repo, c.PrNumber))
 	}
 	defer func() { _ = resp.Body.Close() }()
 	err = json.NewDecoder(resp.Body).Decode(&vData)
@@ -199,15 +347,23 @@ func (c *Gitlab) getLatestVersion() (v Version, err error) {
 }
 
 func (c *Gitlab) RemovePreviousAquaComments(msg string) error {
+	return c.RemoveAquaComments(context.Background(), msg)
+}
+
+// RemoveAquaComments deletes every discussion note containing the marker
+func (c *Gitlab) RemoveAquaComments(ctx context.Context, msg string) error {
 
 	var idsToRemove []DiscussionNote
-	idsToRemove, err := c.getIdsToRemove(idsToRemove, msg, "1")
+	idsToRemove, err := c.getIdsToRemove(ctx, idsToRemove, msg, "1")
 	if err != nil {
 		return err
 	}
 
 	for _, idToRemove := range idsToRemove {
-		err = utils.DeleteComments(fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions/%s/notes/%s",
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(idToRemove.NoteId), "", "")) {
+			continue
+		}
+		err = c.httpClient().Delete(ctx, fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions/%s/notes/%s",
 			c.ApiURL, c.Repo, c.PrNumber, idToRemove.DiscussionId, strconv.Itoa(idToRemove.NoteId)), map[string]string{"PRIVATE-TOKEN": c.Token})
 		if err != nil {
 			return err
@@ -218,8 +374,27 @@ func (c *Gitlab) RemovePreviousAquaComments(msg string) error {
 
 }
 
-func (c *Gitlab) getIdsToRemove(idsToRemove []DiscussionNote, msg, page string) ([]DiscussionNote, error) {
-	resp, err := utils.GetComments(
+func (c *Gitlab) getIdsToRemove(ctx context.Context, idsToRemove []DiscussionNote, msg, page string) ([]DiscussionNote, error) {
+	discussions, err := c.getDiscussions(ctx, nil, page)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, discussion := range discussions {
+		for _, note := range discussion.Notes {
+			if strings.Contains(note.Body, msg) {
+				idsToRemove = append(idsToRemove, DiscussionNote{
+					DiscussionId: discussion.Id,
+					NoteId:       note.Id,
+				})
+			}
+		}
+	}
+	return idsToRemove, nil
+}
+
+func (c *Gitlab) getDiscussions(ctx context.Context, discussions []Discussion, page string) ([]Discussion, error) {
+	resp, err := c.httpClient().Get(ctx,
 		fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions?page=%s",
 			c.ApiURL,
 			c.Repo,
@@ -227,7 +402,7 @@ func (c *Gitlab) getIdsToRemove(idsToRemove []DiscussionNote, msg, page string)
 			page),
 		map[string]string{"PRIVATE-TOKEN": c.Token})
 	if err != nil {
-		return nil, fmt.Errorf("failed getting comments with error: %w", err)
+		return nil, fmt.Errorf("failed getting comments with error: %w", commenter.PrError(err, c.Repo, c.PrNumber))
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -240,21 +415,11 @@ func (c *Gitlab) getIdsToRemove(idsToRemove []DiscussionNote, msg, page string)
 	if err != nil {
 		return nil, fmt.Errorf("failed unmarshal response body with error: %w", err)
 	}
-
-	for _, discussion := range discussionsResponse {
-		for _, note := range discussion.Notes {
-			if strings.Contains(note.Body, msg) {
-				idsToRemove = append(idsToRemove, DiscussionNote{
-					DiscussionId: discussion.Id,
-					NoteId:       note.Id,
-				})
-			}
-		}
-	}
+	discussions = append(discussions, discussionsResponse...)
 
 	if resp.Header.Get("x-next-page") == "" {
-		return idsToRemove, nil
+		return discussions, nil
 	}
-	return c.getIdsToRemove(idsToRemove, msg, resp.Header.Get("x-next-page"))
+	return c.getDiscussions(ctx, discussions, resp.Header.Get("x-next-page"))
 
 }
@@ -0,0 +1,174 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+type aquaDiscussion struct {
+	discussion *Discussion
+	note       *Note
+}
+
+func (c *Gitlab) ReconcileAquaComments(marker string, current []commenter.Finding) error {
+	results, err := c.ReconcileFindings(context.Background(), marker, current)
+	if err != nil {
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings edits matching Aqua notes in place, opens discussions for
+// new findings and deletes Aqua notes in discussions that are no longer current.
+// Resolved discussions are never touched.
+func (c *Gitlab) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	discussions, err := c.getDiscussions(ctx, nil, "1")
+	if err != nil {
+		return nil, fmt.Errorf("list discussions: %w", err)
+	}
+
+	aqua := selectAquaDiscussions(discussions, marker)
+	existing := make([]commenter.ExistingComment, 0, len(aqua))
+	for _, a := range aqua {
+		existing = append(existing, a.existingComment())
+	}
+	matches, stale := commenter.MatchFindings(current, existing)
+
+	results := make([]commenter.Result, 0, len(current))
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
+		if matches[i] < 0 {
+			results = append(results, c.WriteFinding(ctx, f))
+			continue
+		}
+
+		a := aqua[matches[i]]
+		id := strconv.Itoa(a.note.Id)
+		if a.isResolved() {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusSkipped, CommentID: id, Reason: "discussion is resolved"})
+			continue
+		}
+		body, err := c.findingBody(ctx, f)
+		if err != nil {
+			results = append(results, commenter.FailedResult(f, err))
+			continue
+		}
+		if commenter.Unchanged(a.note.Body, body) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: id, URL: c.noteUrl(ctx, a.note.Id)})
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Edited(f, id).WithBody(body)) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.noteUrl(ctx, a.note.Id)})
+			continue
+		}
+		if err := c.editNote(ctx, a.discussion.Id, a.note.Id, body); err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: id,
+				Err: fmt.Errorf("edit note %d: %w", a.note.Id, err)})
+			continue
+		}
+		results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: id, URL: c.noteUrl(ctx, a.note.Id)})
+	}
+
+	for _, idx := range stale {
+		a := aqua[idx]
+		if a.isResolved() {
+			continue
+		}
+		if err := c.deleteAquaNotesInDiscussion(ctx, a.discussion, marker); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func selectAquaDiscussions(discussions []Discussion, marker string) []*aquaDiscussion {
+	out := make([]*aquaDiscussion, 0, len(discussions))
+	for i := range discussions {
+		d := &discussions[i]
+		for j := range d.Notes {
+			if strings.Contains(d.Notes[j].Body, marker) {
+				out = append(out, &aquaDiscussion{discussion: d, note: &d.Notes[j]})
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (a *aquaDiscussion) existingComment() commenter.ExistingComment {
+	existing := commenter.ExistingComment{Fingerprint: commenter.ExtractFingerprint(a.note.Body)}
+	if p := a.note.Position; p != nil {
+		existing.Path = p.NewPath
+		// Comments are retried on the old line when the new one is rejected,
+		// so legacy notes can be anchored on either side.
+		switch {
+		case p.NewLine != nil:
+			existing.StartLine = *p.NewLine
+		case p.OldLine != nil:
+			existing.StartLine = *p.OldLine
+		}
+	}
+	return existing
+}
+
+// A discussion is resolved once its first resolvable note is, GitLab resolves
+// every note of the discussion together.
+func (a *aquaDiscussion) isResolved() bool {
+	for _, n := range a.discussion.Notes {
+		if n.Resolvable {
+			return n.Resolved
+		}
+	}
+	return false
+}
+
+func (c *Gitlab) editNote(ctx context.Context, discussionId string, noteId int, body string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.noteApiUrl(discussionId, noteId),
+		strings.NewReader(url.Values{"body": {body}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("PRIVATE-TOKEN", c.Token)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed edit gitlab note: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Only deletes notes authored by Aqua (i.e. carrying the marker) so that any
+// developer replies in the discussion are preserved.
+func (c *Gitlab) deleteAquaNotesInDiscussion(ctx context.Context, d *Discussion, marker string) error {
+	for _, n := range d.Notes {
+		if !strings.Contains(n.Body, marker) {
+			continue
+		}
+		path := ""
+		if n.Position != nil {
+			path = n.Position.NewPath
+		}
+		if dryrun.Intercept(ctx, dryrun.Deleted(strconv.Itoa(n.Id), path, "finding is no longer reported")) {
+			continue
+		}
+		if err := c.httpClient().Delete(ctx, c.noteApiUrl(d.Id, n.Id), map[string]string{"PRIVATE-TOKEN": c.Token}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Gitlab) noteApiUrl(discussionId string, noteId int) string {
+	return fmt.Sprintf("%s/projects/%s/merge_requests/%s/discussions/%s/notes/%d",
+		c.ApiURL, c.Repo, c.PrNumber, discussionId, noteId)
+}
@@ -0,0 +1,248 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+type apiCounts struct {
+	edit, delete, create int32
+}
+
+type discussionFixture struct {
+	resolved    bool
+	path        string
+	line        int
+	fingerprint string
+	body        string
+	noteID      int
+	replies     []string
+}
+
+func renderDiscussions(fixtures []discussionFixture) []Discussion {
+	var out []Discussion
+	for i, f := range fixtures {
+		line := f.line
+		body := commenter.EmbedFingerprint(f.body, f.fingerprint)
+		notes := []Note{{
+			Id:         f.noteID,
+			Body:       body,
+			Resolvable: true,
+			Resolved:   f.resolved,
+			Position:   &Position{NewPath: f.path, OldPath: f.path, NewLine: &line},
+		}}
+		for j, reply := range f.replies {
+			notes = append(notes, Note{Id: f.noteID + j + 1, Body: reply, Resolvable: true, Resolved: f.resolved})
+		}
+		out = append(out, Discussion{Id: "d" + string(rune('a'+i)), Notes: notes})
+	}
+	return out
+}
+
+func newTestGitlab(t *testing.T, fixtures []discussionFixture) (*Gitlab, *apiCounts, func()) {
+	t.Helper()
+	counts := &apiCounts{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/projects/1/merge_requests/2/discussions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(renderDiscussions(fixtures))
+		case http.MethodPost:
+			atomic.AddInt32(&counts.create, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"new","notes":[{"id":999}]}`))
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2/discussions/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			atomic.AddInt32(&counts.edit, 1)
+			_, _ = w.Write([]byte(`{}`))
+		case http.MethodDelete:
+			atomic.AddInt32(&counts.delete, 1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected method %s on %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2/versions", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"head_commit_sha":"h","base_commit_sha":"b","start_commit_sha":"s"}]`))
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2/diffs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"new_path":"a.go","diff":"@@ -1,2 +1,20 @@\n"},{"new_path":"c.go","diff":"@@ -0,0 +1,5 @@\n"}]`))
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"web_url":"https://gitlab.example.com/group/repo/-/merge_requests/2"}`))
+	})
+
+	ts := httptest.NewServer(mux)
+	c := &Gitlab{ApiURL: ts.URL, Token: "x", Repo: "1", PrNumber: "2"}
+	return c, counts, ts.Close
+}
+
+func aquaBody(extra string) string {
+	return extra + "\n" + testMarker
+}
+
+func TestReconcile_ResolvedDiscussionKept_NoApiWrites(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		resolved: true, path: "a.go", line: 10, noteID: 100, fingerprint: "deadbeef", body: aquaBody("old"),
+	}})
+	defer done()
+
+	err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10,
+		Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 0 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected zero writes, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+}
+
+func TestReconcile_MatchedFinding_EditsInPlace(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		path: "a.go", line: 10, noteID: 100, fingerprint: "deadbeef", body: aquaBody("old"),
+	}})
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 12, EndLine: 12,
+		Body:        commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 1 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected edit=1, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+	if results[0].Status != commenter.StatusEdited || results[0].CommentID != "100" ||
+		results[0].URL != "https://gitlab.example.com/group/repo/-/merge_requests/2#note_100" {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestReconcile_LegacyNote_MatchedByPathAndLine(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		path: "a.go", line: 10, noteID: 100, body: aquaBody("legacy"),
+	}})
+	defer done()
+
+	err := c.ReconcileAquaComments(testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 14,
+		Body:        commenter.EmbedFingerprint(aquaBody("now with fingerprint"), "deadbeef"),
+		Fingerprint: "deadbeef",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 1 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected edit=1, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+}
+
+func TestReconcile_StaleDiscussion_DeletesOnlyAquaNotes(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		path: "a.go", line: 10, noteID: 100, fingerprint: "cafebabe", body: aquaBody("gone"),
+		replies: []string{"developer reply", "another developer reply"},
+	}})
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.delete != 1 || counts.edit != 0 || counts.create != 0 {
+		t.Fatalf("expected delete=1, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+}
+
+func TestReconcile_ResolvedStaleDiscussion_Preserved(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		resolved: true, path: "a.go", line: 10, noteID: 100, fingerprint: "cafebabe", body: aquaBody("accepted risk"),
+	}})
+	defer done()
+
+	if err := c.ReconcileAquaComments(testMarker, nil); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 0 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected no writes, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+}
+
+func TestReconcile_NewFinding_OpensDiscussion(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{{
+		path: "a.go", line: 10, noteID: 100, body: "human reviewer comment",
+	}})
+	defer done()
+
+	results, err := c.ReconcileFindings(context.Background(), testMarker, []commenter.Finding{{
+		Path: "a.go", StartLine: 10, EndLine: 10,
+		Body:        commenter.EmbedFingerprint(aquaBody("brand new"), "feedface"),
+		Fingerprint: "feedface",
+	}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.create != 1 || counts.edit != 0 || counts.delete != 0 {
+		t.Fatalf("expected create=1, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+	if results[0].Status != commenter.StatusCreated || !strings.HasSuffix(results[0].URL, "#note_999") {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+}
+
+func TestReconcile_DryRun_RecordsPlanWithoutWrites(t *testing.T) {
+	c, counts, done := newTestGitlab(t, []discussionFixture{
+		{path: "a.go", line: 10, noteID: 100, fingerprint: "deadbeef", body: aquaBody("old")},
+		{path: "b.go", line: 20, noteID: 200, fingerprint: "cafebabe", body: aquaBody("gone")},
+	})
+	defer done()
+
+	plan := dryrun.NewPlan()
+	results, err := c.ReconcileFindings(dryrun.WithPlan(context.Background(), plan), testMarker, []commenter.Finding{
+		{Path: "a.go", StartLine: 10, EndLine: 10, Body: commenter.EmbedFingerprint(aquaBody("new"), "deadbeef"), Fingerprint: "deadbeef"},
+		{Path: "c.go", StartLine: 3, EndLine: 3, Body: aquaBody("brand new"), Fingerprint: "feedface"},
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if counts.edit != 0 || counts.delete != 0 || counts.create != 0 {
+		t.Fatalf("expected no writes, got edit=%d delete=%d create=%d", counts.edit, counts.delete, counts.create)
+	}
+	if results[0].Status != commenter.StatusEdited || results[1].Status != commenter.StatusCreated {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	entries := plan.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Action != dryrun.Edit || e.CommentID != "100" {
+		t.Errorf("unexpected edit entry %+v", e)
+	}
+	if e := entries[1]; e.Action != dryrun.Create || e.Path != "c.go" {
+		t.Errorf("unexpected create entry %+v", e)
+	}
+	if e := entries[2]; e.Action != dryrun.Delete || e.CommentID != "200" || e.Path != "b.go" {
+		t.Errorf("unexpected delete entry %+v", e)
+	}
+}
@@ -0,0 +1,99 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// UpsertSummary keeps the summary as a merge request note, edited in place on later runs.
+func (c *Gitlab) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	body = commenter.SummaryBody(body, id, fingerprint.GitLab)
+
+	existing, err := c.findSummary(ctx, commenter.SummaryMarker(id, fingerprint.GitLab), "1")
+	if err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("list notes: %w", err)}
+	}
+	if existing == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		resp, err := c.postForm(ctx, c.notesUrl(), url.Values{"body": {body}})
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("failed write gitlab summary note: %w", err)}
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var note Note
+		if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: fmt.Errorf("failed decoding gitlab note response with error: %w", err)}
+		}
+		return c.summaryResult(ctx, note.Id, commenter.StatusCreated)
+	}
+	if existing.Body == body {
+		return c.summaryResult(ctx, existing.Id, commenter.StatusUnchanged)
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: strconv.Itoa(existing.Id), Body: body, Reason: "summary"}) {
+		return c.summaryResult(ctx, existing.Id, commenter.StatusEdited)
+	}
+	if err := c.editSummary(ctx, existing.Id, body); err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: strconv.Itoa(existing.Id),
+			Err: fmt.Errorf("edit note %d: %w", existing.Id, err)}
+	}
+	return c.summaryResult(ctx, existing.Id, commenter.StatusEdited)
+}
+
+func (c *Gitlab) findSummary(ctx context.Context, marker, page string) (*Note, error) {
+	resp, err := c.httpClient().Get(ctx, fmt.Sprintf("%s?page=%s", c.notesUrl(), page),
+		map[string]string{"PRIVATE-TOKEN": c.Token})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting notes with error: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var notes []Note
+	if err := json.NewDecoder(resp.Body).Decode(&notes); err != nil {
+		return nil, fmt.Errorf("failed unmarshal response body with error: %w", err)
+	}
+	for i := range notes {
+		if strings.Contains(notes[i].Body, marker) {
+			return &notes[i], nil
+		}
+	}
+
+	if resp.Header.Get("x-next-page") == "" {
+		return nil, nil
+	}
+	return c.findSummary(ctx, marker, resp.Header.Get("x-next-page"))
+}
+
+func (c *Gitlab) editSummary(ctx context.Context, noteId int, body string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s/%d", c.notesUrl(), noteId),
+		strings.NewReader(url.Values{"body": {body}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("PRIVATE-TOKEN", c.Token)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed edit gitlab note: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (c *Gitlab) summaryResult(ctx context.Context, noteId int, status commenter.Status) commenter.Result {
+	return commenter.Result{Status: status, CommentID: strconv.Itoa(noteId), URL: c.noteUrl(ctx, noteId)}
+}
+
+func (c *Gitlab) notesUrl() string {
+	return fmt.Sprintf("%s/projects/%s/merge_requests/%s/notes", c.ApiURL, c.Repo, c.PrNumber)
+}
@@ -0,0 +1,84 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func newSummaryGitlab(t *testing.T, pages ...[]Note) (*Gitlab, *[]string, func()) {
+	t.Helper()
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/projects/1/merge_requests/2/notes", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var page int
+			_, _ = fmt.Sscan(r.URL.Query().Get("page"), &page)
+			if page < len(pages) {
+				w.Header().Set("x-next-page", fmt.Sprint(page+1))
+			}
+			_ = json.NewEncoder(w).Encode(pages[page-1])
+		case http.MethodPost:
+			calls = append(calls, "create")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":77}`))
+		}
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2/notes/", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/projects/1/merge_requests/2", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"web_url":"https://gitlab.example.com/group/repo/-/merge_requests/2"}`))
+	})
+	ts := httptest.NewServer(mux)
+	return &Gitlab{ApiURL: ts.URL, Token: "x", Repo: "1", PrNumber: "2"}, &calls, ts.Close
+}
+
+func TestUpsertSummary_CreatesWhenMissing(t *testing.T) {
+	c, calls, done := newSummaryGitlab(t, []Note{{Id: 1, Body: "unrelated"}})
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "totals")
+	if result.Status != commenter.StatusCreated || result.URL != "https://gitlab.example.com/group/repo/-/merge_requests/2#note_77" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 1 || (*calls)[0] != "create" {
+		t.Fatalf("unexpected calls: %v", *calls)
+	}
+}
+
+func TestUpsertSummary_EditsNoteOnLaterPage(t *testing.T) {
+	c, calls, done := newSummaryGitlab(t,
+		[]Note{{Id: 1, Body: "unrelated"}},
+		[]Note{{Id: 9, Body: commenter.SummaryBody("old totals", "scan", fingerprint.GitLab)}},
+	)
+	defer done()
+
+	result := c.UpsertSummary(context.Background(), "scan", "new totals")
+	if result.Status != commenter.StatusEdited || result.CommentID != "9" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 1 || (*calls)[0] != "PUT /projects/1/merge_requests/2/notes/9" {
+		t.Fatalf("unexpected calls: %v", *calls)
+	}
+}
+
+func TestUpsertSummary_Unchanged(t *testing.T) {
+	c, calls, done := newSummaryGitlab(t, []Note{{Id: 9, Body: commenter.SummaryBody("totals", "scan", fingerprint.GitLab)}})
+	defer done()
+
+	if result := c.UpsertSummary(context.Background(), "scan", "totals"); result.Status != commenter.StatusUnchanged {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("expected no writes, got %v", *calls)
+	}
+}
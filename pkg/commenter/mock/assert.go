@@ -0,0 +1,47 @@
+package mock
+
+import "strings"
+
+// TestingT is the subset of testing.TB the assertions use, so the package
+// doesn't import testing outside of tests.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertCommented fails t unless a comment on path covering line contains text.
+func (c *Mock) AssertCommented(t TestingT, path string, line int, text string) {
+	t.Helper()
+	comments := c.CommentsOn(path, line)
+	for _, comment := range comments {
+		if strings.Contains(comment.Body, text) {
+			return
+		}
+	}
+	t.Errorf("expected a comment on %s:%d containing %q, got %+v", path, line, text, comments)
+}
+
+// AssertNotCommented fails t when a comment on path covers line, line 0
+// checks the whole file.
+func (c *Mock) AssertNotCommented(t TestingT, path string, line int) {
+	t.Helper()
+	if comments := c.CommentsOn(path, line); len(comments) > 0 {
+		t.Errorf("expected no comment on %s:%d, got %+v", path, line, comments)
+	}
+}
+
+// AssertCommentCount fails t unless the PR holds n comments, summaries included.
+func (c *Mock) AssertCommentCount(t TestingT, n int) {
+	t.Helper()
+	if comments := c.Comments(); len(comments) != n {
+		t.Errorf("expected %d comments, got %d: %+v", n, len(comments), comments)
+	}
+}
+
+// AssertCalled fails t unless method was called times times.
+func (c *Mock) AssertCalled(t TestingT, method string, times int) {
+	t.Helper()
+	if calls := c.CallsTo(method); len(calls) != times {
+		t.Errorf("expected %d calls to %s, got %d", times, method, len(calls))
+	}
+}
@@ -1,19 +1,420 @@
 package mock
 
-type Mock struct{}
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+// The methods recorded in the call log
+const (
+	MethodWriteMultiLineComment      = "WriteMultiLineComment"
+	MethodWriteLineComment           = "WriteLineComment"
+	MethodRemovePreviousAquaComments = "RemovePreviousAquaComments"
+	MethodWriteFinding               = "WriteFinding"
+	MethodWriteFindings              = "WriteFindings"
+	MethodReconcileAquaComments      = "ReconcileAquaComments"
+	MethodReconcileFindings          = "ReconcileFindings"
+	MethodRemoveAquaComments         = "RemoveAquaComments"
+	MethodUpsertSummary              = "UpsertSummary"
+	MethodWriteFileComment           = "WriteFileComment"
+)
+
+// Call is one recorded invocation, only the fields of its arguments are set.
+type Call struct {
+	Method    string
+	Path      string
+	StartLine int
+	EndLine   int
+	Body      string
+	// Marker is the marker of removals and reconciliations
+	Marker   string
+	Findings []commenter.Finding
+	// SummaryID is the id of UpsertSummary
+	SummaryID string
+}
+
+// Comment is a comment on the simulated PR. Summaries have no path, comments
+// on a file have no lines.
+type Comment struct {
+	ID        string
+	Path      string
+	StartLine int
+	EndLine   int
+	Body      string
+}
+
+func (c Comment) covers(path string, line int) bool {
+	return c.Path == path && line >= c.StartLine && line <= c.EndLine
+}
+
+type failure struct {
+	path string
+	line int
+	err  error
+}
+
+// Mock keeps the comments of a simulated PR in memory and records every call.
+// Comments are matched on reconciliation the way the providers do, so tests
+// can check the outcome of several runs. It is safe for concurrent use.
+type Mock struct {
+	mu        sync.Mutex
+	nextId    int
+	calls     []Call
+	comments  []Comment
+	summaries map[string]string
+	failures  []failure
+
+	rateLimited bool
+	writesLeft  int
+}
+
+var (
+	_ commenter.Repository   = (*Mock)(nil)
+	_ commenter.RepositoryV2 = (*Mock)(nil)
+	_ commenter.Reconciler   = (*Mock)(nil)
+
+	_ commenter.FileCommentWriter = (*Mock)(nil)
+)
 
 func NewMock() *Mock {
-	return &Mock{}
+	return &Mock{summaries: make(map[string]string)}
+}
+
+// FailComment makes writes to path covering line fail with err, line 0
+// matches every line of the file.
+func (c *Mock) FailComment(path string, line int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, failure{path: path, line: line, err: err})
+}
+
+// RejectComment makes the line behave as if it were outside the PR diff,
+// writes to it return commenter.NotInDiffError and findings are skipped.
+func (c *Mock) RejectComment(path string, line int) {
+	c.FailComment(path, line, commenter.NotInDiffError{Path: path, Line: line})
+}
+
+// RejectCommentNearest is RejectComment for a file the PR changes, nearest is
+// reported as the line of the diff closest to line.
+func (c *Mock) RejectCommentNearest(path string, line, nearest int) {
+	c.FailComment(path, line, commenter.NotInDiffError{Path: path, Line: line, Nearest: nearest})
+}
+
+// RateLimitAfter lets n more writes through, the following ones fail with
+// commenter.RateLimitError.
+func (c *Mock) RateLimitAfter(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rateLimited = true
+	c.writesLeft = n
+}
+
+// Reset forgets the calls, comments and scripted failures.
+func (c *Mock) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+	c.comments = nil
+	c.summaries = make(map[string]string)
+	c.failures = nil
+	c.rateLimited = false
+}
+
+// Calls returns the recorded calls in order.
+func (c *Mock) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// CallsTo returns the recorded calls of method.
+func (c *Mock) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range c.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Comments returns the comments currently on the simulated PR.
+func (c *Mock) Comments() []Comment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Comment(nil), c.comments...)
+}
+
+// CommentsOn returns the comments on path covering line, line 0 matches every
+// comment of the file.
+func (c *Mock) CommentsOn(path string, line int) []Comment {
+	var comments []Comment
+	for _, comment := range c.Comments() {
+		if comment.Path == path && (line == 0 || comment.covers(path, line)) {
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
+
+func (c *Mock) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodWriteMultiLineComment, Path: file, StartLine: startLine, EndLine: endLine, Body: comment})
+	_, err := c.create(file, startLine, endLine, comment)
+	return err
+}
+
+func (c *Mock) WriteLineComment(file, comment string, line int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodWriteLineComment, Path: file, StartLine: line, EndLine: line, Body: comment})
+	_, err := c.create(file, line, line, comment)
+	return err
+}
+
+func (c *Mock) RemovePreviousAquaComments(msg string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodRemovePreviousAquaComments, Marker: msg})
+	return c.remove(context.Background(), msg)
+}
+
+func (c *Mock) WriteFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodWriteFinding, Path: f.Path, StartLine: f.StartLine, EndLine: f.EndLine, Body: f.Body})
+	return c.writeFinding(ctx, f)
+}
+
+// WriteFileComment writes a comment on the file, without lines.
+func (c *Mock) WriteFileComment(ctx context.Context, f commenter.Finding) commenter.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodWriteFileComment, Path: f.Path, Body: f.Body})
+	if dryrun.Intercept(ctx, dryrun.FileCreated(f)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	created, err := c.create(f.Path, 0, 0, f.Body)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	return commenter.Result{Finding: f, Status: commenter.StatusCreated, CommentID: created.ID}
+}
+
+func (c *Mock) WriteFindings(ctx context.Context, findings []commenter.Finding) ([]commenter.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodWriteFindings, Findings: findings})
+
+	results := make([]commenter.Result, 0, len(findings))
+	for _, f := range findings {
+		if err := ctx.Err(); err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, Err: err})
+			continue
+		}
+		results = append(results, c.writeFinding(ctx, f))
+	}
+	return results, ctx.Err()
+}
+
+func (c *Mock) ReconcileAquaComments(marker string, current []commenter.Finding) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodReconcileAquaComments, Marker: marker, Findings: current})
+	results, err := c.reconcile(context.Background(), marker, current)
+	if err != nil {
+		return err
+	}
+	return commenter.FirstError(results)
+}
+
+// ReconcileFindings edits the Aqua comments matching a finding, comments new
+// findings and deletes the Aqua comments no finding claimed.
+func (c *Mock) ReconcileFindings(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodReconcileFindings, Marker: marker, Findings: current})
+	return c.reconcile(ctx, marker, current)
+}
+
+func (c *Mock) RemoveAquaComments(ctx context.Context, msg string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodRemoveAquaComments, Marker: msg})
+	return c.remove(ctx, msg)
+}
+
+// UpsertSummary keeps one comment per summary id, edited in place.
+func (c *Mock) UpsertSummary(ctx context.Context, id, body string) commenter.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(Call{Method: MethodUpsertSummary, SummaryID: id, Body: body})
+
+	existing := c.find(c.summaries[id])
+	if existing == nil {
+		if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Create, Body: body, Reason: "summary"}) {
+			return commenter.Result{Status: commenter.StatusCreated}
+		}
+		created, err := c.create("", 0, 0, body)
+		if err != nil {
+			return commenter.Result{Status: commenter.StatusFailed, Err: err}
+		}
+		c.summaries[id] = created.ID
+		return commenter.Result{Status: commenter.StatusCreated, CommentID: created.ID}
+	}
+	if existing.Body == body {
+		return commenter.Result{Status: commenter.StatusUnchanged, CommentID: existing.ID}
+	}
+	if dryrun.Intercept(ctx, dryrun.Entry{Action: dryrun.Edit, CommentID: existing.ID, Body: body, Reason: "summary"}) {
+		return commenter.Result{Status: commenter.StatusEdited, CommentID: existing.ID}
+	}
+	if err := c.scriptedError(existing.Path, existing.StartLine, existing.EndLine); err != nil {
+		return commenter.Result{Status: commenter.StatusFailed, CommentID: existing.ID, Err: err}
+	}
+	existing.Body = body
+	return commenter.Result{Status: commenter.StatusEdited, CommentID: existing.ID}
+}
+
+func (c *Mock) record(call Call) {
+	c.calls = append(c.calls, call)
+}
+
+func (c *Mock) writeFinding(ctx context.Context, f commenter.Finding) commenter.Result {
+	if dryrun.Intercept(ctx, dryrun.Created(f)) {
+		return commenter.Result{Finding: f, Status: commenter.StatusCreated}
+	}
+	created, err := c.create(f.Path, f.StartLine, f.EndLine, f.Body)
+	if err != nil {
+		return commenter.FailedResult(f, err)
+	}
+	return commenter.Result{Finding: f, Status: commenter.StatusCreated, CommentID: created.ID}
+}
+
+func (c *Mock) reconcile(ctx context.Context, marker string, current []commenter.Finding) ([]commenter.Result, error) {
+	var aqua []string
+	var existing []commenter.ExistingComment
+	for _, comment := range c.comments {
+		if comment.Path == "" || !strings.Contains(comment.Body, marker) {
+			continue
+		}
+		aqua = append(aqua, comment.ID)
+		existing = append(existing, commenter.ExistingComment{
+			Path:        comment.Path,
+			StartLine:   comment.StartLine,
+			EndLine:     comment.EndLine,
+			Fingerprint: commenter.ExtractFingerprint(comment.Body),
+		})
+	}
+	matches, stale := commenter.MatchFindings(current, existing)
+
+	results := make([]commenter.Result, 0, len(current))
+	for i, f := range current {
+		if err := ctx.Err(); err != nil {
+			return append(results, commenter.FailFindings(current[i:], err)...), err
+		}
+		if matches[i] < 0 {
+			results = append(results, c.writeFinding(ctx, f))
+			continue
+		}
+
+		comment := c.find(aqua[matches[i]])
+		if commenter.Unchanged(comment.Body, f.Body) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusUnchanged, CommentID: comment.ID})
+			continue
+		}
+		if dryrun.Intercept(ctx, dryrun.Edited(f, comment.ID)) {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: comment.ID})
+			continue
+		}
+		if err := c.scriptedError(comment.Path, comment.StartLine, comment.EndLine); err != nil {
+			results = append(results, commenter.Result{Finding: f, Status: commenter.StatusFailed, CommentID: comment.ID, Err: err})
+			continue
+		}
+		comment.Body = f.Body
+		results = append(results, commenter.Result{Finding: f, Status: commenter.StatusEdited, CommentID: comment.ID})
+	}
+
+	for _, idx := range stale {
+		if err := c.delete(ctx, aqua[idx], "finding is no longer reported"); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func (c *Mock) remove(ctx context.Context, msg string) error {
+	var ids []string
+	for _, comment := range c.comments {
+		if strings.Contains(comment.Body, msg) {
+			ids = append(ids, comment.ID)
+		}
+	}
+	for _, id := range ids {
+		if err := c.delete(ctx, id, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Mock) create(path string, startLine, endLine int, body string) (Comment, error) {
+	if endLine < startLine {
+		endLine = startLine
+	}
+	if err := c.scriptedError(path, startLine, endLine); err != nil {
+		return Comment{}, err
+	}
+	c.nextId++
+	comment := Comment{ID: strconv.Itoa(c.nextId), Path: path, StartLine: startLine, EndLine: endLine, Body: body}
+	c.comments = append(c.comments, comment)
+	return comment, nil
 }
 
-func (c *Mock) WriteMultiLineComment(_, _ string, _, _ int) error {
+func (c *Mock) delete(ctx context.Context, id, reason string) error {
+	comment := c.find(id)
+	if dryrun.Intercept(ctx, dryrun.Deleted(id, comment.Path, reason)) {
+		return nil
+	}
+	if err := c.scriptedError(comment.Path, comment.StartLine, comment.EndLine); err != nil {
+		return err
+	}
+	for i := range c.comments {
+		if c.comments[i].ID == id {
+			c.comments = append(c.comments[:i], c.comments[i+1:]...)
+			break
+		}
+	}
 	return nil
 }
 
-func (c *Mock) WriteLineComment(_, _ string, _ int) error {
+func (c *Mock) find(id string) *Comment {
+	for i := range c.comments {
+		if c.comments[i].ID == id {
+			return &c.comments[i]
+		}
+	}
 	return nil
 }
 
-func (c *Mock) RemovePreviousAquaComments(_ string) error {
+// scriptedError returns the failure scripted for a write to the lines, and
+// otherwise counts the write towards the rate limit.
+func (c *Mock) scriptedError(path string, startLine, endLine int) error {
+	for _, f := range c.failures {
+		if f.path == path && (f.line == 0 || (f.line >= startLine && f.line <= endLine)) {
+			return f.err
+		}
+	}
+	if c.rateLimited {
+		if c.writesLeft <= 0 {
+			return commenter.RateLimitError{}
+		}
+		c.writesLeft--
+	}
 	return nil
 }
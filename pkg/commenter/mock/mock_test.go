@@ -0,0 +1,150 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/dryrun"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+func finding(path string, line int, text, fp string) commenter.Finding {
+	return commenter.Finding{
+		Path: path, StartLine: line, EndLine: line,
+		Body:        commenter.EmbedFingerprint(text+"\n"+testMarker, fp),
+		Fingerprint: fp,
+	}
+}
+
+func TestMock_RecordsCallsAndComments(t *testing.T) {
+	m := NewMock()
+	if err := m.WriteMultiLineComment("a.go", "first", 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteLineComment("b.go", "second", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	m.AssertCalled(t, MethodWriteMultiLineComment, 1)
+	m.AssertCalled(t, MethodWriteLineComment, 1)
+	m.AssertCommentCount(t, 2)
+	m.AssertCommented(t, "a.go", 4, "first")
+	m.AssertCommented(t, "b.go", 7, "second")
+	m.AssertNotCommented(t, "a.go", 6)
+
+	calls := m.Calls()
+	if calls[0].Path != "a.go" || calls[0].StartLine != 3 || calls[0].EndLine != 5 || calls[0].Body != "first" {
+		t.Errorf("unexpected call %+v", calls[0])
+	}
+}
+
+func TestMock_RejectComment_SkipsFinding(t *testing.T) {
+	m := NewMock()
+	m.RejectComment("a.go", 40)
+
+	var notInDiff commenter.NotInDiffError
+	if err := m.WriteLineComment("a.go", "body", 40); !errors.As(err, &notInDiff) {
+		t.Fatalf("expected NotInDiffError, got %v", err)
+	}
+	results, err := m.WriteFindings(context.Background(), []commenter.Finding{
+		finding("a.go", 40, "outside the diff", "aa"),
+		finding("a.go", 41, "inside the diff", "bb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != commenter.StatusSkipped || results[0].Reason == "" {
+		t.Errorf("expected the rejected line to be skipped, got %+v", results[0])
+	}
+	if results[1].Status != commenter.StatusCreated || results[1].CommentID == "" {
+		t.Errorf("expected the other line to be commented, got %+v", results[1])
+	}
+	m.AssertNotCommented(t, "a.go", 40)
+	m.AssertCommented(t, "a.go", 41, "inside the diff")
+}
+
+func TestMock_RateLimitAfter(t *testing.T) {
+	m := NewMock()
+	m.RateLimitAfter(2)
+
+	results, _ := m.WriteFindings(context.Background(), []commenter.Finding{
+		finding("a.go", 1, "one", "aa"),
+		finding("a.go", 2, "two", "bb"),
+		finding("a.go", 3, "three", "cc"),
+	})
+	if results[1].Status != commenter.StatusCreated {
+		t.Errorf("expected the second write through, got %+v", results[1])
+	}
+	if results[2].Status != commenter.StatusFailed || !errors.Is(results[2].Err, commenter.ErrRateLimited) {
+		t.Errorf("expected the third write rate limited, got %+v", results[2])
+	}
+	m.AssertCommentCount(t, 2)
+}
+
+func TestMock_ReconcileAcrossRuns(t *testing.T) {
+	m := NewMock()
+	ctx := context.Background()
+
+	if _, err := m.ReconcileFindings(ctx, testMarker, []commenter.Finding{
+		finding("a.go", 10, "kept", "aa"),
+		finding("a.go", 20, "fixed later", "bb"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteLineComment("a.go", "developer comment", 30); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := m.ReconcileFindings(ctx, testMarker, []commenter.Finding{
+		finding("a.go", 12, "kept and reworded", "aa"),
+		finding("b.go", 1, "new", "cc"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != commenter.StatusEdited || results[1].Status != commenter.StatusCreated {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	m.AssertCommented(t, "a.go", 10, "kept and reworded")
+	m.AssertNotCommented(t, "a.go", 20)
+	m.AssertCommented(t, "b.go", 1, "new")
+	m.AssertCommented(t, "a.go", 30, "developer comment")
+	m.AssertCalled(t, MethodReconcileFindings, 2)
+}
+
+func TestMock_DryRunLeavesCommentsUntouched(t *testing.T) {
+	m := NewMock()
+	ctx := context.Background()
+	if _, err := m.WriteFindings(ctx, []commenter.Finding{finding("a.go", 1, "existing", "aa")}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := dryrun.NewPlan()
+	if _, err := m.ReconcileFindings(dryrun.WithPlan(ctx, plan), testMarker, []commenter.Finding{finding("b.go", 1, "new", "bb")}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertCommentCount(t, 1)
+	m.AssertCommented(t, "a.go", 1, "existing")
+	if entries := plan.Entries(); len(entries) != 2 {
+		t.Errorf("expected a create and a delete in the plan, got %+v", entries)
+	}
+}
+
+func TestMock_ConcurrentWrites(t *testing.T) {
+	m := NewMock()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(line int) {
+			defer wg.Done()
+			_ = m.WriteLineComment("a.go", "body", line)
+		}(i + 1)
+	}
+	wg.Wait()
+	m.AssertCalled(t, MethodWriteLineComment, 20)
+	m.AssertCommentCount(t, 20)
+}
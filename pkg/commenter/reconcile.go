@@ -0,0 +1,65 @@
+package commenter
+
+// ExistingComment is the provider-neutral view of an Aqua comment already on
+// the PR, used to pair it with the current findings.
+type ExistingComment struct {
+	Path      string
+	StartLine int
+	// EndLine is 0 for providers that anchor comments to a single line
+	EndLine     int
+	Fingerprint string
+}
+
+// MatchFindings pairs every finding with an existing comment, first by
+// fingerprint and then, for legacy comments without one, by path and line.
+// matches[i] is the index in existing matched by findings[i], or -1. stale
+// lists the indexes of existing comments no finding claimed, including
+// duplicates of an already matched fingerprint.
+func MatchFindings(findings []Finding, existing []ExistingComment) (matches []int, stale []int) {
+	byFP := make(map[string]int)
+	var legacy []int
+	for i, e := range existing {
+		if e.Fingerprint == "" {
+			legacy = append(legacy, i)
+			continue
+		}
+		// First-seen wins; later duplicates are left over as stale.
+		if _, ok := byFP[e.Fingerprint]; !ok {
+			byFP[e.Fingerprint] = i
+		}
+	}
+
+	used := make(map[int]bool)
+	matches = make([]int, len(findings))
+	for i, f := range findings {
+		matches[i] = -1
+		if f.Fingerprint != "" {
+			if idx, ok := byFP[f.Fingerprint]; ok && !used[idx] {
+				used[idx] = true
+				matches[i] = idx
+				continue
+			}
+		}
+		for _, idx := range legacy {
+			if !used[idx] && existing[idx].matchesLocation(f) {
+				used[idx] = true
+				matches[i] = idx
+				break
+			}
+		}
+	}
+
+	for i := range existing {
+		if !used[i] {
+			stale = append(stale, i)
+		}
+	}
+	return matches, stale
+}
+
+func (e ExistingComment) matchesLocation(f Finding) bool {
+	if e.Path != f.Path || e.StartLine != f.StartLine {
+		return false
+	}
+	return e.EndLine == 0 || e.EndLine == f.EndLine
+}
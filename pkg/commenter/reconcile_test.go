@@ -0,0 +1,72 @@
+package commenter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchFindings(t *testing.T) {
+	tests := []struct {
+		name        string
+		findings    []Finding
+		existing    []ExistingComment
+		wantMatches []int
+		wantStale   []int
+	}{
+		{
+			name:        "fingerprint wins over location",
+			findings:    []Finding{{Path: "a.go", StartLine: 30, EndLine: 30, Fingerprint: "deadbeef"}},
+			existing:    []ExistingComment{{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "deadbeef"}},
+			wantMatches: []int{0},
+		},
+		{
+			name:        "legacy comment matched by path and lines",
+			findings:    []Finding{{Path: "a.go", StartLine: 10, EndLine: 12, Fingerprint: "deadbeef"}},
+			existing:    []ExistingComment{{Path: "a.go", StartLine: 10, EndLine: 12}},
+			wantMatches: []int{0},
+		},
+		{
+			name:        "single line providers ignore the end line",
+			findings:    []Finding{{Path: "a.go", StartLine: 10, EndLine: 12}},
+			existing:    []ExistingComment{{Path: "a.go", StartLine: 10}},
+			wantMatches: []int{0},
+		},
+		{
+			name:        "fingerprinted comment is not matched by location",
+			findings:    []Finding{{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "deadbeef"}},
+			existing:    []ExistingComment{{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "cafebabe"}},
+			wantMatches: []int{-1},
+			wantStale:   []int{0},
+		},
+		{
+			name:     "duplicate fingerprints are stale",
+			findings: []Finding{{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "deadbeef"}},
+			existing: []ExistingComment{
+				{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "deadbeef"},
+				{Path: "a.go", StartLine: 10, EndLine: 10, Fingerprint: "deadbeef"},
+			},
+			wantMatches: []int{0},
+			wantStale:   []int{1},
+		},
+		{
+			name: "legacy comment claimed once",
+			findings: []Finding{
+				{Path: "a.go", StartLine: 10, EndLine: 10},
+				{Path: "a.go", StartLine: 10, EndLine: 10},
+			},
+			existing:    []ExistingComment{{Path: "a.go", StartLine: 10, EndLine: 10}},
+			wantMatches: []int{0, -1},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, stale := MatchFindings(tc.findings, tc.existing)
+			if !reflect.DeepEqual(matches, tc.wantMatches) {
+				t.Fatalf("matches: got %v, want %v", matches, tc.wantMatches)
+			}
+			if !reflect.DeepEqual(stale, tc.wantStale) {
+				t.Fatalf("stale: got %v, want %v", stale, tc.wantStale)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package commenter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// SuggestionFormat is how a provider renders Finding.Suggestion.
+type SuggestionFormat int
+
+const (
+	// SuggestionDiff renders a diff code block, for providers that can't
+	// apply suggestions and for suggestions whose lines they can't anchor
+	SuggestionDiff SuggestionFormat = iota
+	// SuggestionBlock renders a suggestion block replacing every line the
+	// comment is written on, as GitHub and Bitbucket Data Center apply them
+	SuggestionBlock
+	// SuggestionOffsets renders a suggestion block on the start line whose
+	// offsets extend it to the end line, as GitLab applies them
+	SuggestionOffsets
+)
+
+// RenderSuggestion returns the body of f with its suggestion rendered in
+// format, body itself when f has none. The block goes before the hidden
+// metadata, whose body hash is computed again so that reconciliation edits the
+// comment when only the suggestion changed.
+func RenderSuggestion(f Finding, format SuggestionFormat) string {
+	if f.Suggestion == "" {
+		return f.Body
+	}
+	visible := strings.TrimRight(fingerprint.Strip(f.Body), "\n")
+	if visible != "" {
+		visible += "\n\n"
+	}
+	visible += suggestionBlock(f, format)
+
+	meta, ok := fingerprint.Parse(f.Body)
+	switch {
+	case !ok:
+		return visible
+	case strings.Contains(f.Body, fingerprintPrefix):
+		return EmbedFingerprint(visible, meta.Fingerprint)
+	}
+	meta.BodyHash = ""
+	return fingerprint.Embed(visible, meta, fingerprint.StyleOf(f.Body))
+}
+
+func suggestionBlock(f Finding, format SuggestionFormat) string {
+	text := strings.TrimSuffix(f.Suggestion, "\n")
+	// the fence must be longer than any run of backticks of the suggestion
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	startLine, endLine := NormalizeLines(f.StartLine, f.EndLine)
+	switch format {
+	case SuggestionBlock:
+		return fence + "suggestion\n" + text + "\n" + fence
+	case SuggestionOffsets:
+		return fmt.Sprintf("%ssuggestion:-0+%d\n%s\n%s", fence, endLine-startLine, text, fence)
+	}
+	var sb strings.Builder
+	switch {
+	case startLine == FIRST_AVAILABLE_LINE:
+		sb.WriteString("Suggested change:\n")
+	case startLine == endLine:
+		fmt.Fprintf(&sb, "Suggested change for line %d:\n", startLine)
+	default:
+		fmt.Fprintf(&sb, "Suggested change for lines %d-%d:\n", startLine, endLine)
+	}
+	sb.WriteString(fence + "diff\n")
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString("+" + line + "\n")
+	}
+	sb.WriteString(fence)
+	return sb.String()
+}
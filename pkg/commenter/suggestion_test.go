@@ -0,0 +1,60 @@
+package commenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func TestRenderSuggestion_Formats(t *testing.T) {
+	f := Finding{Path: "go.mod", StartLine: 3, EndLine: 5, Body: "outdated", Suggestion: "a\nb\n"}
+	tests := []struct {
+		format SuggestionFormat
+		want   string
+	}{
+		{SuggestionBlock, "outdated\n\n```suggestion\na\nb\n```"},
+		{SuggestionOffsets, "outdated\n\n```suggestion:-0+2\na\nb\n```"},
+		{SuggestionDiff, "outdated\n\nSuggested change for lines 3-5:\n```diff\n+a\n+b\n```"},
+	}
+	for _, tc := range tests {
+		if got := RenderSuggestion(f, tc.format); got != tc.want {
+			t.Errorf("format %d: expected\n%s\ngot\n%s", tc.format, tc.want, got)
+		}
+	}
+
+	f.Suggestion = ""
+	if got := RenderSuggestion(f, SuggestionBlock); got != f.Body {
+		t.Fatalf("expected the body without a suggestion, got %q", got)
+	}
+}
+
+func TestRenderSuggestion_LongerFence(t *testing.T) {
+	f := Finding{StartLine: 1, EndLine: 1, Body: "doc", Suggestion: "```go\nx\n```"}
+	got := RenderSuggestion(f, SuggestionBlock)
+	if !strings.HasPrefix(got, "doc\n\n````suggestion\n") || !strings.HasSuffix(got, "\n````") {
+		t.Fatalf("expected a fence longer than the one of the suggestion, got\n%s", got)
+	}
+}
+
+func TestRenderSuggestion_KeepsMetadata(t *testing.T) {
+	meta := fingerprint.Metadata{Fingerprint: "deadbeef", RuleID: "R1"}
+	f := Finding{StartLine: 2, EndLine: 2, Body: fingerprint.Embed("text\n\n[marker]", meta, fingerprint.LinkReference), Suggestion: "fixed"}
+
+	first := RenderSuggestion(f, SuggestionBlock)
+	if got, _ := fingerprint.Parse(first); got.Fingerprint != "deadbeef" || got.RuleID != "R1" {
+		t.Fatalf("expected the metadata to be kept, got %+v", got)
+	}
+	if fingerprint.StyleOf(first) != fingerprint.LinkReference || !strings.Contains(fingerprint.Strip(first), "[marker]\n\n```suggestion") {
+		t.Fatalf("expected the suggestion before the hidden metadata, got\n%s", first)
+	}
+	f.Suggestion = "fixed differently"
+	if Unchanged(first, RenderSuggestion(f, SuggestionBlock)) {
+		t.Fatalf("expected a changed suggestion to change the comment")
+	}
+
+	legacy := Finding{StartLine: 2, EndLine: 2, Body: EmbedFingerprint("text", "cafebabe"), Suggestion: "fixed"}
+	if got := ExtractFingerprint(RenderSuggestion(legacy, SuggestionBlock)); got != "cafebabe" {
+		t.Fatalf("expected the sentinel to be kept, got %q", got)
+	}
+}
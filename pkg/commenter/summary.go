@@ -0,0 +1,92 @@
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// UnknownSeverity is reported for findings without a severity in their metadata.
+const UnknownSeverity = "UNKNOWN"
+
+var severityOrder = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}
+
+// SummaryWriter is implemented by providers that can keep a single PR-level
+// overview comment up to date next to the inline comments.
+type SummaryWriter interface {
+	// UpsertSummary edits the PR-level comment carrying the hidden marker for
+	// id in place, or creates it when there is none. The body must not carry
+	// the inline comment marker, or removing inline comments would delete it.
+	UpsertSummary(ctx context.Context, id, body string) Result
+}
+
+// SummaryBody appends the hidden marker for id to body, hidden the way the
+// provider renders invisibly.
+func SummaryBody(body, id, provider string) string {
+	return strings.TrimRight(body, "\n") + "\n\n" + SummaryMarker(id, provider)
+}
+
+// SummaryMarker returns the hidden marker that identifies the summary id on the provider.
+func SummaryMarker(id, provider string) string {
+	return fingerprint.SummaryMarker(id, fingerprint.StyleFor(provider))
+}
+
+// SeverityTotals counts findings by the severity in their metadata block.
+func SeverityTotals(findings []Finding) map[string]int {
+	totals := make(map[string]int)
+	for _, f := range findings {
+		meta, _ := fingerprint.Parse(f.Body)
+		severity := strings.ToUpper(meta.Severity)
+		if severity == "" {
+			severity = UnknownSeverity
+		}
+		totals[severity]++
+	}
+	return totals
+}
+
+// RenderSummary renders a Markdown overview of findings with their totals by severity.
+func RenderSummary(title string, findings []Finding) string {
+	totals := SeverityTotals(findings)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### %s\n\n", title)
+	if len(findings) == 0 {
+		sb.WriteString("No findings.\n")
+		return sb.String()
+	}
+	sb.WriteString("| Severity | Findings |\n|---|---|\n")
+	for _, severity := range severities(totals) {
+		fmt.Fprintf(&sb, "| %s | %d |\n", severity, totals[severity])
+	}
+	fmt.Fprintf(&sb, "| **Total** | **%d** |\n", len(findings))
+	return sb.String()
+}
+
+// severities orders the known severities from most to least severe, followed
+// by any others alphabetically and then the unknown ones.
+func severities(totals map[string]int) []string {
+	var ordered []string
+	known := map[string]bool{UnknownSeverity: true}
+	for _, severity := range severityOrder {
+		known[severity] = true
+		if totals[severity] > 0 {
+			ordered = append(ordered, severity)
+		}
+	}
+	var others []string
+	for severity := range totals {
+		if !known[severity] {
+			others = append(others, severity)
+		}
+	}
+	sort.Strings(others)
+	ordered = append(ordered, others...)
+	if totals[UnknownSeverity] > 0 {
+		ordered = append(ordered, UnknownSeverity)
+	}
+	return ordered
+}
@@ -0,0 +1,51 @@
+package commenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+func findingWithSeverity(severity string) Finding {
+	return Finding{Body: fingerprint.Embed("body", fingerprint.Metadata{Fingerprint: "fp", Severity: severity}, fingerprint.HTMLComment)}
+}
+
+func TestSeverityTotals(t *testing.T) {
+	totals := SeverityTotals([]Finding{
+		findingWithSeverity("HIGH"),
+		findingWithSeverity("high"),
+		findingWithSeverity("LOW"),
+		{Body: "no metadata"},
+	})
+	if totals["HIGH"] != 2 || totals["LOW"] != 1 || totals[UnknownSeverity] != 1 {
+		t.Fatalf("unexpected totals: %v", totals)
+	}
+}
+
+func TestRenderSummary_OrdersBySeverity(t *testing.T) {
+	summary := RenderSummary("Aqua scan", []Finding{
+		{Body: "no metadata"},
+		findingWithSeverity("LOW"),
+		findingWithSeverity("NEGLIGIBLE"),
+		findingWithSeverity("CRITICAL"),
+	})
+	last := -1
+	for _, row := range []string{"| CRITICAL |", "| LOW |", "| NEGLIGIBLE |", "| UNKNOWN |", "| **Total** | **4** |"} {
+		idx := strings.Index(summary, row)
+		if idx <= last {
+			t.Fatalf("%q is missing or out of order:\n%s", row, summary)
+		}
+		last = idx
+	}
+}
+
+func TestSummaryBody_HiddenPerProvider(t *testing.T) {
+	body := SummaryBody("overview\n", "scan", fingerprint.BitbucketServer)
+	if !strings.HasPrefix(body, "overview\n\n[//]: # (aqua-summary: scan)") {
+		t.Fatalf("unexpected body: %q", body)
+	}
+	if !strings.Contains(SummaryBody("overview", "scan", fingerprint.GitHub), "<!-- aqua-summary: scan -->") {
+		t.Fatal("expected an HTML comment marker for github")
+	}
+}
@@ -0,0 +1,361 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 4
+	DefaultBaseDelay  = time.Second
+	DefaultMaxDelay   = 30 * time.Second
+	DefaultMaxWait    = 2 * time.Minute
+	DefaultTimeout    = time.Minute
+
+	// maxErrorBody bounds how much of a failed response is kept in its StatusError
+	maxErrorBody = 64 << 10
+)
+
+// Default is the client of every provider not given its own.
+var Default = New()
+
+// Clock tells the time and waits between retries, tests replace it so that
+// they don't sleep.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, or returns the error of ctx once it is done
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Client sends the requests of the providers. Its connections are reused
+// across requests and providers, every attempt is bounded by Timeout and
+// failed attempts are retried:
+//   - 429, and 403 once the rate limit is exhausted, whatever the method, as
+//     the request was not processed
+//   - 5xx and network errors of idempotent requests only
+//
+// The wait before a retry is taken from the Retry-After or X-RateLimit-Reset
+// header of the response, and is a jittered exponential backoff otherwise. A
+// response asking to wait more than MaxWait is returned as is.
+type Client struct {
+	// Transport sends a single attempt, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// Clock is the real clock when nil
+	Clock Clock
+
+	Timeout    time.Duration
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	MaxWait    time.Duration
+
+	// MapError, when set, maps the errors returned by Do, Get and Delete
+	MapError func(error) error
+}
+
+// New returns a client with the default timeout and retries.
+func New() *Client {
+	return &Client{
+		Timeout:    DefaultTimeout,
+		MaxRetries: DefaultMaxRetries,
+		BaseDelay:  DefaultBaseDelay,
+		MaxDelay:   DefaultMaxDelay,
+		MaxWait:    DefaultMaxWait,
+	}
+}
+
+// StatusError is returned by Do for a non-2xx response.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Body is the start of the response body
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if body := strings.TrimSpace(e.Body); body != "" {
+		msg += ": " + body
+	}
+	return msg
+}
+
+// CheckResponse returns a *StatusError for a non-2xx response, after reading
+// and closing its body.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &StatusError{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(b)}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = redact(resp.Request.URL.String())
+	}
+	return e
+}
+
+// redact drops the query of the url, which may carry credentials.
+func redact(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
+
+// HTTPClient returns an http.Client sending its requests with c, for the
+// libraries which take one.
+func (c *Client) HTTPClient() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Do sends the request and returns a *StatusError for a non-2xx response.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient().Do(req)
+	if err == nil {
+		err = CheckResponse(resp)
+	}
+	if err != nil {
+		if c.MapError != nil {
+			err = c.MapError(err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Get sends a GET request accepting JSON with the headers.
+func (c *Client) Get(ctx context.Context, url string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Add(key, value)
+	}
+	return c.Do(req)
+}
+
+// Delete sends a DELETE request with the headers.
+func (c *Client) Delete(ctx context.Context, url string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Add(key, value)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// RoundTrip sends the request, retrying it as described on Client.
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(req, attempt)
+		wait, retry := c.retryWait(req, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			drain(resp)
+		}
+		if err := c.clock().Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+	r := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	resp, err := c.transport().RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the attempt lasts until the body is read
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryWait tells whether the attempt is retried, and how long to wait before.
+func (c *Client) retryWait(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.MaxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+	if err != nil {
+		return c.backoff(attempt), idempotent(req.Method)
+	}
+
+	limited := RateLimited(resp.StatusCode, resp.Header)
+	if !limited && (resp.StatusCode < http.StatusInternalServerError || !idempotent(req.Method)) {
+		return 0, false
+	}
+	wait, ok := retryAfter(resp.Header, c.clock().Now(), limited)
+	if !ok {
+		wait = c.backoff(attempt)
+	}
+	return wait, wait <= c.MaxWait
+}
+
+// backoff is the exponential delay of the attempt, with full jitter on its
+// upper half.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.BaseDelay
+	for i := 0; i < attempt && d < c.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > c.MaxDelay {
+		d = c.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + jitter(d/2)
+}
+
+func (c *Client) clock() Clock {
+	if c.Clock == nil {
+		return realClock{}
+	}
+	return c.Clock
+}
+
+func (c *Client) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.Transport
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// RateLimited tells whether a response refused the request over a rate limit,
+// a 429 or a 403 of an exhausted rate limit, as GitHub answers, rather than of
+// a missing permission.
+func RateLimited(statusCode int, header http.Header) bool {
+	return statusCode == http.StatusTooManyRequests || (statusCode == http.StatusForbidden &&
+		(header.Get("Retry-After") != "" || header.Get("X-RateLimit-Remaining") == "0"))
+}
+
+// RetryAfter returns the wait a rate limited response asked for, 0 when it
+// didn't ask for any.
+func RetryAfter(header http.Header, now time.Time) time.Duration {
+	wait, _ := retryAfter(header, now, true)
+	return wait
+}
+
+// retryAfter reads the wait asked for by the response, in seconds or as a
+// date in Retry-After. Once rate limited it is also the epoch second the limit
+// resets at in X-RateLimit-Reset or RateLimit-Reset, which GitHub and GitLab
+// send with every response.
+func retryAfter(header http.Header, now time.Time, limited bool) (time.Duration, bool) {
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return nonNegative(time.Duration(seconds) * time.Second), true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return nonNegative(at.Sub(now)), true
+		}
+	}
+	if !limited {
+		return 0, false
+	}
+	for _, key := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if epoch, err := strconv.ParseInt(header.Get(key), 10, 64); err == nil {
+			return nonNegative(time.Unix(epoch, 0).Sub(now)), true
+		}
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+var random = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func jitter(d time.Duration) time.Duration {
+	random.Lock()
+	defer random.Unlock()
+	return time.Duration(random.Int63n(int64(d) + 1))
+}
+
+// drain reads the rest of the body so that its connection is reused.
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	_ = resp.Body.Close()
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
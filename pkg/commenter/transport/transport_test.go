@@ -0,0 +1,241 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+// newTestClient returns a client with a fake clock to a server answering
+// every attempt with handle, along with the number of attempts it got.
+func newTestClient(t *testing.T, handle func(w http.ResponseWriter, attempt int)) (*Client, *fakeClock, *httptest.Server, *int) {
+	var mu sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempt := attempts
+		attempts++
+		mu.Unlock()
+		_, _ = io.ReadAll(r.Body)
+		handle(w, attempt)
+	}))
+	t.Cleanup(srv.Close)
+
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	c := New()
+	c.Clock = clock
+	return c, clock, srv, &attempts
+}
+
+// statuses fails the first attempts with the codes, and then answers 200.
+func statuses(codes ...int) func(w http.ResponseWriter, attempt int) {
+	return func(w http.ResponseWriter, attempt int) {
+		if attempt < len(codes) {
+			w.WriteHeader(codes[attempt])
+			_, _ = w.Write([]byte(`{"message":"failed"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}
+}
+
+func TestDo_RetriesIdempotentServerErrors(t *testing.T) {
+	c, clock, srv, attempts := newTestClient(t, statuses(502, 503))
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(`{"body":"x"}`))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_ = resp.Body.Close()
+	if *attempts != 3 || len(clock.sleeps) != 2 {
+		t.Fatalf("expected 3 attempts and 2 sleeps, got %d and %v", *attempts, clock.sleeps)
+	}
+	for i, d := range clock.sleeps {
+		max := DefaultBaseDelay << i
+		if d < max/2 || d > max {
+			t.Fatalf("sleep %d of %s is out of [%s, %s]", i, d, max/2, max)
+		}
+	}
+}
+
+func TestDo_DoesNotRetryPostOnServerError(t *testing.T) {
+	c, _, srv, attempts := newTestClient(t, statuses(500))
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+	_, err := c.Do(req)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 || statusErr.Method != http.MethodPost {
+		t.Fatalf("expected a 500 StatusError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected the body in the error, got %v", err)
+	}
+	if *attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", *attempts)
+	}
+}
+
+func TestDo_HonorsRetryAfter(t *testing.T) {
+	c, clock, srv, attempts := newTestClient(t, func(w http.ResponseWriter, attempt int) {
+		if attempt == 0 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_ = resp.Body.Close()
+	if *attempts != 2 || len(clock.sleeps) != 1 || clock.sleeps[0] != 7*time.Second {
+		t.Fatalf("expected a retry after 7s, got %d attempts and %v", *attempts, clock.sleeps)
+	}
+}
+
+func TestDo_HonorsRateLimitReset(t *testing.T) {
+	var reset int64
+	c, clock, srv, _ := newTestClient(t, func(w http.ResponseWriter, attempt int) {
+		if attempt == 0 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	reset = clock.now.Add(42 * time.Second).Unix()
+
+	resp, err := c.Get(context.Background(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_ = resp.Body.Close()
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 42*time.Second {
+		t.Fatalf("expected to wait for the reset, got %v", clock.sleeps)
+	}
+}
+
+func TestDo_DoesNotRetryForbidden(t *testing.T) {
+	c, _, srv, attempts := newTestClient(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	if _, err := c.Get(context.Background(), srv.URL, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", *attempts)
+	}
+}
+
+func TestDo_GivesUpAfterMaxRetries(t *testing.T) {
+	c, clock, srv, attempts := newTestClient(t, func(w http.ResponseWriter, attempt int) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	err := c.Delete(context.Background(), srv.URL, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 StatusError, got %v", err)
+	}
+	if *attempts != DefaultMaxRetries+1 || len(clock.sleeps) != DefaultMaxRetries {
+		t.Fatalf("expected %d attempts, got %d and sleeps %v", DefaultMaxRetries+1, *attempts, clock.sleeps)
+	}
+}
+
+func TestDo_DoesNotWaitPastMaxWait(t *testing.T) {
+	c, clock, srv, attempts := newTestClient(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	if _, err := c.Get(context.Background(), srv.URL, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *attempts != 1 || len(clock.sleeps) != 0 {
+		t.Fatalf("expected no retry, got %d attempts and sleeps %v", *attempts, clock.sleeps)
+	}
+}
+
+func TestDo_StopsOnCanceledContext(t *testing.T) {
+	c, _, srv, attempts := newTestClient(t, statuses(503, 503))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Clock = cancelingClock{cancel: cancel}
+	if _, err := c.Get(ctx, srv.URL, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if *attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", *attempts)
+	}
+}
+
+type cancelingClock struct {
+	cancel context.CancelFunc
+}
+
+func (cancelingClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c cancelingClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.cancel()
+	return ctx.Err()
+}
+
+func TestDelete_ReturnsStatusError(t *testing.T) {
+	c, _, srv, _ := newTestClient(t, statuses(404))
+
+	err := c.Delete(context.Background(), srv.URL+"/comments/1?token=secret", nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a 404 StatusError, got %v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected the query to be redacted, got %v", err)
+	}
+}
+
+func TestDo_MapsErrors(t *testing.T) {
+	c, _, srv, _ := newTestClient(t, statuses(404))
+	errMapped := errors.New("mapped")
+	c.MapError = func(err error) error {
+		return fmt.Errorf("%v: %w", err, errMapped)
+	}
+
+	if _, err := c.Get(context.Background(), srv.URL, nil); !errors.Is(err, errMapped) {
+		t.Fatalf("expected the error to be mapped, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,6 +9,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/transport"
 )
 
 func UrlWithParams(baseUrl string, params map[string]string) (string, error) {
@@ -24,34 +27,23 @@ func UrlWithParams(baseUrl string, params map[string]string) (string, error) {
 }
 
 func DeleteComments(url string, headers map[string]string) error {
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Add("Content-Type", "application/json")
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-	_, err = client.Do(req)
-	if err != nil {
-		return err
-	}
-	return nil
+	return DeleteCommentsWithContext(context.Background(), url, headers)
+}
+
+// DeleteCommentsWithContext deletes with transport.Default, a non-2xx response
+// is returned as a *transport.StatusError
+func DeleteCommentsWithContext(ctx context.Context, url string, headers map[string]string) error {
+	return transport.Default.Delete(ctx, url, headers)
 }
 
 func GetComments(url string, headers map[string]string) (*http.Response, error) {
-	client := &http.Client{}
+	return GetCommentsWithContext(context.Background(), url, headers)
+}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", "application/json")
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-	return client.Do(req)
+// GetCommentsWithContext gets with transport.Default, a non-2xx response is
+// returned as a *transport.StatusError
+func GetCommentsWithContext(ctx context.Context, url string, headers map[string]string) (*http.Response, error) {
+	return transport.Default.Get(ctx, url, headers)
 }
 
 func GetRepositoryCloneURL() (string, error) {
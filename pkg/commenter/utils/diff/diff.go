@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+// Hunk is a range of lines of the new version of a file covered by a hunk of
+// its diff, the lines a comment can be anchored to.
+type Hunk struct {
+	Start int
+	End   int
+}
+
+func (h Hunk) Contains(line int) bool {
+	return line >= h.Start && line <= h.End
+}
+
+type file struct {
+	hunks []Hunk
+	// anyLine is set when the provider lists the file as changed without its
+	// hunks, every line of it is then accepted
+	anyLine bool
+}
+
+// Diff holds the files changed by a pull request, deleted files excluded, and
+// the lines of their new version that comments can be anchored to.
+type Diff struct {
+	files map[string]*file
+}
+
+func New() *Diff {
+	return &Diff{files: make(map[string]*file)}
+}
+
+var hunkRegex = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseHunks returns the hunks of patch, the diff of a single file.
+func ParseHunks(patch string) []Hunk {
+	var hunks []Hunk
+	for _, m := range hunkRegex.FindAllStringSubmatch(patch, -1) {
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		// a hunk only removing lines has nothing to comment on
+		if count > 0 {
+			hunks = append(hunks, Hunk{Start: start, End: start + count - 1})
+		}
+	}
+	return hunks
+}
+
+// ParseUnified parses the output of git diff, which holds the diff of every
+// file of the pull request.
+func ParseUnified(text string) *Diff {
+	d := New()
+	var path string
+	var patch strings.Builder
+	flush := func() {
+		if path != "" {
+			d.AddPatch(path, patch.String())
+		}
+		path = ""
+		patch.Reset()
+	}
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			flush()
+		case strings.HasPrefix(line, "+++ "):
+			// deleted files are diffed against /dev/null and left out
+			if name := strings.TrimPrefix(line, "+++ "); name != "/dev/null" {
+				path = strings.TrimPrefix(name, "b/")
+			}
+		case path != "":
+			patch.WriteString(line)
+			patch.WriteString("\n")
+		}
+	}
+	flush()
+	return d
+}
+
+// AddPatch adds the file with the hunks of its patch. A file without hunks,
+// like a binary or a renamed file, has no line to comment on.
+func (d *Diff) AddPatch(path, patch string) {
+	d.AddHunks(path, ParseHunks(patch))
+}
+
+// AddHunks adds the file with its hunks, for the providers that tell the
+// changed lines without a patch.
+func (d *Diff) AddHunks(path string, hunks []Hunk) {
+	d.files[path] = &file{hunks: hunks}
+}
+
+// AddFile adds a file whose hunks are unknown, any of its lines is accepted.
+func (d *Diff) AddFile(path string) {
+	d.files[path] = &file{anyLine: true}
+}
+
+// Has reports whether the pull request changes the file, deleted files aside.
+func (d *Diff) Has(path string) bool {
+	_, ok := d.files[strings.TrimPrefix(path, "/")]
+	return ok
+}
+
+// Resolve validates the lines of a comment, normalized by
+// commenter.NormalizeLines, against the diff. FIRST_AVAILABLE_LINE resolves to
+// the first line of the first hunk, or line 1 when the hunks are unknown. A
+// commenter.NotInDiffError, with the nearest line in the diff, is returned
+// when the file isn't changed or the lines aren't covered by a single hunk.
+func (d *Diff) Resolve(path string, startLine, endLine int) (int, int, error) {
+	f, ok := d.files[strings.TrimPrefix(path, "/")]
+	if !ok {
+		return 0, 0, commenter.NotInDiffError{Path: path, Line: startLine}
+	}
+	if startLine == commenter.FIRST_AVAILABLE_LINE {
+		switch {
+		case f.anyLine:
+			return 1, 1, nil
+		case len(f.hunks) == 0:
+			return 0, 0, commenter.NotInDiffError{Path: path, Line: startLine}
+		}
+		return f.hunks[0].Start, f.hunks[0].Start, nil
+	}
+	if f.anyLine {
+		return startLine, endLine, nil
+	}
+	// a range can't span the lines left out between two hunks
+	for _, h := range f.hunks {
+		if h.Contains(startLine) {
+			if !h.Contains(endLine) {
+				return 0, 0, commenter.NotInDiffError{Path: path, Line: endLine, Nearest: f.nearest(endLine)}
+			}
+			return startLine, endLine, nil
+		}
+	}
+	return 0, 0, commenter.NotInDiffError{Path: path, Line: startLine, Nearest: f.nearest(startLine)}
+}
+
+func (f *file) nearest(line int) int {
+	return Nearest(f.hunks, line)
+}
+
+// Nearest returns the line covered by the hunks closest to line, the earliest
+// one on a tie, or 0 when there is none.
+func Nearest(hunks []Hunk, line int) int {
+	nearest, distance := 0, 0
+	for _, h := range hunks {
+		candidate := h.Start
+		if line > h.End {
+			candidate = h.End
+		}
+		d := candidate - line
+		if d < 0 {
+			d = -d
+		}
+		if nearest == 0 || d < distance {
+			nearest, distance = candidate, d
+		}
+	}
+	return nearest
+}
@@ -0,0 +1,71 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+)
+
+const unified = `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3,4 +3,6 @@ func main() {
+ a
++b
++c
+ d
+@@ -20,0 +23,2 @@
++e
++f
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-a
+-b
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+`
+
+func TestResolve(t *testing.T) {
+	d := ParseUnified(unified)
+	d.AddFile("large.lock")
+
+	cases := []struct {
+		path               string
+		start, end         int
+		wantStart, wantEnd int
+		notInDiff          bool
+		nearest            int
+	}{
+		{path: "a.go", start: 4, end: 8, wantStart: 4, wantEnd: 8},
+		{path: "a.go", start: 24, end: 24, wantStart: 24, wantEnd: 24},
+		{path: "/a.go", start: 3, end: 3, wantStart: 3, wantEnd: 3},
+		{path: "a.go", start: commenter.FIRST_AVAILABLE_LINE, end: commenter.FIRST_AVAILABLE_LINE, wantStart: 3, wantEnd: 3},
+		{path: "a.go", start: 8, end: 23, notInDiff: true, nearest: 23},
+		{path: "a.go", start: 2, end: 2, notInDiff: true, nearest: 3},
+		{path: "a.go", start: 14, end: 14, notInDiff: true, nearest: 8},
+		{path: "a.go", start: 40, end: 40, notInDiff: true, nearest: 24},
+		{path: "old.go", start: 1, end: 1, notInDiff: true},
+		{path: "logo.png", start: commenter.FIRST_AVAILABLE_LINE, end: commenter.FIRST_AVAILABLE_LINE, notInDiff: true},
+		{path: "b.go", start: 1, end: 1, notInDiff: true},
+		{path: "large.lock", start: 300, end: 310, wantStart: 300, wantEnd: 310},
+		{path: "large.lock", start: commenter.FIRST_AVAILABLE_LINE, end: commenter.FIRST_AVAILABLE_LINE, wantStart: 1, wantEnd: 1},
+	}
+	for _, tc := range cases {
+		start, end, err := d.Resolve(tc.path, tc.start, tc.end)
+		if tc.notInDiff {
+			var notInDiff commenter.NotInDiffError
+			if !errors.As(err, &notInDiff) || notInDiff.Nearest != tc.nearest {
+				t.Errorf("Resolve(%s, %d, %d) expected a not in diff error nearest to %d, got %+v", tc.path, tc.start, tc.end, tc.nearest, err)
+			}
+			continue
+		}
+		if err != nil || start != tc.wantStart || end != tc.wantEnd {
+			t.Errorf("Resolve(%s, %d, %d) = %d, %d, %v, expected %d, %d", tc.path, tc.start, tc.end, start, end, err, tc.wantStart, tc.wantEnd)
+		}
+	}
+}
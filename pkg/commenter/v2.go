@@ -0,0 +1,169 @@
+package commenter
+
+import "context"
+
+// Status describes what happened to a single finding.
+type Status string
+
+const (
+	// StatusCreated a new comment was posted for the finding
+	StatusCreated Status = "created"
+	// StatusEdited an existing comment was updated in place
+	StatusEdited Status = "edited"
+	// StatusUnchanged an existing comment already had the content, the edit was skipped
+	StatusUnchanged Status = "unchanged"
+	// StatusSkipped nothing was written, e.g. the finding is outside the PR diff
+	// or its thread was resolved; see Result.Reason
+	StatusSkipped Status = "skipped"
+	// StatusFailed the provider rejected the finding, see Result.Err
+	StatusFailed Status = "failed"
+	// StatusReconciled the finding went through a legacy Reconciler, which
+	// doesn't tell whether its comment was created, edited or left alone
+	StatusReconciled Status = "reconciled"
+)
+
+// Result is the outcome of posting or reconciling one finding.
+type Result struct {
+	Finding Finding
+	Status  Status
+	// CommentID is the provider identifier of the comment, empty when nothing was written
+	CommentID string
+	// URL links to the comment in the provider UI when the provider exposes one
+	URL string
+	// Reason explains a skip in human terms, e.g. the thread was resolved
+	Reason string
+	Err    error
+	// Fallback is the policy applied to a finding outside the diff, see
+	// NewFallbackRepository, empty for the others
+	Fallback OutOfDiff
+}
+
+// RepositoryV2 is the context-aware, Finding-based successor of Repository.
+// Per-finding failures are reported in the returned results; the error is only
+// set when the whole run had to stop, e.g. on context cancellation.
+type RepositoryV2 interface {
+	// WriteFindings writes one review comment per finding
+	WriteFindings(ctx context.Context, findings []Finding) ([]Result, error)
+	// ReconcileFindings brings the Aqua comments on the PR in line with
+	// findings. Providers report the outcome of every finding when they
+	// implement FindingReconciler, StatusReconciled otherwise
+	ReconcileFindings(ctx context.Context, marker string, findings []Finding) ([]Result, error)
+	// RemoveAquaComments removes every comment carrying the marker
+	RemoveAquaComments(ctx context.Context, marker string) error
+}
+
+// FindingWriter is implemented by providers that can write a single finding
+// and report the identity of the comment they created.
+type FindingWriter interface {
+	WriteFinding(ctx context.Context, f Finding) Result
+}
+
+// FindingReconciler is the context-aware, per-finding variant of Reconciler.
+type FindingReconciler interface {
+	ReconcileFindings(ctx context.Context, marker string, findings []Finding) ([]Result, error)
+}
+
+// CommentRemover is the context-aware variant of RemovePreviousAquaComments.
+type CommentRemover interface {
+	RemoveAquaComments(ctx context.Context, marker string) error
+}
+
+type repositoryV2 struct {
+	repo Repository
+}
+
+// NewRepositoryV2 adapts a Repository to RepositoryV2. The optional
+// FindingWriter, FindingReconciler and CommentRemover capabilities are used
+// when the provider has them, otherwise the legacy methods are called.
+func NewRepositoryV2(repo Repository) RepositoryV2 {
+	if v2, ok := repo.(RepositoryV2); ok {
+		return v2
+	}
+	return &repositoryV2{repo: repo}
+}
+
+func (r *repositoryV2) WriteFindings(ctx context.Context, findings []Finding) ([]Result, error) {
+	results := make([]Result, 0, len(findings))
+	for i, f := range findings {
+		if err := ctx.Err(); err != nil {
+			return append(results, FailFindings(findings[i:], err)...), err
+		}
+		results = append(results, r.writeFinding(ctx, f))
+	}
+	return results, nil
+}
+
+func (r *repositoryV2) writeFinding(ctx context.Context, f Finding) Result {
+	if w, ok := r.repo.(FindingWriter); ok {
+		return w.WriteFinding(ctx, f)
+	}
+	// the legacy methods can't apply suggestions, they are shown as a diff
+	if err := r.repo.WriteMultiLineComment(f.Path, RenderSuggestion(f, SuggestionDiff), f.StartLine, f.EndLine); err != nil {
+		return FailedResult(f, err)
+	}
+	return Result{Finding: f, Status: StatusCreated}
+}
+
+func (r *repositoryV2) ReconcileFindings(ctx context.Context, marker string, findings []Finding) ([]Result, error) {
+	if err := ctx.Err(); err != nil {
+		return FailFindings(findings, err), err
+	}
+	switch rec := r.repo.(type) {
+	case FindingReconciler:
+		return rec.ReconcileFindings(ctx, marker, findings)
+	case Reconciler:
+		// The legacy reconciler does not report per finding, so all we know is
+		// whether the run as a whole went through.
+		if err := rec.ReconcileAquaComments(marker, findings); err != nil {
+			return FailFindings(findings, err), err
+		}
+		results := make([]Result, 0, len(findings))
+		for _, f := range findings {
+			results = append(results, Result{Finding: f, Status: StatusReconciled})
+		}
+		return results, nil
+	}
+
+	if err := r.RemoveAquaComments(ctx, marker); err != nil {
+		return FailFindings(findings, err), err
+	}
+	return r.WriteFindings(ctx, findings)
+}
+
+func (r *repositoryV2) RemoveAquaComments(ctx context.Context, marker string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rm, ok := r.repo.(CommentRemover); ok {
+		return rm.RemoveAquaComments(ctx, marker)
+	}
+	return r.repo.RemovePreviousAquaComments(marker)
+}
+
+// FailFindings returns a failed Result carrying err for each of findings.
+func FailFindings(findings []Finding, err error) []Result {
+	results := make([]Result, 0, len(findings))
+	for _, f := range findings {
+		results = append(results, Result{Finding: f, Status: StatusFailed, Err: err})
+	}
+	return results
+}
+
+// Summarize counts results by status.
+func Summarize(results []Result) map[Status]int {
+	counts := make(map[Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	return counts
+}
+
+// FirstError returns the first per-finding error, or nil when every finding went through.
+func FirstError(results []Result) error {
+	for _, r := range results {
+		if r.Err != nil && r.Status == StatusFailed {
+			return r.Err
+		}
+	}
+	return nil
+}
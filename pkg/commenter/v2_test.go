@@ -0,0 +1,127 @@
+package commenter
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type legacyRepo struct {
+	written []string
+	removed []string
+	failOn  string
+}
+
+func (r *legacyRepo) WriteMultiLineComment(file, _ string, _, _ int) error {
+	if file == r.failOn {
+		return errors.New("rejected")
+	}
+	r.written = append(r.written, file)
+	return nil
+}
+
+func (r *legacyRepo) WriteLineComment(file, comment string, line int) error {
+	return r.WriteMultiLineComment(file, comment, line, line)
+}
+
+func (r *legacyRepo) RemovePreviousAquaComments(msg string) error {
+	r.removed = append(r.removed, msg)
+	return nil
+}
+
+type writerRepo struct {
+	legacyRepo
+}
+
+func (r *writerRepo) WriteFinding(_ context.Context, f Finding) Result {
+	return Result{Finding: f, Status: StatusEdited, CommentID: "7", URL: "https://example.com/7"}
+}
+
+func TestRepositoryV2_LegacyWriteReportsPerFinding(t *testing.T) {
+	repo := &legacyRepo{failOn: "b.go"}
+	results, err := NewRepositoryV2(repo).WriteFindings(context.Background(), []Finding{
+		{Path: "a.go", StartLine: 1, EndLine: 1},
+		{Path: "b.go", StartLine: 1, EndLine: 1},
+	})
+	if err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Status != StatusCreated || results[1].Status != StatusFailed || results[1].Err == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if FirstError(results) == nil {
+		t.Fatalf("expected FirstError to report the rejected finding")
+	}
+}
+
+func TestRepositoryV2_UsesFindingWriter(t *testing.T) {
+	repo := &writerRepo{}
+	results, err := NewRepositoryV2(repo).WriteFindings(context.Background(), []Finding{{Path: "a.go"}})
+	if err != nil {
+		t.Fatalf("write findings: %v", err)
+	}
+	if results[0].Status != StatusEdited || results[0].CommentID != "7" || results[0].URL == "" {
+		t.Fatalf("expected the provider result to be passed through, got %+v", results[0])
+	}
+	if len(repo.written) != 0 {
+		t.Fatalf("legacy write path must not be used, got %v", repo.written)
+	}
+}
+
+func TestRepositoryV2_CanceledContextStopsRun(t *testing.T) {
+	repo := &legacyRepo{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := NewRepositoryV2(repo).WriteFindings(ctx, []Finding{{Path: "a.go"}, {Path: "b.go"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != 2 || results[0].Status != StatusFailed || results[1].Status != StatusFailed {
+		t.Fatalf("expected every finding to be reported as failed, got %+v", results)
+	}
+	if len(repo.written) != 0 {
+		t.Fatalf("nothing should be written after cancellation, got %v", repo.written)
+	}
+}
+
+func TestRepositoryV2_ReconcileFallsBackToRemoveAndRepost(t *testing.T) {
+	repo := &legacyRepo{}
+	results, err := NewRepositoryV2(repo).ReconcileFindings(context.Background(), "marker", []Finding{{Path: "a.go"}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(repo.removed) != 1 || repo.removed[0] != "marker" {
+		t.Fatalf("expected previous comments to be removed, got %v", repo.removed)
+	}
+	if got := Summarize(results); got[StatusCreated] != 1 {
+		t.Fatalf("expected one created result, got %v", got)
+	}
+}
+
+type reconcilerRepo struct {
+	legacyRepo
+	reconciled []Finding
+}
+
+func (r *reconcilerRepo) ReconcileAquaComments(_ string, current []Finding) error {
+	r.reconciled = current
+	return nil
+}
+
+func TestRepositoryV2_LegacyReconcilerDoesNotInventStatuses(t *testing.T) {
+	repo := &reconcilerRepo{}
+	results, err := NewRepositoryV2(repo).ReconcileFindings(context.Background(), "marker", []Finding{{Path: "a.go"}, {Path: "b.go"}})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(repo.reconciled) != 2 {
+		t.Fatalf("expected the findings to be reconciled, got %v", repo.reconciled)
+	}
+	if got := Summarize(results); got[StatusReconciled] != 2 {
+		t.Fatalf("expected the findings to be reported as reconciled, got %v", got)
+	}
+}
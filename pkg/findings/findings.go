@@ -0,0 +1,174 @@
+package findings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// Format is the encoding of the findings input.
+type Format string
+
+const (
+	// JSON is an array of Finding
+	JSON Format = "json"
+	// JSONL is one Finding per line
+	JSONL Format = "jsonl"
+	// RDJSON is a reviewdog DiagnosticResult
+	RDJSON Format = "rdjson"
+	// RDJSONL is one reviewdog Diagnostic per line
+	RDJSONL Format = "rdjsonl"
+)
+
+// Options control how the input is turned into findings.
+type Options struct {
+	// Marker identifies the Aqua comments, it is appended to every body
+	Marker string
+	// Provider is the vendor the findings are written to, it decides how the
+	// metadata is hidden in the body
+	Provider string
+}
+
+// Finding is the input schema, mirroring commenter.Finding. RuleID and
+// Severity are kept in the comment metadata. When Fingerprint is empty it is
+// taken from a metadata block in Body, or computed from the rule and the body.
+type Finding struct {
+	Path        string `json:"path"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	Body        string `json:"body"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	RuleID      string `json:"rule_id,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	Suggestion  string `json:"suggestion,omitempty"`
+}
+
+// FormatFor guesses the format from the file extension, defaulting to JSONL
+// which suits streaming from stdin.
+func FormatFor(path string) Format {
+	switch ext := Format(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case JSON, JSONL, RDJSON, RDJSONL:
+		return ext
+	}
+	return JSONL
+}
+
+// Decoder reads findings one at a time, so line based input is processed as
+// it arrives.
+type Decoder struct {
+	dec    *json.Decoder
+	format Format
+	opts   Options
+
+	started bool
+	pending []commenter.Finding
+}
+
+func NewDecoder(r io.Reader, format Format, opts Options) (*Decoder, error) {
+	switch format {
+	case JSON, JSONL, RDJSON, RDJSONL:
+	default:
+		return nil, fmt.Errorf("unsupported findings format: %q", format)
+	}
+	return &Decoder{dec: json.NewDecoder(r), format: format, opts: opts}, nil
+}
+
+// Next returns the next finding, or io.EOF once the input is exhausted.
+func (d *Decoder) Next() (commenter.Finding, error) {
+	if len(d.pending) > 0 {
+		f := d.pending[0]
+		d.pending = d.pending[1:]
+		return f, nil
+	}
+
+	switch d.format {
+	case JSON:
+		return d.nextInArray()
+	case RDJSON:
+		if d.started {
+			return commenter.Finding{}, io.EOF
+		}
+		d.started = true
+		var result DiagnosticResult
+		if err := d.dec.Decode(&result); err != nil {
+			return commenter.Finding{}, decodeError(err)
+		}
+		for _, diagnostic := range result.Diagnostics {
+			d.pending = append(d.pending, diagnostic.finding(result.Source, result.Severity, d.opts))
+		}
+		return d.Next()
+	case RDJSONL:
+		var diagnostic Diagnostic
+		if err := d.dec.Decode(&diagnostic); err != nil {
+			return commenter.Finding{}, decodeError(err)
+		}
+		return diagnostic.finding(nil, "", d.opts), nil
+	default:
+		var f Finding
+		if err := d.dec.Decode(&f); err != nil {
+			return commenter.Finding{}, decodeError(err)
+		}
+		return f.finding(d.opts), nil
+	}
+}
+
+// nextInArray decodes the array element by element instead of as a whole.
+func (d *Decoder) nextInArray() (commenter.Finding, error) {
+	if !d.started {
+		d.started = true
+		token, err := d.dec.Token()
+		if err != nil {
+			return commenter.Finding{}, decodeError(err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return commenter.Finding{}, fmt.Errorf("failed decoding findings: expected an array")
+		}
+	}
+	if !d.dec.More() {
+		return commenter.Finding{}, io.EOF
+	}
+	var f Finding
+	if err := d.dec.Decode(&f); err != nil {
+		return commenter.Finding{}, decodeError(err)
+	}
+	return f.finding(d.opts), nil
+}
+
+func decodeError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	return fmt.Errorf("failed decoding findings: %w", err)
+}
+
+func (f Finding) finding(opts Options) commenter.Finding {
+	meta, _ := fingerprint.Parse(f.Body)
+	if f.Fingerprint != "" {
+		meta.Fingerprint = f.Fingerprint
+	}
+	if f.RuleID != "" {
+		meta.RuleID = f.RuleID
+	}
+	if f.Severity != "" {
+		meta.Severity = strings.ToUpper(f.Severity)
+	}
+	path := cleanPath(f.Path)
+	if meta.Fingerprint == "" {
+		meta.Fingerprint = fingerprint.Compute(meta.RuleID, path, fingerprint.Strip(f.Body))
+	}
+	// The hash is recomputed for the body as written now
+	meta.BodyHash = ""
+	finding := commenter.NewFinding(path, f.StartLine, f.EndLine, f.Body, opts.Marker, meta, opts.Provider)
+	finding.Suggestion = f.Suggestion
+	return finding
+}
+
+func cleanPath(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "./"), "/")
+}
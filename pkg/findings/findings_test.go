@@ -0,0 +1,115 @@
+package findings
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+func decode(t *testing.T, input string, format Format) []commenter.Finding {
+	t.Helper()
+	dec, err := NewDecoder(strings.NewReader(input), format, Options{Marker: testMarker, Provider: fingerprint.GitHub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []commenter.Finding
+	for {
+		f, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, f)
+	}
+}
+
+func TestDecoder_Formats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"json", JSON, `[{"path":"./a.go","start_line":3,"end_line":4,"body":"use x","rule_id":"R1","severity":"high"},
+			{"path":"b.go","start_line":1,"end_line":1,"body":"use y","fingerprint":"abc"}]`},
+		{"jsonl", JSONL, `{"path":"./a.go","start_line":3,"end_line":4,"body":"use x","rule_id":"R1","severity":"high"}
+
+{"path":"b.go","start_line":1,"end_line":1,"body":"use y","fingerprint":"abc"}
+`},
+		{"rdjson", RDJSON, `{"source":{"name":"linter"},"severity":"ERROR","diagnostics":[
+			{"message":"use x","location":{"path":"./a.go","range":{"start":{"line":3},"end":{"line":4}}},"code":{"value":"R1"}},
+			{"message":"use y","severity":"INFO","location":{"path":"b.go","range":{"start":{"line":1}}},"code":{"value":"R2","url":"https://example.com/r2"}}]}`},
+		{"rdjsonl", RDJSONL, `{"message":"use x","severity":"ERROR","location":{"path":"./a.go","range":{"start":{"line":3},"end":{"line":4}}},"code":{"value":"R1"}}
+{"message":"use y","severity":"INFO","location":{"path":"b.go","range":{"start":{"line":1}}},"code":{"value":"R2","url":"https://example.com/r2"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decode(t, tt.input, tt.format)
+			if len(got) != 2 {
+				t.Fatalf("expected 2 findings, got %d", len(got))
+			}
+			if got[0].Path != "a.go" || got[0].StartLine != 3 || got[0].EndLine != 4 || got[1].Path != "b.go" || got[1].EndLine != 1 {
+				t.Fatalf("unexpected locations: %+v", got)
+			}
+			meta, ok := fingerprint.Parse(got[0].Body)
+			if !ok || meta.RuleID != "R1" || meta.Severity != "HIGH" || meta.Fingerprint == "" || meta.Fingerprint != got[0].Fingerprint {
+				t.Fatalf("unexpected metadata: %+v", meta)
+			}
+			for _, f := range got {
+				if !strings.Contains(f.Body, testMarker) {
+					t.Fatalf("body is missing the marker:\n%s", f.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoder_KeepsGivenFingerprint(t *testing.T) {
+	got := decode(t, `{"path":"b.go","start_line":1,"body":"use y","fingerprint":"abc"}`, JSONL)
+	if got[0].Fingerprint != "abc" || commenter.ExtractFingerprint(got[0].Body) != "abc" {
+		t.Fatalf("expected the given fingerprint, got %q", got[0].Fingerprint)
+	}
+}
+
+func TestDecoder_KeepsSuggestion(t *testing.T) {
+	got := decode(t, `{"path":"go.mod","start_line":3,"body":"outdated","suggestion":"require x v1.2.3"}`, JSONL)
+	if got[0].Suggestion != "require x v1.2.3" {
+		t.Fatalf("expected the suggestion, got %q", got[0].Suggestion)
+	}
+}
+
+func TestDecoder_Streams(t *testing.T) {
+	r, w := io.Pipe()
+	dec, err := NewDecoder(r, JSONL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = w.Write([]byte(`{"path":"a.go","start_line":1,"body":"first"}` + "\n"))
+	}()
+
+	// The first finding is returned while the writer is still open
+	f, err := dec.Next()
+	if err != nil || f.Path != "a.go" {
+		t.Fatalf("unexpected first finding %+v: %v", f, err)
+	}
+	_ = w.Close()
+	if _, err := dec.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	for path, want := range map[string]Format{"out.json": JSON, "out.rdjsonl": RDJSONL, "-": JSONL, "out.txt": JSONL} {
+		if got := FormatFor(path); got != want {
+			t.Errorf("FormatFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
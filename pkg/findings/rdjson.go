@@ -0,0 +1,119 @@
+package findings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// DiagnosticResult is the reviewdog rdjson document.
+type DiagnosticResult struct {
+	Source      *Source      `json:"source"`
+	Severity    string       `json:"severity"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostic is a single reviewdog diagnostic, one per line in rdjsonl.
+type Diagnostic struct {
+	Message        string   `json:"message"`
+	Location       Location `json:"location"`
+	Severity       string   `json:"severity"`
+	Source         *Source  `json:"source"`
+	Code           *Code    `json:"code"`
+	OriginalOutput string   `json:"original_output"`
+}
+
+type Source struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type Code struct {
+	Value string `json:"value"`
+	Url   string `json:"url"`
+}
+
+type Location struct {
+	Path  string `json:"path"`
+	Range *Range `json:"range"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// finding maps the diagnostic, the source and severity of the rdjson
+// document apply when the diagnostic has none of its own.
+func (d Diagnostic) finding(resultSource *Source, resultSeverity string, opts Options) commenter.Finding {
+	source := d.Source
+	if source == nil {
+		source = resultSource
+	}
+	if d.Severity == "" {
+		d.Severity = resultSeverity
+	}
+	ruleId := ""
+	if d.Code != nil {
+		ruleId = d.Code.Value
+	}
+	if ruleId == "" && source != nil {
+		ruleId = source.Name
+	}
+
+	path := cleanPath(d.Location.Path)
+	startLine, endLine := commenter.FIRST_AVAILABLE_LINE, commenter.FIRST_AVAILABLE_LINE
+	if r := d.Location.Range; r != nil && r.Start.Line > 0 {
+		startLine, endLine = r.Start.Line, r.End.Line
+		if endLine < startLine {
+			endLine = startLine
+		}
+	}
+
+	meta := fingerprint.Metadata{
+		Fingerprint: fingerprint.Compute(ruleId, path, d.Message),
+		RuleID:      ruleId,
+		Severity:    severity(d.Severity),
+	}
+	return commenter.NewFinding(path, startLine, endLine, d.body(source, meta.Severity), opts.Marker, meta, opts.Provider)
+}
+
+func (d Diagnostic) body(source *Source, severity string) string {
+	var title []string
+	if source != nil && source.Name != "" {
+		title = append(title, source.Name)
+	}
+	if d.Code != nil && d.Code.Value != "" {
+		title = append(title, d.Code.Value)
+	}
+
+	var sb strings.Builder
+	if len(title) > 0 {
+		fmt.Fprintf(&sb, "**%s** (%s)\n\n", strings.Join(title, ": "), severity)
+	}
+	sb.WriteString(d.Message + "\n")
+	if d.Code != nil && d.Code.Url != "" {
+		fmt.Fprintf(&sb, "\n[%s](%s)\n", d.Code.Value, d.Code.Url)
+	}
+	return sb.String()
+}
+
+// severity maps the reviewdog severities to the scanner ones.
+func severity(s string) string {
+	switch s {
+	case "ERROR":
+		return "HIGH"
+	case "WARNING":
+		return "MEDIUM"
+	case "INFO":
+		return "LOW"
+	}
+	return commenter.UnknownSeverity
+}
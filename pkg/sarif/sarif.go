@@ -0,0 +1,321 @@
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+// Options control how SARIF results are turned into findings.
+type Options struct {
+	// Marker identifies the Aqua comments, it is appended to every body
+	Marker string
+	// Provider is the vendor the findings are written to, it decides how the
+	// metadata is hidden in the body
+	Provider string
+	// SourceRoot is trimmed from artifact locations given as absolute paths
+	SourceRoot string
+}
+
+type Log struct {
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	SemanticVersion string `json:"semanticVersion"`
+	Rules           []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Id                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	ShortDescription     *Message               `json:"shortDescription"`
+	FullDescription      *Message               `json:"fullDescription"`
+	HelpUri              string                 `json:"helpUri"`
+	MessageStrings       map[string]Message     `json:"messageStrings"`
+	DefaultConfiguration *Configuration         `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties"`
+}
+
+type Configuration struct {
+	Level string `json:"level"`
+}
+
+type Message struct {
+	Text      string   `json:"text"`
+	Markdown  string   `json:"markdown"`
+	Id        string   `json:"id"`
+	Arguments []string `json:"arguments"`
+}
+
+type Result struct {
+	RuleId              string            `json:"ruleId"`
+	RuleIndex           *int              `json:"ruleIndex"`
+	Kind                string            `json:"kind"`
+	Level               string            `json:"level"`
+	Message             Message           `json:"message"`
+	Locations           []Location        `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Fingerprints        map[string]string `json:"fingerprints"`
+	Suppressions        []interface{}     `json:"suppressions"`
+}
+
+type Location struct {
+	PhysicalLocation *PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region"`
+}
+
+type ArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type Region struct {
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	Snippet   *Message `json:"snippet"`
+}
+
+var placeholderRe = regexp.MustCompile(`\{(\d+)\}`)
+
+// Parse reads a SARIF log and maps every failing result with a location in a
+// file to a finding. Suppressed results are left out.
+func Parse(r io.Reader, opts Options) ([]commenter.Finding, error) {
+	var log Log
+	if err := json.NewDecoder(r).Decode(&log); err != nil {
+		return nil, fmt.Errorf("failed decoding sarif log: %w", err)
+	}
+
+	var findings []commenter.Finding
+	for _, run := range log.Runs {
+		version := run.Tool.Driver.SemanticVersion
+		if version == "" {
+			version = run.Tool.Driver.Version
+		}
+		for _, result := range run.Results {
+			if (result.Kind != "" && result.Kind != "fail") || len(result.Suppressions) > 0 {
+				continue
+			}
+			rule := run.rule(result)
+			perPath := make(map[string]int)
+			for _, location := range result.Locations {
+				if location.PhysicalLocation != nil && location.PhysicalLocation.ArtifactLocation.Uri != "" {
+					perPath[artifactPath(location.PhysicalLocation.ArtifactLocation.Uri, opts.SourceRoot)]++
+				}
+			}
+			seen := make(map[string]bool)
+			for _, location := range result.Locations {
+				if location.PhysicalLocation == nil || location.PhysicalLocation.ArtifactLocation.Uri == "" {
+					continue
+				}
+				path := artifactPath(location.PhysicalLocation.ArtifactLocation.Uri, opts.SourceRoot)
+				f := newFinding(result, rule, *location.PhysicalLocation, version, perPath[path] > 1, opts)
+				if seen[f.Fingerprint] {
+					continue
+				}
+				seen[f.Fingerprint] = true
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// newFinding maps a location of the result to a finding. When the result has
+// several locations in the file, shared is set and the region of the location
+// is part of the fingerprint so each of them gets its own comment.
+func newFinding(result Result, rule Rule, location PhysicalLocation, version string, shared bool, opts Options) commenter.Finding {
+	path := artifactPath(location.ArtifactLocation.Uri, opts.SourceRoot)
+	startLine, endLine := commenter.FIRST_AVAILABLE_LINE, commenter.FIRST_AVAILABLE_LINE
+	snippet := ""
+	if region := location.Region; region != nil && region.StartLine > 0 {
+		startLine, endLine = region.StartLine, region.EndLine
+		if endLine < startLine {
+			endLine = startLine
+		}
+		if region.Snippet != nil {
+			snippet = region.Snippet.Text
+		}
+	}
+	regionKey := ""
+	if shared {
+		regionKey = snippet
+		if regionKey == "" {
+			regionKey = fmt.Sprintf("%d-%d", startLine, endLine)
+		}
+	}
+
+	ruleId := result.RuleId
+	if ruleId == "" {
+		ruleId = rule.Id
+	}
+	message := messageText(result.Message, rule)
+	severity := severity(result, rule)
+
+	meta := fingerprint.Metadata{
+		Fingerprint:    resultFingerprint(result, ruleId, path, snippet, message, regionKey),
+		RuleID:         ruleId,
+		Severity:       severity,
+		ScannerVersion: version,
+	}
+	return commenter.NewFinding(path, startLine, endLine, renderBody(ruleId, rule, severity, message), opts.Marker, meta, opts.Provider)
+}
+
+func (r Run) rule(result Result) Rule {
+	rules := r.Tool.Driver.Rules
+	if result.RuleIndex != nil && *result.RuleIndex >= 0 && *result.RuleIndex < len(rules) {
+		return rules[*result.RuleIndex]
+	}
+	for _, rule := range rules {
+		if rule.Id == result.RuleId {
+			return rule
+		}
+	}
+	return Rule{}
+}
+
+// artifactPath turns the artifact URI into a path relative to the repository root.
+func artifactPath(uri, sourceRoot string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		uri = u.Path
+	} else if unescaped, err := url.PathUnescape(uri); err == nil {
+		uri = unescaped
+	}
+	if sourceRoot != "" {
+		uri = strings.TrimPrefix(uri, strings.TrimSuffix(sourceRoot, "/")+"/")
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(uri, "./"), "/")
+}
+
+// messageText resolves the message text, which may be given by id from the
+// rule message strings, and fills in its arguments.
+func messageText(m Message, rule Rule) string {
+	text := m.Text
+	if text == "" && m.Id != "" {
+		text = rule.MessageStrings[m.Id].Text
+	}
+	return placeholderRe.ReplaceAllStringFunc(text, func(placeholder string) string {
+		i, _ := strconv.Atoi(placeholder[1 : len(placeholder)-1])
+		if i < len(m.Arguments) {
+			return m.Arguments[i]
+		}
+		return placeholder
+	})
+}
+
+// resultFingerprint prefers the fingerprints computed by the tool, which are
+// stable by design. Otherwise it is computed from the offending code, or the
+// message when the tool didn't include a snippet, so it ignores the line. The
+// region tells apart the locations of a result that share a file.
+func resultFingerprint(result Result, ruleId, path, snippet, message, region string) string {
+	for _, fps := range []map[string]string{result.PartialFingerprints, result.Fingerprints} {
+		if len(fps) > 0 {
+			return fingerprint.Compute(ruleId, path, withRegion(joinFingerprints(fps), region))
+		}
+	}
+	if snippet == "" {
+		snippet = message
+	}
+	return fingerprint.Compute(ruleId, path, withRegion(snippet, region))
+}
+
+func withRegion(snippet, region string) string {
+	if region == "" {
+		return snippet
+	}
+	return snippet + "\n" + region
+}
+
+func joinFingerprints(fps map[string]string) string {
+	keys := make([]string, 0, len(fps))
+	for key := range fps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, key+"="+fps[key])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// severity prefers the CVSS based security-severity property used by code
+// scanning, falling back to the result or rule level.
+func severity(result Result, rule Rule) string {
+	if score, ok := securitySeverity(rule.Properties["security-severity"]); ok {
+		switch {
+		case score >= 9:
+			return "CRITICAL"
+		case score >= 7:
+			return "HIGH"
+		case score >= 4:
+			return "MEDIUM"
+		case score > 0:
+			return "LOW"
+		}
+	}
+
+	level := result.Level
+	if level == "" && rule.DefaultConfiguration != nil {
+		level = rule.DefaultConfiguration.Level
+	}
+	switch level {
+	case "error":
+		return "HIGH"
+	case "note":
+		return "LOW"
+	case "none":
+		return commenter.UnknownSeverity
+	default:
+		// warning is the default level in SARIF
+		return "MEDIUM"
+	}
+}
+
+func securitySeverity(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case string:
+		score, err := strconv.ParseFloat(v, 64)
+		return score, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func renderBody(ruleId string, rule Rule, severity, message string) string {
+	title := ruleId
+	if rule.ShortDescription != nil && rule.ShortDescription.Text != "" {
+		title = fmt.Sprintf("%s: %s", ruleId, rule.ShortDescription.Text)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s** (%s)\n\n%s\n", title, severity, message)
+	if rule.HelpUri != "" {
+		fmt.Fprintf(&sb, "\n[More information](%s)\n", rule.HelpUri)
+	}
+	return sb.String()
+}
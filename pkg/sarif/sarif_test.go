@@ -0,0 +1,119 @@
+package sarif
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+const testLog = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "scanner", "version": "0.50.1", "rules": [
+      {"id": "AVD-AWS-0086", "shortDescription": {"text": "S3 public access block"},
+       "helpUri": "https://avd.aquasec.com/misconfig/avd-aws-0086",
+       "messageStrings": {"default": {"text": "Bucket {0} allows public ACLs"}},
+       "properties": {"security-severity": "8.1"}},
+      {"id": "no-snippet", "defaultConfiguration": {"level": "note"}}
+    ]}},
+    "results": [
+      {"ruleId": "AVD-AWS-0086", "ruleIndex": 0, "message": {"id": "default", "arguments": ["logs"]},
+       "partialFingerprints": {"primaryLocationLineHash": "abc:1"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///src/repo/infra/s3.tf"},
+         "region": {"startLine": 12, "endLine": 15}}}]},
+      {"ruleId": "no-snippet", "level": "error", "message": {"text": "no region"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "./main.go"}}}]},
+      {"ruleId": "no-snippet", "message": {"text": "suppressed"}, "suppressions": [{"kind": "inSource"}],
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "main.go"}, "region": {"startLine": 3}}}]},
+      {"ruleId": "no-snippet", "kind": "pass", "message": {"text": "passed"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "main.go"}, "region": {"startLine": 4}}}]},
+      {"ruleId": "no-snippet", "message": {"text": "no location"}}
+    ]
+  }]
+}`
+
+func parse(t *testing.T, log string, opts Options) []commenter.Finding {
+	t.Helper()
+	findings, err := Parse(strings.NewReader(log), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return findings
+}
+
+func TestParse(t *testing.T) {
+	findings := parse(t, testLog, Options{Marker: testMarker, Provider: fingerprint.GitHub, SourceRoot: "/src/repo"})
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(findings))
+	}
+
+	f := findings[0]
+	if f.Path != "infra/s3.tf" || f.StartLine != 12 || f.EndLine != 15 {
+		t.Fatalf("unexpected location: %s:%d-%d", f.Path, f.StartLine, f.EndLine)
+	}
+	for _, want := range []string{"AVD-AWS-0086: S3 public access block", "(HIGH)", "Bucket logs allows public ACLs",
+		"https://avd.aquasec.com/misconfig/avd-aws-0086", testMarker} {
+		if !strings.Contains(f.Body, want) {
+			t.Errorf("body is missing %q:\n%s", want, f.Body)
+		}
+	}
+	meta, ok := fingerprint.Parse(f.Body)
+	if !ok || meta.Fingerprint != f.Fingerprint || meta.RuleID != "AVD-AWS-0086" || meta.Severity != "HIGH" || meta.ScannerVersion != "0.50.1" {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+
+	f = findings[1]
+	if f.Path != "main.go" || f.StartLine != commenter.FIRST_AVAILABLE_LINE {
+		t.Fatalf("unexpected location: %s:%d", f.Path, f.StartLine)
+	}
+	if meta, _ := fingerprint.Parse(f.Body); meta.Severity != "HIGH" {
+		t.Fatalf("expected the result level to win over the rule default, got %q", meta.Severity)
+	}
+}
+
+func TestParse_FingerprintIgnoresLine(t *testing.T) {
+	moved := strings.Replace(testLog, `"startLine": 12, "endLine": 15`, `"startLine": 40, "endLine": 43`, 1)
+	before := parse(t, testLog, Options{SourceRoot: "/src/repo"})
+	after := parse(t, moved, Options{SourceRoot: "/src/repo"})
+	if before[0].Fingerprint != after[0].Fingerprint || after[0].StartLine != 40 {
+		t.Fatalf("expected the fingerprint to survive the move: %s != %s", before[0].Fingerprint, after[0].Fingerprint)
+	}
+}
+
+func TestParse_LinkReferenceStyle(t *testing.T) {
+	findings := parse(t, testLog, Options{Marker: testMarker, Provider: fingerprint.BitbucketServer})
+	if !strings.Contains(findings[0].Body, "[//]: # (aqua-meta:") {
+		t.Fatalf("expected a link reference metadata block:\n%s", findings[0].Body)
+	}
+}
+
+func TestParse_LocationsInOneFile(t *testing.T) {
+	findings := parse(t, `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "scanner"}},
+    "results": [
+      {"ruleId": "hardcoded-secret", "message": {"text": "secret"},
+       "partialFingerprints": {"primaryLocationLineHash": "abc:1"},
+       "locations": [
+         {"physicalLocation": {"artifactLocation": {"uri": "main.go"}, "region": {"startLine": 3, "snippet": {"text": "key := \"a\""}}}},
+         {"physicalLocation": {"artifactLocation": {"uri": "main.go"}, "region": {"startLine": 9, "snippet": {"text": "key := \"b\""}}}},
+         {"physicalLocation": {"artifactLocation": {"uri": "main.go"}, "region": {"startLine": 9, "snippet": {"text": "key := \"b\""}}}}
+       ]}
+    ]
+  }]
+}`, Options{})
+	if len(findings) != 2 {
+		t.Fatalf("expected a finding per distinct location, got %+v", findings)
+	}
+	if findings[0].StartLine != 3 || findings[1].StartLine != 9 {
+		t.Fatalf("unexpected lines %d and %d", findings[0].StartLine, findings[1].StartLine)
+	}
+	if findings[0].Fingerprint == findings[1].Fingerprint {
+		t.Fatalf("expected the locations to have their own fingerprints, got %q twice", findings[0].Fingerprint)
+	}
+}
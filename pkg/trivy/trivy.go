@@ -0,0 +1,271 @@
+package trivy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+const (
+	avdMisconfigUrl = "https://avd.aquasec.com/misconfig/"
+	avdVulnUrl      = "https://avd.aquasec.com/nvd/"
+
+	// osPackagesClass results are about the packages of an image, there is no
+	// file in the repository to anchor them to
+	osPackagesClass = "os-pkgs"
+	statusFail      = "FAIL"
+)
+
+// Options control how the report is turned into findings.
+type Options struct {
+	// Marker identifies the Aqua comments, it is appended to every body
+	Marker string
+	// Provider is the vendor the findings are written to, it decides how the
+	// metadata is hidden in the body
+	Provider string
+}
+
+type Report struct {
+	SchemaVersion int      `json:"SchemaVersion"`
+	ArtifactName  string   `json:"ArtifactName"`
+	Trivy         *Version `json:"Trivy"`
+	Results       []Result `json:"Results"`
+}
+
+type Version struct {
+	Version string `json:"Version"`
+}
+
+type Result struct {
+	Target            string             `json:"Target"`
+	Class             string             `json:"Class"`
+	Type              string             `json:"Type"`
+	Packages          []Package          `json:"Packages"`
+	Vulnerabilities   []Vulnerability    `json:"Vulnerabilities"`
+	Misconfigurations []Misconfiguration `json:"Misconfigurations"`
+	Secrets           []Secret           `json:"Secrets"`
+}
+
+type Package struct {
+	ID        string     `json:"ID"`
+	Name      string     `json:"Name"`
+	Version   string     `json:"Version"`
+	Locations []Location `json:"Locations"`
+}
+
+type Location struct {
+	StartLine int `json:"StartLine"`
+	EndLine   int `json:"EndLine"`
+}
+
+type Vulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgID            string `json:"PkgID"`
+	PkgName          string `json:"PkgName"`
+	PkgPath          string `json:"PkgPath"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Title            string `json:"Title"`
+	Severity         string `json:"Severity"`
+	PrimaryURL       string `json:"PrimaryURL"`
+}
+
+type Misconfiguration struct {
+	ID            string        `json:"ID"`
+	AVDID         string        `json:"AVDID"`
+	Title         string        `json:"Title"`
+	Message       string        `json:"Message"`
+	Resolution    string        `json:"Resolution"`
+	Severity      string        `json:"Severity"`
+	PrimaryURL    string        `json:"PrimaryURL"`
+	Status        string        `json:"Status"`
+	CauseMetadata CauseMetadata `json:"CauseMetadata"`
+}
+
+type CauseMetadata struct {
+	Resource  string `json:"Resource"`
+	StartLine int    `json:"StartLine"`
+	EndLine   int    `json:"EndLine"`
+	Code      Code   `json:"Code"`
+}
+
+type Secret struct {
+	RuleID    string `json:"RuleID"`
+	Category  string `json:"Category"`
+	Severity  string `json:"Severity"`
+	Title     string `json:"Title"`
+	StartLine int    `json:"StartLine"`
+	EndLine   int    `json:"EndLine"`
+	Code      Code   `json:"Code"`
+	Match     string `json:"Match"`
+}
+
+type Code struct {
+	Lines []Line `json:"Lines"`
+}
+
+type Line struct {
+	Content string `json:"Content"`
+	IsCause bool   `json:"IsCause"`
+}
+
+// Parse reads a Trivy JSON report and maps its failed misconfigurations,
+// secrets and vulnerabilities to findings. Vulnerabilities are anchored to the
+// manifest or lockfile they were found in.
+func Parse(r io.Reader, opts Options) ([]commenter.Finding, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed decoding trivy report: %w", err)
+	}
+	version := ""
+	if report.Trivy != nil {
+		version = report.Trivy.Version
+	}
+
+	var findings []commenter.Finding
+	for _, result := range report.Results {
+		if result.Class == osPackagesClass {
+			continue
+		}
+		target := strings.TrimPrefix(strings.TrimPrefix(result.Target, "./"), "/")
+		for _, m := range result.Misconfigurations {
+			if m.Status != "" && m.Status != statusFail {
+				continue
+			}
+			findings = append(findings, misconfigurationFinding(target, m, version, opts))
+		}
+		for _, s := range result.Secrets {
+			findings = append(findings, secretFinding(target, s, version, opts))
+		}
+		for _, v := range result.Vulnerabilities {
+			findings = append(findings, vulnerabilityFinding(target, v, result.Packages, version, opts))
+		}
+	}
+	return findings, nil
+}
+
+func misconfigurationFinding(target string, m Misconfiguration, version string, opts Options) commenter.Finding {
+	id := m.AVDID
+	if id == "" {
+		id = m.ID
+	}
+	link := m.PrimaryURL
+	if link == "" {
+		link = avdMisconfigUrl + strings.ToLower(id)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s: %s** (%s)\n\n%s\n", id, m.Title, severity(m.Severity), m.Message)
+	if m.Resolution != "" {
+		fmt.Fprintf(&sb, "\n**Resolution:** %s\n", m.Resolution)
+	}
+	fmt.Fprintf(&sb, "\n[%s](%s)\n", id, link)
+
+	// The resource is stable across edits of its body, the cause lines are the
+	// fallback for checks that aren't about a resource.
+	snippet := m.CauseMetadata.Resource
+	if snippet == "" {
+		snippet = causeLines(m.CauseMetadata.Code)
+	}
+	startLine, endLine := lines(m.CauseMetadata.StartLine, m.CauseMetadata.EndLine)
+	return newFinding(target, startLine, endLine, sb.String(), id, severity(m.Severity), snippet, version, opts)
+}
+
+func secretFinding(target string, s Secret, version string, opts Options) commenter.Finding {
+	body := fmt.Sprintf("**%s** (%s)\n\nSecret of type `%s` found: `%s`\n", s.Title, severity(s.Severity), s.RuleID, s.Match)
+
+	snippet := s.Match
+	if snippet == "" {
+		snippet = causeLines(s.Code)
+	}
+	startLine, endLine := lines(s.StartLine, s.EndLine)
+	return newFinding(target, startLine, endLine, body, s.RuleID, severity(s.Severity), snippet, version, opts)
+}
+
+func vulnerabilityFinding(target string, v Vulnerability, packages []Package, version string, opts Options) commenter.Finding {
+	link := v.PrimaryURL
+	if link == "" {
+		link = avdVulnUrl + strings.ToLower(v.VulnerabilityID)
+	}
+	fix := "No fixed version is available yet."
+	if v.FixedVersion != "" {
+		fix = fmt.Sprintf("Fixed in %s.", v.FixedVersion)
+	}
+
+	var sb strings.Builder
+	title := v.VulnerabilityID
+	if v.Title != "" {
+		title += ": " + v.Title
+	}
+	fmt.Fprintf(&sb, "**%s** (%s)\n\nPackage `%s` %s is vulnerable. %s\n", title, severity(v.Severity), v.PkgName, v.InstalledVersion, fix)
+	fmt.Fprintf(&sb, "\n[%s](%s)\n", v.VulnerabilityID, link)
+
+	// The installed version is part of the snippet, a lockfile may hold several
+	// versions of the package and each of them gets its own comment.
+	pkg := v.PkgID
+	if pkg == "" {
+		pkg = v.PkgName + "@" + v.InstalledVersion
+	}
+	snippet := pkg + "\n" + v.PkgPath
+	startLine, endLine := commenter.FIRST_AVAILABLE_LINE, commenter.FIRST_AVAILABLE_LINE
+	if location, ok := packageLocation(v, packages); ok {
+		startLine, endLine = lines(location.StartLine, location.EndLine)
+	}
+	return newFinding(target, startLine, endLine, sb.String(), v.VulnerabilityID, severity(v.Severity), snippet, version, opts)
+}
+
+// packageLocation finds where the vulnerable package is declared in the
+// lockfile, which Trivy only reports when packages are listed.
+func packageLocation(v Vulnerability, packages []Package) (Location, bool) {
+	for _, p := range packages {
+		matches := p.ID != "" && p.ID == v.PkgID
+		if p.ID == "" || v.PkgID == "" {
+			matches = p.Name == v.PkgName && p.Version == v.InstalledVersion
+		}
+		if matches && len(p.Locations) > 0 {
+			return p.Locations[0], true
+		}
+	}
+	return Location{}, false
+}
+
+func newFinding(target string, startLine, endLine int, body, ruleId, severity, snippet, version string, opts Options) commenter.Finding {
+	meta := fingerprint.Metadata{
+		Fingerprint:    fingerprint.Compute(ruleId, target, snippet),
+		RuleID:         ruleId,
+		Severity:       severity,
+		ScannerVersion: version,
+	}
+	return commenter.NewFinding(target, startLine, endLine, body, opts.Marker, meta, opts.Provider)
+}
+
+func causeLines(code Code) string {
+	var lines []string
+	for _, line := range code.Lines {
+		if line.IsCause {
+			lines = append(lines, line.Content)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lines(startLine, endLine int) (int, int) {
+	if startLine <= 0 {
+		return commenter.FIRST_AVAILABLE_LINE, commenter.FIRST_AVAILABLE_LINE
+	}
+	if endLine < startLine {
+		endLine = startLine
+	}
+	return startLine, endLine
+}
+
+func severity(s string) string {
+	if s == "" {
+		return commenter.UnknownSeverity
+	}
+	return strings.ToUpper(s)
+}
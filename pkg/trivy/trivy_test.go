@@ -0,0 +1,123 @@
+package trivy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter"
+	"github.com/aquasecurity/go-git-pr-commenter/pkg/commenter/fingerprint"
+)
+
+const testMarker = "[This comment was created by Aqua Pipeline]"
+
+const testReport = `{
+  "SchemaVersion": 2,
+  "Trivy": {"Version": "0.56.1"},
+  "Results": [
+    {"Target": "infra/s3.tf", "Class": "config", "Type": "terraform",
+     "Misconfigurations": [
+       {"ID": "AVD-AWS-0086", "AVDID": "AVD-AWS-0086", "Title": "S3 Access block should block public ACL",
+        "Message": "No public access block so not blocking public acls", "Resolution": "Enable blocking any PUT calls with a public ACL specified",
+        "Severity": "HIGH", "PrimaryURL": "https://avd.aquasec.com/misconfig/avd-aws-0086", "Status": "FAIL",
+        "CauseMetadata": {"Resource": "aws_s3_bucket.logs", "StartLine": 1, "EndLine": 5}},
+       {"ID": "AVD-AWS-0088", "AVDID": "AVD-AWS-0088", "Title": "passed", "Severity": "LOW", "Status": "PASS",
+        "CauseMetadata": {"StartLine": 1, "EndLine": 5}}
+     ]},
+    {"Target": "config/.env", "Class": "secret",
+     "Secrets": [{"RuleID": "aws-access-key-id", "Category": "AWS", "Severity": "CRITICAL", "Title": "AWS Access Key ID",
+                  "StartLine": 3, "EndLine": 3, "Match": "AWS_ACCESS_KEY_ID=********************"}]},
+    {"Target": "package-lock.json", "Class": "lang-pkgs", "Type": "npm",
+     "Packages": [{"ID": "lodash@4.17.15", "Name": "lodash", "Version": "4.17.15", "Locations": [{"StartLine": 120, "EndLine": 125}]}],
+     "Vulnerabilities": [
+       {"VulnerabilityID": "CVE-2021-23337", "PkgID": "lodash@4.17.15", "PkgName": "lodash", "InstalledVersion": "4.17.15",
+        "FixedVersion": "4.17.21", "Title": "lodash: command injection via template", "Severity": "HIGH"},
+       {"VulnerabilityID": "CVE-2020-0001", "PkgID": "other@1.0.0", "PkgName": "other", "InstalledVersion": "1.0.0", "Severity": "low"}
+     ]},
+    {"Target": "alpine:3.10 (alpine 3.10.2)", "Class": "os-pkgs",
+     "Vulnerabilities": [{"VulnerabilityID": "CVE-2019-14697", "PkgName": "musl", "Severity": "CRITICAL"}]}
+  ]
+}`
+
+func parse(t *testing.T, report string) []commenter.Finding {
+	t.Helper()
+	findings, err := Parse(strings.NewReader(report), Options{Marker: testMarker, Provider: fingerprint.GitLab})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return findings
+}
+
+func TestParse(t *testing.T) {
+	findings := parse(t, testReport)
+	if len(findings) != 4 {
+		t.Fatalf("expected 4 findings, got %d", len(findings))
+	}
+
+	tests := []struct {
+		path       string
+		start, end int
+		rule       string
+		severity   string
+		contains   []string
+	}{
+		{"infra/s3.tf", 1, 5, "AVD-AWS-0086", "HIGH", []string{"S3 Access block should block public ACL", "**Resolution:**", "(https://avd.aquasec.com/misconfig/avd-aws-0086)"}},
+		{"config/.env", 3, 3, "aws-access-key-id", "CRITICAL", []string{"AWS Access Key ID", "AWS_ACCESS_KEY_ID=****"}},
+		{"package-lock.json", 120, 125, "CVE-2021-23337", "HIGH", []string{"`lodash` 4.17.15", "Fixed in 4.17.21", "(https://avd.aquasec.com/nvd/cve-2021-23337)"}},
+		{"package-lock.json", commenter.FIRST_AVAILABLE_LINE, commenter.FIRST_AVAILABLE_LINE, "CVE-2020-0001", "LOW", []string{"No fixed version"}},
+	}
+	for i, tt := range tests {
+		f := findings[i]
+		if f.Path != tt.path || f.StartLine != tt.start || f.EndLine != tt.end {
+			t.Errorf("%s: unexpected location %s:%d-%d", tt.rule, f.Path, f.StartLine, f.EndLine)
+		}
+		meta, ok := fingerprint.Parse(f.Body)
+		if !ok || meta.RuleID != tt.rule || meta.Severity != tt.severity || meta.ScannerVersion != "0.56.1" || meta.Fingerprint != f.Fingerprint {
+			t.Errorf("%s: unexpected metadata %+v", tt.rule, meta)
+		}
+		for _, want := range append(tt.contains, testMarker) {
+			if !strings.Contains(f.Body, want) {
+				t.Errorf("%s: body is missing %q:\n%s", tt.rule, want, f.Body)
+			}
+		}
+	}
+}
+
+func TestParse_StableFingerprints(t *testing.T) {
+	changed := strings.NewReplacer(
+		`"StartLine": 1, "EndLine": 5}},`, `"StartLine": 10, "EndLine": 14}},`,
+		`"StartLine": 3, "EndLine": 3`, `"StartLine": 7, "EndLine": 7`,
+	).Replace(testReport)
+
+	before, after := parse(t, testReport), parse(t, changed)
+	for i := range before {
+		if before[i].Fingerprint != after[i].Fingerprint {
+			t.Errorf("fingerprint of %s changed", before[i].Path)
+		}
+	}
+	if after[0].StartLine != 10 || after[1].StartLine != 7 {
+		t.Fatalf("expected the new lines, got %d and %d", after[0].StartLine, after[1].StartLine)
+	}
+}
+
+func TestParse_VersionsOfOnePackage(t *testing.T) {
+	findings := parse(t, `{
+  "Results": [
+    {"Target": "package-lock.json", "Class": "lang-pkgs", "Type": "npm",
+     "Vulnerabilities": [
+       {"VulnerabilityID": "CVE-2021-23337", "PkgID": "lodash@4.17.15", "PkgName": "lodash", "InstalledVersion": "4.17.15", "Severity": "HIGH"},
+       {"VulnerabilityID": "CVE-2021-23337", "PkgID": "lodash@4.17.19", "PkgName": "lodash", "InstalledVersion": "4.17.19", "Severity": "HIGH"},
+       {"VulnerabilityID": "CVE-2021-23337", "PkgName": "lodash", "InstalledVersion": "4.17.20", "Severity": "HIGH"}
+     ]}
+  ]
+}`)
+	if len(findings) != 3 {
+		t.Fatalf("expected 3 findings, got %d", len(findings))
+	}
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if seen[f.Fingerprint] {
+			t.Fatalf("expected every version of the package to have its own fingerprint, got %q twice", f.Fingerprint)
+		}
+		seen[f.Fingerprint] = true
+	}
+}